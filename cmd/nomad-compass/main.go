@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -10,12 +11,17 @@ import (
 	"time"
 
 	"github.com/brianmichel/nomad-compass/internal/auth"
+	"github.com/brianmichel/nomad-compass/internal/commitstatus"
 	"github.com/brianmichel/nomad-compass/internal/config"
+	"github.com/brianmichel/nomad-compass/internal/jobpolicy"
+	"github.com/brianmichel/nomad-compass/internal/leader"
 	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	"github.com/brianmichel/nomad-compass/internal/notify"
 	"github.com/brianmichel/nomad-compass/internal/reconcile"
 	"github.com/brianmichel/nomad-compass/internal/repo"
 	"github.com/brianmichel/nomad-compass/internal/server"
 	"github.com/brianmichel/nomad-compass/internal/storage"
+	"github.com/brianmichel/nomad-compass/internal/tracing"
 )
 
 func main() {
@@ -30,6 +36,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		logger.Error("init tracing", "error", err)
+		os.Exit(1)
+	}
+
 	db, err := storage.Open(cfg.Database.Path)
 	if err != nil {
 		logger.Error("open database", "error", err)
@@ -49,28 +61,79 @@ func main() {
 	}
 
 	credStore := storage.NewCredentialStore(db, encryptor)
-	repoStore := storage.NewRepoStore(db)
+	repoStore := storage.NewRepoStore(db, encryptor)
 	fileStore := storage.NewRepoFileStore(db)
+	historyStore := storage.NewHistoryStore(db)
+	pendingStore := storage.NewPendingChangeStore(db)
+	conflictStore := storage.NewJobConflictStore(db)
 
 	gitManager := repo.NewManager(cfg.Repo.BaseDir)
 
+	clusterStore := storage.NewClusterStore(db, encryptor)
+	notificationStore := storage.NewNotificationStore(db, encryptor)
+	dispatcher := notify.NewDispatcher(notificationStore, logger)
+
 	nomad, err := nomadclient.New(cfg.Nomad)
 	if err != nil {
 		logger.Error("init nomad client", "error", err)
 		os.Exit(1)
 	}
-
-	reconciler := reconcile.New(repoStore, fileStore, credStore, gitManager, nomad, cfg.Repo.PollInterval, logger)
-
-	srv := server.New(repoStore, fileStore, credStore, reconciler, nomad, cfg.Nomad.Address, logger)
+	targets := nomadclient.NewPool(nomadclient.Target{
+		Client:    nomad,
+		Address:   cfg.Nomad.Address,
+		Namespace: cfg.Nomad.Namespace,
+	}, func(ctx context.Context, id int64) (nomadclient.Target, error) {
+		return clusterTarget(ctx, clusterStore, id)
+	})
+
+	var leases leader.LeaseStore = storage.NewLeaseStore(db)
+	if cfg.Leader.Lock == config.LeaderLockNomad {
+		leases = nomad.Leases("nomad-compass/leader")
+	}
+	elector := leader.NewElector(leases, cfg.Leader.ID, cfg.Leader.LeaseTTL, logger)
+
+	reconciler := reconcile.New(repoStore, fileStore, credStore, historyStore, pendingStore, conflictStore, clusterStore, gitManager, targets, reconcile.Options{
+		Interval:     cfg.Repo.PollInterval,
+		MaxBackoff:   cfg.Repo.MaxBackoff,
+		Retention:    cfg.History.Retention,
+		Workers:      cfg.Repo.Workers,
+		OrphanPolicy: reconcile.OrphanPolicy(cfg.Orphans.Policy),
+
+		DeploymentTimeout: cfg.Repo.DeploymentTimeout,
+		JobPolicy: jobpolicy.Rules{
+			DenyPrivileged:     cfg.Policy.DenyPrivileged,
+			RequireResources:   cfg.Policy.RequireResources,
+			AllowedDrivers:     cfg.Policy.AllowedDrivers,
+			AllowedDatacenters: cfg.Policy.AllowedDatacenters,
+			RequiredMeta:       cfg.Policy.RequiredMeta,
+		},
+		CommitStatus: commitstatus.NewClient(nil),
+		PublicURL:    cfg.Server.PublicURL,
+		Notifier:     dispatcher,
+		Leading:      elector.IsLeader,
+	}, logger)
+
+	srv := server.New(repoStore, fileStore, credStore, clusterStore, notificationStore, historyStore, reconciler, elector, targets, logger)
 	httpServer := &http.Server{Addr: cfg.Server.Address, Handler: srv.Handler()}
 
 	go func() {
-		if err := reconciler.Run(ctx); err != nil && err != context.Canceled {
-			logger.Error("reconciler stopped", "error", err)
+		if err := dispatcher.Run(ctx); err != nil && err != context.Canceled {
+			logger.Error("notification dispatcher stopped", "error", err)
 		}
 	}()
 
+	// Only the leader reconciles; followers serve the API read-only until
+	// the leader's lease lapses.
+	electionDone := make(chan struct{})
+	go func() {
+		defer close(electionDone)
+		_ = elector.Run(ctx, func(ctx context.Context) {
+			if err := reconciler.Run(ctx); err != nil && err != context.Canceled {
+				logger.Error("reconciler stopped", "error", err)
+			}
+		})
+	}()
+
 	go func() {
 		logger.Info("http server listening", "addr", cfg.Server.Address)
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -87,4 +150,45 @@ func main() {
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		logger.Error("server shutdown", "error", err)
 	}
+	// Wait for the reconciler to stop and the lease to be released so a
+	// follower can take over without waiting for it to expire.
+	select {
+	case <-electionDone:
+	case <-shutdownCtx.Done():
+		logger.Error("leader election shutdown", "error", shutdownCtx.Err())
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("tracing shutdown", "error", err)
+	}
+}
+
+// clusterTarget builds a Nomad client for a stored cluster.
+func clusterTarget(ctx context.Context, clusters *storage.ClusterStore, id int64) (nomadclient.Target, error) {
+	cluster, err := clusters.Get(ctx, id)
+	if err != nil {
+		return nomadclient.Target{}, err
+	}
+	if cluster == nil {
+		return nomadclient.Target{}, fmt.Errorf("cluster %d not found", id)
+	}
+	secrets, err := clusters.DecryptSecrets(cluster)
+	if err != nil {
+		return nomadclient.Target{}, fmt.Errorf("decrypt cluster secrets: %w", err)
+	}
+	client, err := nomadclient.NewCluster(nomadclient.ClusterConfig{
+		Name:          cluster.Name,
+		Address:       cluster.Address,
+		Token:         secrets.Token,
+		Region:        cluster.Region,
+		Namespace:     cluster.Namespace,
+		CACert:        cluster.CACert,
+		ClientCert:    cluster.ClientCert,
+		ClientKey:     secrets.ClientKey,
+		TLSServerName: cluster.TLSServerName,
+		TLSSkipVerify: cluster.TLSSkipVerify,
+	})
+	if err != nil {
+		return nomadclient.Target{}, err
+	}
+	return nomadclient.Target{Client: client, Address: cluster.Address, Namespace: cluster.Namespace}, nil
 }
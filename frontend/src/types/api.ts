@@ -59,6 +59,9 @@ export interface Repo {
 export interface CompassStatus {
   nomad_connected: boolean;
   nomad_message?: string;
+  role?: 'leader' | 'follower';
+  instance?: string;
+  leader?: string;
 }
 
 export interface CredentialPayload {
@@ -0,0 +1,190 @@
+// Package commitstatus reports reconcile outcomes back to the Git host as
+// commit statuses.
+package commitstatus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Supported providers.
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+	ProviderGitea  = "gitea"
+)
+
+// State is the outcome reported for a commit.
+type State string
+
+const (
+	StatePending State = "pending"
+	StateSuccess State = "success"
+	StateFailure State = "failure"
+)
+
+// statusContext names compass's status among the other checks on a commit.
+const statusContext = "nomad-compass"
+
+// maxDescription is GitHub's limit on status descriptions.
+const maxDescription = 140
+
+// ValidProvider reports whether provider is supported.
+func ValidProvider(provider string) bool {
+	switch provider {
+	case ProviderGitHub, ProviderGitLab, ProviderGitea:
+		return true
+	}
+	return false
+}
+
+// Target identifies where to report a repository's statuses.
+type Target struct {
+	Provider string
+	// APIURL overrides the provider's API root, e.g. for GitHub Enterprise
+	// or a self-hosted GitLab. Empty derives it from RepoURL.
+	APIURL  string
+	RepoURL string
+	Token   string
+}
+
+// Status is reported against a single commit.
+type Status struct {
+	State       State
+	Description string
+	// TargetURL links back to compass. It may be empty.
+	TargetURL string
+}
+
+// Client posts commit statuses.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient constructs a client. A nil httpClient uses one with a short
+// timeout, so a slow Git host cannot stall reconciliation.
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{http: httpClient}
+}
+
+// Report posts status for commit.
+func (c *Client) Report(ctx context.Context, target Target, commit string, status Status) error {
+	if commit == "" {
+		return errors.New("commit is required")
+	}
+	host, path, err := ParseRepoURL(target.RepoURL)
+	if err != nil {
+		return err
+	}
+	description := status.Description
+	if len(description) > maxDescription {
+		description = description[:maxDescription-3] + "..."
+	}
+
+	var (
+		endpoint string
+		body     map[string]string
+		header   = http.Header{}
+	)
+	switch target.Provider {
+	case ProviderGitHub:
+		base := target.APIURL
+		if base == "" {
+			base = "https://api.github.com"
+			if host != "github.com" {
+				base = "https://" + host + "/api/v3"
+			}
+		}
+		endpoint = strings.TrimRight(base, "/") + "/repos/" + path + "/statuses/" + commit
+		body = map[string]string{"state": string(status.State), "context": statusContext}
+		header.Set("Authorization", "Bearer "+target.Token)
+		header.Set("Accept", "application/vnd.github+json")
+	case ProviderGitLab:
+		base := target.APIURL
+		if base == "" {
+			base = "https://" + host + "/api/v4"
+		}
+		endpoint = strings.TrimRight(base, "/") + "/projects/" + url.PathEscape(path) + "/statuses/" + commit
+		state := string(status.State)
+		if status.State == StateFailure {
+			state = "failed"
+		}
+		body = map[string]string{"state": state, "name": statusContext}
+		header.Set("PRIVATE-TOKEN", target.Token)
+	case ProviderGitea:
+		base := target.APIURL
+		if base == "" {
+			base = "https://" + host + "/api/v1"
+		}
+		endpoint = strings.TrimRight(base, "/") + "/repos/" + path + "/statuses/" + commit
+		body = map[string]string{"state": string(status.State), "context": statusContext}
+		header.Set("Authorization", "token "+target.Token)
+	default:
+		return fmt.Errorf("unknown commit status provider %q", target.Provider)
+	}
+	if description != "" {
+		body["description"] = description
+	}
+	if status.TargetURL != "" {
+		body["target_url"] = status.TargetURL
+	}
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s commit status: %s: %s", target.Provider, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// ParseRepoURL splits a clone URL into its host and repository path, e.g.
+// "github.com" and "owner/repo". Both URL and scp-style SSH forms are
+// accepted.
+func ParseRepoURL(repoURL string) (host string, path string, err error) {
+	raw := strings.TrimSpace(repoURL)
+	if strings.Contains(raw, "://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", "", fmt.Errorf("parse repository url: %w", err)
+		}
+		host, path = u.Hostname(), u.Path
+	} else if at := strings.Index(raw, "@"); at >= 0 {
+		// scp-style: git@host:owner/repo.git
+		rest := raw[at+1:]
+		colon := strings.Index(rest, ":")
+		if colon < 0 {
+			return "", "", fmt.Errorf("unsupported repository url %q", repoURL)
+		}
+		host, path = rest[:colon], rest[colon+1:]
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || !strings.Contains(path, "/") {
+		return "", "", fmt.Errorf("unsupported repository url %q", repoURL)
+	}
+	return host, path, nil
+}
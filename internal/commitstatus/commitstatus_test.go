@@ -0,0 +1,100 @@
+package commitstatus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReportProviders(t *testing.T) {
+	cases := []struct {
+		provider string
+		repoURL  string
+		path     string
+		header   string
+		value    string
+		state    string
+		nameKey  string
+	}{
+		{ProviderGitHub, "https://github.com/acme/api.git", "/repos/acme/api/statuses/abc123", "Authorization", "Bearer secret", "failure", "context"},
+		{ProviderGitLab, "git@gitlab.example.com:acme/api.git", "/projects/acme%2Fapi/statuses/abc123", "PRIVATE-TOKEN", "secret", "failed", "name"},
+		{ProviderGitea, "https://git.example.com/acme/api", "/repos/acme/api/statuses/abc123", "Authorization", "token secret", "failure", "context"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.provider, func(t *testing.T) {
+			var (
+				gotPath string
+				gotAuth string
+				body    map[string]string
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.EscapedPath()
+				gotAuth = r.Header.Get(tc.header)
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer srv.Close()
+
+			err := NewClient(nil).Report(context.Background(), Target{
+				Provider: tc.provider,
+				APIURL:   srv.URL,
+				RepoURL:  tc.repoURL,
+				Token:    "secret",
+			}, "abc123", Status{State: StateFailure, Description: "1 failed", TargetURL: "https://compass.local/repos/1"})
+			if err != nil {
+				t.Fatalf("report: %v", err)
+			}
+			if gotPath != tc.path {
+				t.Fatalf("expected path %s, got %s", tc.path, gotPath)
+			}
+			if gotAuth != tc.value {
+				t.Fatalf("expected %s %q, got %q", tc.header, tc.value, gotAuth)
+			}
+			if body["state"] != tc.state || body[tc.nameKey] != statusContext {
+				t.Fatalf("unexpected body %#v", body)
+			}
+			if body["description"] != "1 failed" || body["target_url"] != "https://compass.local/repos/1" {
+				t.Fatalf("unexpected body %#v", body)
+			}
+		})
+	}
+}
+
+func TestReportReturnsErrorOnRejectedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad credentials", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	err := NewClient(nil).Report(context.Background(), Target{
+		Provider: ProviderGitHub,
+		APIURL:   srv.URL,
+		RepoURL:  "https://github.com/acme/api",
+	}, "abc123", Status{State: StateSuccess})
+	if err == nil || !strings.Contains(err.Error(), "bad credentials") {
+		t.Fatalf("expected rejection error, got %v", err)
+	}
+}
+
+func TestParseRepoURL(t *testing.T) {
+	cases := map[string][2]string{
+		"https://github.com/acme/api.git":        {"github.com", "acme/api"},
+		"ssh://git@gitlab.com/group/sub/api.git": {"gitlab.com", "group/sub/api"},
+		"git@git.example.com:acme/api.git":       {"git.example.com", "acme/api"},
+	}
+	for raw, want := range cases {
+		host, path, err := ParseRepoURL(raw)
+		if err != nil {
+			t.Fatalf("parse %s: %v", raw, err)
+		}
+		if host != want[0] || path != want[1] {
+			t.Fatalf("parse %s: got %s %s", raw, host, path)
+		}
+	}
+	if _, _, err := ParseRepoURL("https://github.com/acme"); err == nil {
+		t.Fatalf("expected error for URL without owner and repo")
+	}
+}
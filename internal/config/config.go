@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,11 +15,19 @@ type Config struct {
 	Nomad    NomadConfig
 	Repo     RepoConfig
 	Crypto   CryptoConfig
+	History  HistoryConfig
+	Orphans  OrphanConfig
+	Policy   PolicyConfig
+	Tracing  TracingConfig
+	Leader   LeaderConfig
 }
 
 // ServerConfig drives the HTTP server.
 type ServerConfig struct {
 	Address string
+	// PublicURL is the address users reach compass at, used for links in
+	// commit statuses.
+	PublicURL string
 }
 
 // DatabaseConfig drives the persistence layer.
@@ -38,6 +47,60 @@ type NomadConfig struct {
 type RepoConfig struct {
 	BaseDir      string
 	PollInterval time.Duration
+	// MaxBackoff caps the poll delay after consecutive reconcile failures.
+	MaxBackoff time.Duration
+	// Workers bounds how many repositories are reconciled concurrently.
+	Workers int
+	// DeploymentTimeout is how long to follow a deployment after registering
+	// a job. Zero disables deployment health gating.
+	DeploymentTimeout time.Duration
+}
+
+// HistoryConfig controls how long reconciliation history is retained.
+type HistoryConfig struct {
+	// Retention is how long runs and job events are kept. Zero keeps them forever.
+	Retention time.Duration
+}
+
+// OrphanConfig controls what happens to jobs compass registered but no
+// longer tracks.
+type OrphanConfig struct {
+	// Policy is one of "report", "adopt" or "prune".
+	Policy string
+}
+
+// PolicyConfig holds the global rules every jobspec must satisfy before it
+// is registered.
+type PolicyConfig struct {
+	DenyPrivileged     bool
+	RequireResources   bool
+	AllowedDrivers     []string
+	AllowedDatacenters []string
+	RequiredMeta       []string
+}
+
+// TracingConfig controls OTLP trace export. Tracing is off when Endpoint is
+// empty.
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP collector, as host:port or a URL.
+	Endpoint string
+	// Insecure sends traces over plain HTTP to a host:port endpoint.
+	Insecure bool
+	// SampleRatio is the fraction of traces kept, from 0 to 1.
+	SampleRatio float64
+}
+
+// LeaderConfig controls leader election between instances sharing a
+// database.
+type LeaderConfig struct {
+	// ID names this instance in the lease. It must differ between instances.
+	ID string
+	// LeaseTTL is how long the leader's lease lasts without renewal, and so
+	// how long a follower waits to take over from a leader that died.
+	LeaseTTL time.Duration
+	// Lock is where the lease is kept: LeaderLockDatabase or
+	// LeaderLockNomad.
+	Lock string
 }
 
 // CryptoConfig controls how sensitive fields are secured.
@@ -45,12 +108,31 @@ type CryptoConfig struct {
 	CredentialKey []byte
 }
 
+// Leader lease backends.
+const (
+	// LeaderLockDatabase keeps the lease as a row in the database.
+	LeaderLockDatabase = "database"
+	// LeaderLockNomad keeps the lease as a lock on a Nomad variable, which
+	// Nomad's servers replicate.
+	LeaderLockNomad = "nomad"
+)
+
+// minNomadLeaseSeconds is the shortest lock TTL Nomad accepts.
+const minNomadLeaseSeconds = 10
+
 const (
 	defaultServerAddress   = ":8080"
 	defaultDatabasePath    = "data/nomad-compass.sqlite"
 	defaultNomadAddress    = "http://127.0.0.1:4646"
 	defaultRepoBaseDir     = "data/repos"
 	defaultRepoPollSeconds = 30
+	defaultRepoWorkers     = 4
+	defaultRepoBackoffSecs = 600
+	defaultDeploySeconds   = 600
+	defaultHistoryDays     = 30
+	defaultOrphanPolicy    = "report"
+	defaultTraceSampling   = 1.0
+	defaultLeaseSeconds    = 15
 )
 
 // Load reads configuration from environment variables.
@@ -58,7 +140,8 @@ func Load() (*Config, error) {
 	cfg := &Config{}
 
 	cfg.Server = ServerConfig{
-		Address: getEnv("COMPASS_HTTP_ADDR", defaultServerAddress),
+		Address:   getEnv("COMPASS_HTTP_ADDR", defaultServerAddress),
+		PublicURL: strings.TrimRight(os.Getenv("COMPASS_PUBLIC_URL"), "/"),
 	}
 
 	cfg.Database = DatabaseConfig{
@@ -79,11 +162,97 @@ func Load() (*Config, error) {
 		}
 	}
 
+	maxBackoff := time.Duration(defaultRepoBackoffSecs) * time.Second
+	if raw := os.Getenv("COMPASS_REPO_MAX_BACKOFF_SECONDS"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			maxBackoff = time.Duration(v) * time.Second
+		}
+	}
+
+	workers := defaultRepoWorkers
+	if raw := os.Getenv("COMPASS_RECONCILE_WORKERS"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			workers = v
+		}
+	}
+
+	deployTimeout := time.Duration(defaultDeploySeconds) * time.Second
+	if raw := os.Getenv("COMPASS_DEPLOYMENT_TIMEOUT_SECONDS"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v >= 0 {
+			deployTimeout = time.Duration(v) * time.Second
+		}
+	}
+
 	cfg.Repo = RepoConfig{
 		BaseDir:      getEnv("COMPASS_REPO_BASE_DIR", defaultRepoBaseDir),
 		PollInterval: poll,
+		MaxBackoff:   maxBackoff,
+		Workers:      workers,
+
+		DeploymentTimeout: deployTimeout,
 	}
 
+	retention := time.Duration(defaultHistoryDays) * 24 * time.Hour
+	if raw := os.Getenv("COMPASS_HISTORY_RETENTION_DAYS"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v >= 0 {
+			retention = time.Duration(v) * 24 * time.Hour
+		}
+	}
+
+	cfg.History = HistoryConfig{Retention: retention}
+
+	orphanPolicy := getEnv("COMPASS_ORPHAN_POLICY", defaultOrphanPolicy)
+	switch orphanPolicy {
+	case "report", "adopt", "prune":
+	default:
+		return nil, fmt.Errorf("COMPASS_ORPHAN_POLICY must be one of report, adopt or prune")
+	}
+	cfg.Orphans = OrphanConfig{Policy: orphanPolicy}
+
+	cfg.Policy = PolicyConfig{
+		DenyPrivileged:     getBool("COMPASS_POLICY_DENY_PRIVILEGED"),
+		RequireResources:   getBool("COMPASS_POLICY_REQUIRE_RESOURCES"),
+		AllowedDrivers:     getList("COMPASS_POLICY_ALLOWED_DRIVERS"),
+		AllowedDatacenters: getList("COMPASS_POLICY_ALLOWED_DATACENTERS"),
+		RequiredMeta:       getList("COMPASS_POLICY_REQUIRED_META"),
+	}
+
+	sampleRatio := defaultTraceSampling
+	if raw := os.Getenv("COMPASS_TRACING_SAMPLE_RATIO"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 0 || v > 1 {
+			return nil, fmt.Errorf("COMPASS_TRACING_SAMPLE_RATIO must be a number between 0 and 1")
+		}
+		sampleRatio = v
+	}
+	cfg.Tracing = TracingConfig{
+		Endpoint:    strings.TrimSpace(os.Getenv("COMPASS_TRACING_ENDPOINT")),
+		Insecure:    getBool("COMPASS_TRACING_INSECURE"),
+		SampleRatio: sampleRatio,
+	}
+
+	leaseTTL := time.Duration(defaultLeaseSeconds) * time.Second
+	if raw := os.Getenv("COMPASS_LEADER_LEASE_SECONDS"); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v >= 3 {
+			leaseTTL = time.Duration(v) * time.Second
+		}
+	}
+	instanceID := os.Getenv("COMPASS_INSTANCE_ID")
+	if instanceID == "" {
+		instanceID = defaultInstanceID()
+	}
+	lock := getEnv("COMPASS_LEADER_LOCK", LeaderLockDatabase)
+	switch lock {
+	case LeaderLockDatabase:
+	case LeaderLockNomad:
+		if leaseTTL < minNomadLeaseSeconds*time.Second {
+			return nil, fmt.Errorf("COMPASS_LEADER_LEASE_SECONDS must be at least %d when COMPASS_LEADER_LOCK is nomad", minNomadLeaseSeconds)
+		}
+	default:
+		return nil, fmt.Errorf("COMPASS_LEADER_LOCK must be one of database or nomad")
+	}
+	cfg.Leader = LeaderConfig{ID: instanceID, LeaseTTL: leaseTTL, Lock: lock}
+
 	keyHex := os.Getenv("COMPASS_CREDENTIAL_KEY")
 	if keyHex == "" {
 		return nil, fmt.Errorf("COMPASS_CREDENTIAL_KEY must be provided and be 64 hex characters")
@@ -98,6 +267,19 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
+// defaultInstanceID prefers the Nomad allocation ID, falling back to the
+// hostname and process ID.
+func defaultInstanceID() string {
+	if id := os.Getenv("NOMAD_ALLOC_ID"); id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "compass"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
 func getEnv(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -105,6 +287,22 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func getBool(key string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(key))
+	return v
+}
+
+// getList splits a comma separated variable, dropping blank entries.
+func getList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 func decodeHexKey(input string) ([]byte, error) {
 	if len(input) != 64 {
 		return nil, fmt.Errorf("encryption key must be 32 bytes encoded as 64 hex characters")
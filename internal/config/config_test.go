@@ -48,6 +48,21 @@ func TestLoadDefaults(t *testing.T) {
 	if cfg.Repo.PollInterval != 30*time.Second {
 		t.Fatalf("expected default poll interval, got %s", cfg.Repo.PollInterval)
 	}
+	if cfg.Repo.MaxBackoff != 10*time.Minute {
+		t.Fatalf("expected default max backoff, got %s", cfg.Repo.MaxBackoff)
+	}
+	if cfg.Repo.DeploymentTimeout != 10*time.Minute {
+		t.Fatalf("expected default deployment timeout, got %s", cfg.Repo.DeploymentTimeout)
+	}
+	if cfg.Repo.Workers != 4 {
+		t.Fatalf("expected default reconcile workers, got %d", cfg.Repo.Workers)
+	}
+	if cfg.History.Retention != 30*24*time.Hour {
+		t.Fatalf("expected default history retention, got %s", cfg.History.Retention)
+	}
+	if cfg.Orphans.Policy != "report" {
+		t.Fatalf("expected default orphan policy, got %q", cfg.Orphans.Policy)
+	}
 	if len(cfg.Crypto.CredentialKey) != 32 {
 		t.Fatalf("expected 32 byte key, got %d", len(cfg.Crypto.CredentialKey))
 	}
@@ -59,3 +74,82 @@ func TestLoadRequiresCredentialKey(t *testing.T) {
 		t.Fatalf("expected error when credential key is missing")
 	}
 }
+
+func TestLoadRejectsUnknownOrphanPolicy(t *testing.T) {
+	t.Setenv("COMPASS_CREDENTIAL_KEY", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	t.Setenv("COMPASS_ORPHAN_POLICY", "delete-everything")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for unknown orphan policy")
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	t.Setenv("COMPASS_CREDENTIAL_KEY", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	t.Setenv("COMPASS_POLICY_DENY_PRIVILEGED", "true")
+	t.Setenv("COMPASS_POLICY_ALLOWED_DRIVERS", "docker, exec,,")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Policy.DenyPrivileged || cfg.Policy.RequireResources {
+		t.Fatalf("unexpected policy flags %+v", cfg.Policy)
+	}
+	if len(cfg.Policy.AllowedDrivers) != 2 || cfg.Policy.AllowedDrivers[1] != "exec" {
+		t.Fatalf("unexpected allowed drivers %v", cfg.Policy.AllowedDrivers)
+	}
+	if cfg.Policy.AllowedDatacenters != nil {
+		t.Fatalf("expected no datacenter restriction, got %v", cfg.Policy.AllowedDatacenters)
+	}
+}
+
+func TestLoadRejectsInvalidTracingSampleRatio(t *testing.T) {
+	t.Setenv("COMPASS_CREDENTIAL_KEY", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	t.Setenv("COMPASS_TRACING_SAMPLE_RATIO", "1.5")
+	if _, err := Load(); err == nil {
+		t.Fatalf("expected error for sample ratio above 1")
+	}
+}
+
+func TestLoadLeader(t *testing.T) {
+	t.Setenv("COMPASS_CREDENTIAL_KEY", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	t.Setenv("NOMAD_ALLOC_ID", "alloc-1")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Leader.ID != "alloc-1" {
+		t.Fatalf("expected the allocation ID as instance ID, got %q", cfg.Leader.ID)
+	}
+	if cfg.Leader.LeaseTTL != 15*time.Second {
+		t.Fatalf("expected default lease ttl, got %s", cfg.Leader.LeaseTTL)
+	}
+
+	t.Setenv("COMPASS_INSTANCE_ID", "compass-a")
+	t.Setenv("COMPASS_LEADER_LEASE_SECONDS", "30")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Leader.ID != "compass-a" || cfg.Leader.LeaseTTL != 30*time.Second || cfg.Leader.Lock != LeaderLockDatabase {
+		t.Fatalf("unexpected leader config %+v", cfg.Leader)
+	}
+
+	t.Setenv("COMPASS_LEADER_LOCK", "nomad")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Leader.Lock != LeaderLockNomad {
+		t.Fatalf("expected the nomad lock, got %q", cfg.Leader.Lock)
+	}
+
+	t.Setenv("COMPASS_LEADER_LEASE_SECONDS", "5")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected a lease shorter than Nomad allows to be rejected")
+	}
+
+	t.Setenv("COMPASS_LEADER_LOCK", "consul")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an unknown lock backend to be rejected")
+	}
+}
@@ -0,0 +1,124 @@
+// Package jobpolicy checks parsed jobspecs against rules before compass
+// registers them.
+package jobpolicy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Rule names reported in violations.
+const (
+	RulePrivileged = "privileged"
+	RuleResources  = "resources"
+	RuleDriver     = "driver"
+	RuleDatacenter = "datacenter"
+	RuleMeta       = "meta"
+)
+
+// Rules restricts what a jobspec may contain. Zero values impose nothing.
+type Rules struct {
+	// DenyPrivileged rejects docker tasks that set privileged = true.
+	DenyPrivileged bool `json:"deny_privileged,omitempty"`
+	// RequireResources rejects tasks that do not set cpu (or cores) and
+	// memory explicitly.
+	RequireResources bool `json:"require_resources,omitempty"`
+	// AllowedDrivers lists the task drivers jobs may use.
+	AllowedDrivers []string `json:"allowed_drivers,omitempty"`
+	// AllowedDatacenters lists the datacenters jobs may target.
+	AllowedDatacenters []string `json:"allowed_datacenters,omitempty"`
+	// RequiredMeta lists job meta keys that must be set.
+	RequiredMeta []string `json:"required_meta,omitempty"`
+}
+
+// Empty reports whether r imposes no rules.
+func (r Rules) Empty() bool {
+	return !r.DenyPrivileged && !r.RequireResources && len(r.AllowedDrivers) == 0 && len(r.AllowedDatacenters) == 0 && len(r.RequiredMeta) == 0
+}
+
+// Violation is a rule a job breaks.
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+func (v Violation) String() string {
+	return v.Rule + ": " + v.Message
+}
+
+// Check evaluates job against every set of rules, so a job must satisfy both
+// global and repository rules.
+func Check(job *api.Job, rules ...Rules) []Violation {
+	var violations []Violation
+	for _, r := range rules {
+		violations = append(violations, r.check(job)...)
+	}
+	return violations
+}
+
+// Error combines violations into an error, or returns nil when there are none.
+func Error(violations []Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(violations))
+	for _, v := range violations {
+		messages = append(messages, v.String())
+	}
+	return errors.New("policy violation: " + strings.Join(messages, "; "))
+}
+
+func (r Rules) check(job *api.Job) []Violation {
+	if job == nil || r.Empty() {
+		return nil
+	}
+	var violations []Violation
+	if len(r.AllowedDatacenters) > 0 {
+		for _, dc := range job.Datacenters {
+			if !slices.Contains(r.AllowedDatacenters, dc) {
+				violations = append(violations, Violation{RuleDatacenter, fmt.Sprintf("datacenter %q is not allowed", dc)})
+			}
+		}
+	}
+	for _, key := range r.RequiredMeta {
+		if job.Meta[key] == "" {
+			violations = append(violations, Violation{RuleMeta, fmt.Sprintf("meta %q is required", key)})
+		}
+	}
+	for _, group := range job.TaskGroups {
+		for _, task := range group.Tasks {
+			violations = append(violations, r.checkTask(taskName(group, task), task)...)
+		}
+	}
+	return violations
+}
+
+func (r Rules) checkTask(name string, task *api.Task) []Violation {
+	var violations []Violation
+	if len(r.AllowedDrivers) > 0 && !slices.Contains(r.AllowedDrivers, task.Driver) {
+		violations = append(violations, Violation{RuleDriver, fmt.Sprintf("task %s uses driver %q, which is not allowed", name, task.Driver)})
+	}
+	if r.DenyPrivileged && task.Driver == "docker" {
+		if privileged, _ := task.Config["privileged"].(bool); privileged {
+			violations = append(violations, Violation{RulePrivileged, fmt.Sprintf("task %s runs a privileged container", name)})
+		}
+	}
+	if r.RequireResources {
+		res := task.Resources
+		if res == nil || (res.CPU == nil && res.Cores == nil) || res.MemoryMB == nil {
+			violations = append(violations, Violation{RuleResources, fmt.Sprintf("task %s must set cpu and memory", name)})
+		}
+	}
+	return violations
+}
+
+func taskName(group *api.TaskGroup, task *api.Task) string {
+	if group.Name == nil {
+		return task.Name
+	}
+	return *group.Name + "." + task.Name
+}
@@ -0,0 +1,67 @@
+package jobpolicy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func testJob() *api.Job {
+	job := api.NewServiceJob("web", "web", "global", 50)
+	job.Datacenters = []string{"dc1"}
+	job.Meta = map[string]string{"team": "platform"}
+	task := api.NewTask("server", "docker")
+	task.Config = map[string]interface{}{"image": "nginx"}
+	task.Resources = &api.Resources{CPU: intPtr(100), MemoryMB: intPtr(128)}
+	job.AddTaskGroup(api.NewTaskGroup("web", 1).AddTask(task))
+	return job
+}
+
+func intPtr(v int) *int { return &v }
+
+func TestCheckAllowsCompliantJob(t *testing.T) {
+	rules := Rules{
+		DenyPrivileged:     true,
+		RequireResources:   true,
+		AllowedDrivers:     []string{"docker"},
+		AllowedDatacenters: []string{"dc1"},
+		RequiredMeta:       []string{"team"},
+	}
+	if violations := Check(testJob(), rules); len(violations) != 0 {
+		t.Fatalf("expected no violations, got %v", violations)
+	}
+	if err := Error(nil); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+}
+
+func TestCheckReportsViolations(t *testing.T) {
+	job := testJob()
+	job.Datacenters = []string{"dc2"}
+	task := job.TaskGroups[0].Tasks[0]
+	task.Config["privileged"] = true
+	task.Resources = nil
+	exec := api.NewTask("sidecar", "raw_exec")
+	exec.Resources = &api.Resources{Cores: intPtr(1), MemoryMB: intPtr(64)}
+	job.TaskGroups[0].AddTask(exec)
+
+	global := Rules{DenyPrivileged: true, AllowedDrivers: []string{"docker", "exec"}}
+	repo := Rules{RequireResources: true, AllowedDatacenters: []string{"dc1"}, RequiredMeta: []string{"owner"}}
+	violations := Check(job, global, repo)
+
+	rules := make(map[string]int)
+	for _, v := range violations {
+		rules[v.Rule]++
+	}
+	want := map[string]int{RulePrivileged: 1, RuleDriver: 1, RuleResources: 1, RuleDatacenter: 1, RuleMeta: 1}
+	for rule, count := range want {
+		if rules[rule] != count {
+			t.Fatalf("expected %d %s violations, got %v", count, rule, violations)
+		}
+	}
+	err := Error(violations)
+	if err == nil || !strings.Contains(err.Error(), "web.server runs a privileged container") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
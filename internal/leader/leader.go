@@ -0,0 +1,193 @@
+// Package leader elects one compass instance to reconcile when several share
+// a database. The leader holds a lease and renews it; followers poll the same
+// lease and take over once it expires.
+package leader
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// leaseName is the lease contended for by every instance.
+const leaseName = "reconciler"
+
+// LeaseStore keeps the lease instances contend for. Acquire returns the lease
+// as it stands afterwards, so the caller holds it when Holder matches.
+type LeaseStore interface {
+	Acquire(ctx context.Context, name, holder string, ttl time.Duration) (*storage.Lease, error)
+	Release(ctx context.Context, name, holder string) error
+}
+
+// Elector campaigns for the reconciler lease and runs the leader's work while
+// it holds it.
+type Elector struct {
+	leases LeaseStore
+	id     string
+	ttl    time.Duration
+	logger *slog.Logger
+
+	leading atomic.Bool
+	// validUntil is when, in Unix nanoseconds, this instance stops counting
+	// itself leader unless it renews the lease first.
+	validUntil atomic.Int64
+	mu         sync.Mutex
+	leader     string
+}
+
+// NewElector constructs an elector campaigning as id. A lease lasts ttl and is
+// renewed every third of it.
+func NewElector(leases LeaseStore, id string, ttl time.Duration, logger *slog.Logger) *Elector {
+	return &Elector{leases: leases, id: id, ttl: ttl, logger: logger}
+}
+
+// ID returns the name this instance campaigns under.
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// IsLeader reports whether this instance holds the lease. It turns false a
+// third of the TTL before the lease could expire, even if Run has not yet
+// noticed that renewals are failing, so writes fenced on it stop before
+// another instance can take over.
+func (e *Elector) IsLeader() bool {
+	return e.leading.Load() && time.Now().UnixNano() < e.validUntil.Load()
+}
+
+// Leader returns the holder of the lease when it was last checked, or an
+// empty string if nobody held it.
+func (e *Elector) Leader() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Run campaigns until ctx is cancelled. Each time this instance becomes
+// leader, lead is started with a context that is cancelled when leadership is
+// lost; Run waits for it to return before campaigning again. The leader steps
+// down once a third of the TTL remains on its last renewal, leaving that long
+// for its work to stop before a follower may take over. The lease is released
+// on the way out so a follower can take over straight away.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) error {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	var (
+		current *term
+		renewed time.Time
+	)
+	stepDown := func() {
+		if current == nil {
+			return
+		}
+		e.leading.Store(false)
+		current.end()
+		current = nil
+	}
+	defer func() {
+		wasLeader := current != nil
+		stepDown()
+		if wasLeader {
+			releaseCtx, cancelRelease := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancelRelease()
+			if err := e.leases.Release(releaseCtx, leaseName, e.id); err != nil {
+				e.logger.Warn("release leader lease failed", "error", err)
+			}
+		}
+	}()
+
+	for {
+		// Count the lease from before the request, since the store may
+		// have granted it at any point while the request was in flight.
+		attempt := time.Now()
+		acquireCtx, cancelAcquire := context.WithTimeout(ctx, e.ttl/3)
+		lease, err := e.leases.Acquire(acquireCtx, leaseName, e.id, e.ttl)
+		cancelAcquire()
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			e.logger.Error("renew leader lease failed", "error", err)
+			// Another instance may take over once our lease runs out, so
+			// stop leading while there is still time to wind down.
+			if current != nil && time.Since(renewed) >= e.grace() {
+				e.logger.Warn("lost leadership", "id", e.id, "reason", "lease expired")
+				stepDown()
+			}
+		case lease.Holder == e.id:
+			renewed = attempt
+			e.validUntil.Store(renewed.Add(e.grace()).UnixNano())
+			e.setLeader(lease.Holder)
+			if current == nil {
+				e.logger.Info("became leader", "id", e.id)
+				e.leading.Store(true)
+				current = startTerm(ctx, lead)
+			}
+		default:
+			e.setLeader(lease.Holder)
+			if current != nil {
+				e.logger.Warn("lost leadership", "id", e.id, "leader", lease.Holder)
+				stepDown()
+			}
+		}
+
+		// Renewals may keep failing, so stop leading when the grace runs
+		// out rather than at the next tick, which could be too late.
+		var expiry *time.Timer
+		var expired <-chan time.Time
+		if current != nil {
+			expiry = time.NewTimer(time.Until(renewed.Add(e.grace())))
+			expired = expiry.C
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-expired:
+			e.logger.Warn("lost leadership", "id", e.id, "reason", "lease not renewed")
+			stepDown()
+		}
+		if expiry != nil {
+			expiry.Stop()
+		}
+	}
+}
+
+// grace is how long after a renewal this instance keeps leading without
+// another one.
+func (e *Elector) grace() time.Duration {
+	return e.ttl - e.ttl/3
+}
+
+func (e *Elector) setLeader(holder string) {
+	e.mu.Lock()
+	e.leader = holder
+	e.mu.Unlock()
+}
+
+// term is one stretch of leadership.
+type term struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func startTerm(ctx context.Context, lead func(ctx context.Context)) *term {
+	ctx, cancel := context.WithCancel(ctx)
+	t := &term{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		lead(ctx)
+	}()
+	return t
+}
+
+// end cancels the term and waits for the leader's work to stop.
+func (t *term) end() {
+	t.cancel()
+	<-t.done
+}
@@ -0,0 +1,173 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func newLeaseStore(t *testing.T) *storage.LeaseStore {
+	t.Helper()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := storage.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	return storage.NewLeaseStore(db)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestElectorHandsOverOnShutdown(t *testing.T) {
+	leases := newLeaseStore(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	const ttl = 150 * time.Millisecond
+
+	a := NewElector(leases, "a", ttl, logger)
+	aCtx, stopA := context.WithCancel(context.Background())
+	aLeading := make(chan context.Context, 1)
+	aDone := make(chan struct{})
+	go func() {
+		defer close(aDone)
+		_ = a.Run(aCtx, func(ctx context.Context) {
+			aLeading <- ctx
+			<-ctx.Done()
+		})
+	}()
+	var leadCtx context.Context
+	select {
+	case leadCtx = <-aLeading:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a never became leader")
+	}
+	if !a.IsLeader() || a.Leader() != "a" {
+		t.Fatalf("expected a to lead, got leading=%v leader=%q", a.IsLeader(), a.Leader())
+	}
+
+	b := NewElector(leases, "b", ttl, logger)
+	bCtx, stopB := context.WithCancel(context.Background())
+	defer stopB()
+	bLeading := make(chan struct{})
+	go func() {
+		_ = b.Run(bCtx, func(ctx context.Context) {
+			close(bLeading)
+			<-ctx.Done()
+		})
+	}()
+	waitFor(t, "b to see a as leader", func() bool { return b.Leader() == "a" })
+	if b.IsLeader() {
+		t.Fatal("expected b to follow while a holds the lease")
+	}
+
+	stopA()
+	<-aDone
+	if leadCtx.Err() == nil {
+		t.Fatal("expected a's leader context to be cancelled")
+	}
+	if a.IsLeader() {
+		t.Fatal("expected a to step down")
+	}
+	select {
+	case <-bLeading:
+	case <-time.After(5 * time.Second):
+		t.Fatal("b never took over")
+	}
+	if !b.IsLeader() {
+		t.Fatal("expected b to lead")
+	}
+}
+
+func TestElectorTakesOverExpiredLease(t *testing.T) {
+	leases := newLeaseStore(t)
+	ctx := context.Background()
+	// A leader that crashed leaves its lease behind until it expires.
+	if _, err := leases.Acquire(ctx, leaseName, "crashed", 100*time.Millisecond); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	e := NewElector(leases, "b", 60*time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go func() { _ = e.Run(runCtx, func(ctx context.Context) { <-ctx.Done() }) }()
+
+	waitFor(t, "b to see the stale leader", func() bool { return e.Leader() == "crashed" })
+	waitFor(t, "b to take over", e.IsLeader)
+}
+
+// flakyLeases fails every request once broken is set, as a lease store does
+// when it becomes unreachable. It records when the last renewal that went
+// through was sent.
+type flakyLeases struct {
+	LeaseStore
+	broken  atomic.Bool
+	renewed atomic.Int64
+}
+
+func (f *flakyLeases) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (*storage.Lease, error) {
+	if f.broken.Load() {
+		return nil, errors.New("lease store unreachable")
+	}
+	sent := time.Now()
+	lease, err := f.LeaseStore.Acquire(ctx, name, holder, ttl)
+	if err == nil {
+		f.renewed.Store(sent.UnixNano())
+	}
+	return lease, err
+}
+
+func TestElectorStepsDownBeforeLeaseExpires(t *testing.T) {
+	leases := &flakyLeases{LeaseStore: newLeaseStore(t)}
+	const ttl = 300 * time.Millisecond
+
+	e := NewElector(leases, "a", ttl, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	leading := make(chan context.Context, 1)
+	go func() {
+		_ = e.Run(runCtx, func(ctx context.Context) {
+			leading <- ctx
+			<-ctx.Done()
+		})
+	}()
+	var leadCtx context.Context
+	select {
+	case leadCtx = <-leading:
+	case <-time.After(5 * time.Second):
+		t.Fatal("never became leader")
+	}
+
+	leases.broken.Store(true)
+	select {
+	case <-leadCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("leader never stepped down")
+	}
+	// The leader's work has stopped; a follower could take over once the
+	// last renewal expires, which must not have happened yet.
+	expires := time.Unix(0, leases.renewed.Load()).Add(ttl)
+	if time.Now().After(expires) {
+		t.Fatal("leader stepped down after its lease could have expired")
+	}
+	if e.IsLeader() {
+		t.Fatal("expected IsLeader to report false after stepping down")
+	}
+}
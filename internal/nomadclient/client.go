@@ -6,24 +6,35 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/nomad/api"
 
 	"github.com/brianmichel/nomad-compass/internal/config"
+	"github.com/brianmichel/nomad-compass/internal/tracing"
 )
 
-// Client defines the operations Nomad Compass uses.
+// Client defines the operations Nomad Compass uses. Calls that take a job use
+// its namespace; calls that take a job ID take the namespace explicitly. An
+// empty namespace means the client's configured namespace.
 type Client interface {
 	RegisterJob(ctx context.Context, job *api.Job, submission *api.JobSubmission) error
-	DeregisterJob(ctx context.Context, jobID string, purge bool) error
+	DeregisterJob(ctx context.Context, namespace, jobID string, purge bool) error
 	Ping(ctx context.Context) error
-	JobStatus(ctx context.Context, jobID string) (*JobStatus, error)
+	JobStatus(ctx context.Context, namespace, jobID string) (*JobStatus, error)
 	PlanJob(ctx context.Context, job *api.Job) (*api.JobPlanResponse, error)
+	ListJobs(ctx context.Context) ([]JobStub, error)
+	JobVersion(ctx context.Context, namespace, jobID string) (uint64, error)
+	LatestDeployment(ctx context.Context, namespace, jobID string) (*Deployment, error)
+	RevertToStable(ctx context.Context, namespace, jobID string, failedVersion uint64) (uint64, bool, error)
 }
 
 // API wraps the Nomad API client.
 type API struct {
 	client *api.Client
+	// cluster and namespace label the job status metrics.
+	cluster   string
+	namespace string
 }
 
 // JobStatus captures a subset of Nomad job health details.
@@ -48,6 +59,34 @@ type JobStatus struct {
 	LatestAllocationID   string
 	LatestAllocationName string
 	Allocations          []AllocationStatus
+	Meta                 map[string]string
+}
+
+// JobStub is the listing view of a Nomad job, including its meta.
+type JobStub struct {
+	ID        string
+	Name      string
+	Namespace string
+	Type      string
+	Status    string
+	Meta      map[string]string
+}
+
+// Deployment summarises a Nomad deployment.
+type Deployment struct {
+	ID                string
+	JobVersion        uint64
+	Status            string
+	StatusDescription string
+}
+
+// Terminal reports whether the deployment has finished.
+func (d *Deployment) Terminal() bool {
+	switch d.Status {
+	case api.DeploymentStatusSuccessful, api.DeploymentStatusFailed, api.DeploymentStatusCancelled:
+		return true
+	}
+	return false
 }
 
 // AllocationStatus captures summary information for an allocation.
@@ -61,13 +100,49 @@ type AllocationStatus struct {
 	Healthy *bool  `json:"healthy,omitempty"`
 }
 
+// ClusterConfig describes how to reach a Nomad cluster. Certificates and the
+// client key are PEM encoded.
+type ClusterConfig struct {
+	// Name labels the cluster's metrics.
+	Name          string
+	Address       string
+	Token         string
+	Region        string
+	Namespace     string
+	CACert        string
+	ClientCert    string
+	ClientKey     string
+	TLSServerName string
+	TLSSkipVerify bool
+}
+
 // New constructs a Nomad API wrapper from config.
 func New(cfg config.NomadConfig) (*API, error) {
+	return NewCluster(ClusterConfig{
+		Name:      "default",
+		Address:   cfg.Address,
+		Token:     cfg.Token,
+		Region:    cfg.Region,
+		Namespace: cfg.Namespace,
+	})
+}
+
+// NewCluster constructs a Nomad API wrapper for a cluster.
+func NewCluster(cfg ClusterConfig) (*API, error) {
 	apiCfg := api.DefaultConfig()
 	apiCfg.Address = cfg.Address
 	if cfg.Token != "" {
 		apiCfg.SecretID = cfg.Token
 	}
+	if cfg.CACert != "" || cfg.ClientCert != "" || cfg.TLSServerName != "" || cfg.TLSSkipVerify {
+		apiCfg.TLSConfig = &api.TLSConfig{
+			CACertPEM:     []byte(cfg.CACert),
+			ClientCertPEM: []byte(cfg.ClientCert),
+			ClientKeyPEM:  []byte(cfg.ClientKey),
+			TLSServerName: cfg.TLSServerName,
+			Insecure:      cfg.TLSSkipVerify,
+		}
+	}
 	client, err := api.NewClient(apiCfg)
 	if err != nil {
 		return nil, err
@@ -78,29 +153,39 @@ func New(cfg config.NomadConfig) (*API, error) {
 	if cfg.Region != "" {
 		client.SetRegion(cfg.Region)
 	}
-	return &API{client: client}, nil
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	return &API{client: client, cluster: cfg.Name, namespace: namespace}, nil
 }
 
 // RegisterJob submits a Nomad job specification.
-func (a *API) RegisterJob(ctx context.Context, job *api.Job, submission *api.JobSubmission) error {
+func (a *API) RegisterJob(ctx context.Context, job *api.Job, submission *api.JobSubmission) (err error) {
+	defer observe("register_job", time.Now(), &err)
+	_, span := startJobSpan(ctx, "nomad register job", job)
+	defer func() { tracing.Fail(span, err); span.End() }()
 	// The Nomad client does not expose context-aware calls for Register, so we rely on API client internals.
 	var opts *api.RegisterOptions
 	if submission != nil {
 		opts = &api.RegisterOptions{Submission: submission}
 	}
-	_, _, err := a.client.Jobs().RegisterOpts(job, opts, nil)
+	_, _, err = a.client.Jobs().RegisterOpts(job, opts, writeOptions(jobNamespace(job)))
 	return err
 }
 
 // PlanJob computes the diff for a Nomad job without submitting it.
-func (a *API) PlanJob(ctx context.Context, job *api.Job) (*api.JobPlanResponse, error) {
+func (a *API) PlanJob(ctx context.Context, job *api.Job) (_ *api.JobPlanResponse, err error) {
+	defer observe("plan_job", time.Now(), &err)
+	_, span := startJobSpan(ctx, "nomad plan job", job)
+	defer func() { tracing.Fail(span, err); span.End() }()
 	if job == nil {
 		return nil, errors.New("job is required")
 	}
 	if job.ID == nil || *job.ID == "" {
 		return nil, errors.New("job ID is required for planning")
 	}
-	resp, _, err := a.client.Jobs().Plan(job, true, nil)
+	resp, _, err := a.client.Jobs().Plan(job, true, writeOptions(jobNamespace(job)))
 	if err != nil {
 		return nil, err
 	}
@@ -108,26 +193,135 @@ func (a *API) PlanJob(ctx context.Context, job *api.Job) (*api.JobPlanResponse,
 }
 
 // DeregisterJob removes a Nomad job by ID.
-func (a *API) DeregisterJob(ctx context.Context, jobID string, purge bool) error {
-	_, _, err := a.client.Jobs().Deregister(jobID, purge, nil)
-	return err
+func (a *API) DeregisterJob(ctx context.Context, namespace, jobID string, purge bool) (err error) {
+	defer observe("deregister_job", time.Now(), &err)
+	if _, _, err = a.client.Jobs().Deregister(jobID, purge, writeOptions(namespace)); err != nil {
+		return err
+	}
+	forgetJobStatus(a.cluster, a.metricNamespace(namespace), jobID)
+	return nil
+}
+
+// ListJobs returns every job visible to the client in any namespace, with job
+// meta.
+func (a *API) ListJobs(ctx context.Context) (_ []JobStub, err error) {
+	defer observe("list_jobs", time.Now(), &err)
+	stubs, _, err := a.client.Jobs().ListOptions(&api.JobListOptions{Fields: &api.JobListFields{Meta: true}}, queryOptions(api.AllNamespacesNamespace))
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]JobStub, 0, len(stubs))
+	for _, stub := range stubs {
+		if stub == nil {
+			continue
+		}
+		jobs = append(jobs, JobStub{
+			ID:        stub.ID,
+			Name:      stub.Name,
+			Namespace: stub.Namespace,
+			Type:      strings.ToLower(stub.Type),
+			Status:    strings.ToLower(stub.Status),
+			Meta:      stub.Meta,
+		})
+	}
+	return jobs, nil
+}
+
+// JobVersion returns the current version of a registered job.
+func (a *API) JobVersion(ctx context.Context, namespace, jobID string) (_ uint64, err error) {
+	defer observe("job_version", time.Now(), &err)
+	job, _, err := a.client.Jobs().Info(jobID, queryOptions(namespace))
+	if err != nil {
+		return 0, err
+	}
+	if job == nil || job.Version == nil {
+		return 0, errors.New("job version unavailable")
+	}
+	return *job.Version, nil
+}
+
+// LatestDeployment returns the most recent deployment for a job, or nil when
+// the job has none.
+func (a *API) LatestDeployment(ctx context.Context, namespace, jobID string) (_ *Deployment, err error) {
+	defer observe("latest_deployment", time.Now(), &err)
+	deployment, _, err := a.client.Jobs().LatestDeployment(jobID, queryOptions(namespace))
+	if err != nil {
+		return nil, err
+	}
+	if deployment == nil {
+		return nil, nil
+	}
+	return &Deployment{
+		ID:                deployment.ID,
+		JobVersion:        deployment.JobVersion,
+		Status:            strings.ToLower(deployment.Status),
+		StatusDescription: deployment.StatusDescription,
+	}, nil
+}
+
+// RevertToStable reverts a job to the newest stable version older than
+// failedVersion. It reports false when no such version exists.
+func (a *API) RevertToStable(ctx context.Context, namespace, jobID string, failedVersion uint64) (_ uint64, _ bool, err error) {
+	defer observe("revert_job", time.Now(), &err)
+	versions, _, _, err := a.client.Jobs().Versions(jobID, false, queryOptions(namespace))
+	if err != nil {
+		return 0, false, err
+	}
+	var target *api.Job
+	for _, version := range versions {
+		if version == nil || version.Version == nil || version.Stable == nil || !*version.Stable || *version.Version >= failedVersion {
+			continue
+		}
+		if target == nil || *version.Version > *target.Version {
+			target = version
+		}
+	}
+	if target == nil {
+		return 0, false, nil
+	}
+	// Only revert if nothing has been registered since the failed version.
+	if _, _, err := a.client.Jobs().Revert(jobID, *target.Version, &failedVersion, writeOptions(namespace), "", ""); err != nil {
+		return 0, false, err
+	}
+	return *target.Version, true, nil
 }
 
 // Ping verifies connectivity with the Nomad control plane.
-func (a *API) Ping(ctx context.Context) error {
+func (a *API) Ping(ctx context.Context) (err error) {
+	defer observe("ping", time.Now(), &err)
 	// The Nomad client does not expose context-aware calls for status checks.
 	// The request is best-effort; we ignore the returned leader string.
-	_, err := a.client.Status().Leader()
+	_, err = a.client.Status().Leader()
 	return err
 }
 
 // JobStatus fetches the current status for a Nomad job by ID.
-func (a *API) JobStatus(ctx context.Context, jobID string) (*JobStatus, error) {
+func (a *API) JobStatus(ctx context.Context, namespace, jobID string) (*JobStatus, error) {
+	start := time.Now()
+	status, err := a.jobStatus(namespace, jobID)
+	observe("job_status", start, &err)
+	if err == nil && status != nil {
+		recordJobStatus(a.cluster, a.metricNamespace(namespace), status)
+	}
+	return status, err
+}
+
+// metricNamespace returns the namespace a call in namespace addresses: the
+// client's own when it is empty.
+func (a *API) metricNamespace(namespace string) string {
+	if namespace == "" {
+		return a.namespace
+	}
+	return namespace
+}
+
+func (a *API) jobStatus(namespace, jobID string) (*JobStatus, error) {
 	if jobID == "" {
 		return nil, nil
 	}
 
-	job, _, err := a.client.Jobs().Info(jobID, nil)
+	q := queryOptions(namespace)
+	job, _, err := a.client.Jobs().Info(jobID, q)
 	if err != nil {
 		var unexpected api.UnexpectedResponseError
 		if errors.As(err, &unexpected) && unexpected.StatusCode() == http.StatusNotFound {
@@ -159,9 +353,10 @@ func (a *API) JobStatus(ctx context.Context, jobID string) (*JobStatus, error) {
 		Exists:            true,
 		DerivedStatus:     strings.ToLower(derefString(job.Status, nil)),
 		DesiredAllocs:     desiredFromGroups,
+		Meta:              job.Meta,
 	}
 
-	if statusSummaries, _, err := a.client.Jobs().Summary(status.ID, nil); err == nil && statusSummaries != nil && statusSummaries.Summary != nil {
+	if statusSummaries, _, err := a.client.Jobs().Summary(status.ID, q); err == nil && statusSummaries != nil && statusSummaries.Summary != nil {
 		var desired, running, starting, queued, failed, lost, unknown int
 		for _, grp := range statusSummaries.Summary {
 			running += grp.Running
@@ -184,14 +379,14 @@ func (a *API) JobStatus(ctx context.Context, jobID string) (*JobStatus, error) {
 		status.DerivedStatus, status.DerivedStatusReason = deriveStatus(status)
 	}
 
-	if deployment, _, err := a.client.Jobs().LatestDeployment(status.ID, nil); err == nil && deployment != nil {
+	if deployment, _, err := a.client.Jobs().LatestDeployment(status.ID, q); err == nil && deployment != nil {
 		status.LatestDeploymentID = deployment.ID
 		if status.DerivedStatus == "" {
 			status.DerivedStatus, status.DerivedStatusReason = deriveStatusFromDeployment(status, deployment.Status)
 		}
 	}
 
-	if allocs, _, err := a.client.Jobs().Allocations(status.ID, true, nil); err == nil && len(allocs) > 0 {
+	if allocs, _, err := a.client.Jobs().Allocations(status.ID, true, q); err == nil && len(allocs) > 0 {
 		status.Allocations = make([]AllocationStatus, 0, len(allocs))
 		for _, alloc := range allocs {
 			if alloc == nil {
@@ -222,6 +417,27 @@ func (a *API) JobStatus(ctx context.Context, jobID string) (*JobStatus, error) {
 	return status, nil
 }
 
+func jobNamespace(job *api.Job) string {
+	if job == nil || job.Namespace == nil {
+		return ""
+	}
+	return *job.Namespace
+}
+
+func queryOptions(namespace string) *api.QueryOptions {
+	if namespace == "" {
+		return nil
+	}
+	return &api.QueryOptions{Namespace: namespace}
+}
+
+func writeOptions(namespace string) *api.WriteOptions {
+	if namespace == "" {
+		return nil
+	}
+	return &api.WriteOptions{Namespace: namespace}
+}
+
 func derefString(primary *string, fallback *string) string {
 	if primary != nil && *primary != "" {
 		return *primary
@@ -0,0 +1,119 @@
+package nomadclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// leaseHolderItem is the variable item naming the instance that holds a
+// lease.
+const leaseHolderItem = "holder"
+
+// VariableLeases keeps leases as locks on Nomad variables. Nomad replicates
+// them between its servers, so a lease outlives the node its holder ran on.
+type VariableLeases struct {
+	variables *api.Variables
+	prefix    string
+
+	mu sync.Mutex
+	// locks holds the Nomad lock ID of each lease this instance holds.
+	locks map[string]string
+}
+
+// Leases returns leases kept as locks on the variables under prefix, in the
+// client's namespace.
+func (a *API) Leases(prefix string) *VariableLeases {
+	return &VariableLeases{variables: a.client.Variables(), prefix: prefix, locks: make(map[string]string)}
+}
+
+// Acquire takes or renews the named lease for holder. Nomad only lets another
+// holder take it once the lock has gone unrenewed for ttl and its lock delay.
+// It returns the lease as it stands afterwards, so the caller holds it when
+// Holder matches.
+func (l *VariableLeases) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (*storage.Lease, error) {
+	variable := l.variable(name)
+	opts := (&api.WriteOptions{}).WithContext(ctx)
+
+	l.mu.Lock()
+	lockID := l.locks[name]
+	l.mu.Unlock()
+	if lockID != "" {
+		variable.Lock = &api.VariableLock{ID: lockID}
+		_, _, err := l.variables.RenewLock(variable, opts)
+		switch {
+		case err == nil:
+			return &storage.Lease{Name: name, Holder: holder, ExpiresAt: storage.Now().Add(ttl)}, nil
+		case !lockConflict(err):
+			return nil, err
+		}
+		// The lock expired and may have passed to another holder.
+		l.forget(name)
+	}
+
+	variable.Items = api.VariableItems{leaseHolderItem: holder}
+	variable.Lock = &api.VariableLock{TTL: ttl.String()}
+	acquired, _, err := l.variables.AcquireLock(variable, opts)
+	switch {
+	case err == nil:
+		l.mu.Lock()
+		l.locks[name] = acquired.LockID()
+		l.mu.Unlock()
+		return &storage.Lease{Name: name, Holder: holder, ExpiresAt: storage.Now().Add(ttl)}, nil
+	case !lockConflict(err):
+		return nil, err
+	}
+
+	current, _, err := l.variables.Peek(variable.Path, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	lease := &storage.Lease{Name: name}
+	if current != nil {
+		lease.Holder = current.Items[leaseHolderItem]
+	}
+	return lease, nil
+}
+
+// Release gives up the named lease if holder still has it, letting another
+// instance take it without waiting for it to expire.
+func (l *VariableLeases) Release(ctx context.Context, name, holder string) error {
+	l.mu.Lock()
+	lockID := l.locks[name]
+	l.mu.Unlock()
+	if lockID == "" {
+		return nil
+	}
+	variable := l.variable(name)
+	variable.Lock = &api.VariableLock{ID: lockID}
+	_, _, err := l.variables.ReleaseLock(variable, (&api.WriteOptions{}).WithContext(ctx))
+	l.forget(name)
+	if err != nil && !lockConflict(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *VariableLeases) variable(name string) *api.Variable {
+	return &api.Variable{Path: path.Join(l.prefix, name)}
+}
+
+func (l *VariableLeases) forget(name string) {
+	l.mu.Lock()
+	delete(l.locks, name)
+	l.mu.Unlock()
+}
+
+// lockConflict reports whether err is Nomad refusing a lock operation
+// because another holder has the lock.
+func lockConflict(err error) bool {
+	var resp api.UnexpectedResponseError
+	return errors.As(err, &resp) && resp.StatusCode() == http.StatusConflict
+}
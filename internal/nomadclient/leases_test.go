@@ -0,0 +1,139 @@
+package nomadclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/config"
+)
+
+// fakeVariableLocks serves the variable lock endpoints for one Nomad
+// namespace, keeping each variable's holder and lock ID.
+type fakeVariableLocks struct {
+	mu      sync.Mutex
+	nextID  int
+	holders map[string]string
+	locks   map[string]string
+}
+
+func (f *fakeVariableLocks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("X-Nomad-Index", "1")
+	w.Header().Set("X-Nomad-LastContact", "0")
+	w.Header().Set("X-Nomad-KnownLeader", "true")
+
+	varPath := strings.TrimPrefix(r.URL.Path, "/v1/var/")
+	if r.Method == http.MethodGet {
+		holder, ok := f.holders[varPath]
+		if !ok {
+			http.Error(w, "variable not found", http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(api.Variable{Path: varPath, Items: api.VariableItems{leaseHolderItem: holder}})
+		return
+	}
+
+	var in api.Variable
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	current := f.locks[varPath]
+	switch {
+	case r.URL.Query().Has("lock-acquire"):
+		if current != "" {
+			http.Error(w, "variable already locked", http.StatusConflict)
+			return
+		}
+		f.nextID++
+		current = fmt.Sprintf("lock-%d", f.nextID)
+		f.locks[varPath] = current
+		f.holders[varPath] = in.Items[leaseHolderItem]
+		_ = json.NewEncoder(w).Encode(api.Variable{Path: varPath, Items: in.Items, Lock: &api.VariableLock{ID: current}})
+	case r.URL.Query().Has("lock-renew"), r.URL.Query().Has("lock-release"):
+		if current == "" || in.Lock == nil || in.Lock.ID != current {
+			http.Error(w, "lock not held", http.StatusConflict)
+			return
+		}
+		if r.URL.Query().Has("lock-release") {
+			delete(f.locks, varPath)
+		}
+		_ = json.NewEncoder(w).Encode(api.Variable{Path: varPath})
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+// expire drops the lock on varPath, as Nomad does once it goes unrenewed.
+func (f *fakeVariableLocks) expire(varPath string) {
+	f.mu.Lock()
+	delete(f.locks, varPath)
+	f.mu.Unlock()
+}
+
+func newLeases(t *testing.T, addr string) *VariableLeases {
+	t.Helper()
+	client, err := New(config.NomadConfig{Address: addr})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return client.Leases("nomad-compass/leader")
+}
+
+func TestVariableLeases(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeVariableLocks{holders: make(map[string]string), locks: make(map[string]string)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	a, b := newLeases(t, srv.URL), newLeases(t, srv.URL)
+	const ttl = 15 * time.Second
+
+	acquire := func(l *VariableLeases, holder string) string {
+		t.Helper()
+		lease, err := l.Acquire(ctx, "reconciler", holder, ttl)
+		if err != nil {
+			t.Fatalf("%s acquire: %v", holder, err)
+		}
+		return lease.Holder
+	}
+
+	if got := acquire(a, "a"); got != "a" {
+		t.Fatalf("expected a to take the free lease, got %q", got)
+	}
+	if got := acquire(b, "b"); got != "a" {
+		t.Fatalf("expected b to see a holding the lease, got %q", got)
+	}
+	if got := acquire(a, "a"); got != "a" {
+		t.Fatalf("expected a to renew its lease, got %q", got)
+	}
+
+	// Once a's lock lapses, b takes it and a learns it lost the lease.
+	fake.expire("nomad-compass/leader/reconciler")
+	if got := acquire(b, "b"); got != "b" {
+		t.Fatalf("expected b to take the expired lease, got %q", got)
+	}
+	if got := acquire(a, "a"); got != "b" {
+		t.Fatalf("expected a to see b holding the lease, got %q", got)
+	}
+
+	// Releasing a lease this instance lost leaves the new holder's lock.
+	if err := a.Release(ctx, "reconciler", "a"); err != nil {
+		t.Fatalf("a release: %v", err)
+	}
+	if err := b.Release(ctx, "reconciler", "b"); err != nil {
+		t.Fatalf("b release: %v", err)
+	}
+	if got := acquire(a, "a"); got != "a" {
+		t.Fatalf("expected a to take the released lease, got %q", got)
+	}
+}
@@ -0,0 +1,90 @@
+package nomadclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/brianmichel/nomad-compass/internal/tracing"
+)
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "nomad_compass_nomad_request_duration_seconds",
+		Help: "Latency of Nomad API calls by operation.",
+	}, []string{"operation", "outcome"})
+	jobStatusGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nomad_compass_job_status",
+		Help: "Derived status of each job last checked; the current status has value 1.",
+	}, []string{"cluster", "namespace", "job", "status"})
+
+	// lastStatus remembers each job's reported status so the previous series
+	// can be removed when it changes.
+	lastStatusMu sync.Mutex
+	lastStatus   = make(map[jobStatusKey]string)
+)
+
+// jobStatusKey identifies a job across clusters.
+type jobStatusKey struct {
+	cluster, namespace, job string
+}
+
+var tracer = otel.Tracer("github.com/brianmichel/nomad-compass/internal/nomadclient")
+
+// startJobSpan starts a span for a call about job.
+func startJobSpan(ctx context.Context, name string, job *api.Job) (context.Context, trace.Span) {
+	var attrs []attribute.KeyValue
+	if job != nil {
+		if job.ID != nil {
+			attrs = append(attrs, tracing.JobID.String(*job.ID))
+		}
+		if ns := jobNamespace(job); ns != "" {
+			attrs = append(attrs, tracing.Namespace.String(ns))
+		}
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...), trace.WithSpanKind(trace.SpanKindClient))
+}
+
+func observe(operation string, start time.Time, err *error) {
+	outcome := "success"
+	if *err != nil {
+		outcome = "error"
+	}
+	requestDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+// recordJobStatus publishes the derived status of a job in cluster. Jobs
+// missing from Nomad are dropped.
+func recordJobStatus(cluster, namespace string, status *JobStatus) {
+	if status.Namespace != "" {
+		namespace = status.Namespace
+	}
+	key := jobStatusKey{cluster, namespace, status.ID}
+
+	lastStatusMu.Lock()
+	defer lastStatusMu.Unlock()
+	if previous, ok := lastStatus[key]; ok {
+		if status.Exists && previous == status.DerivedStatus {
+			return
+		}
+		jobStatusGauge.DeleteLabelValues(cluster, namespace, status.ID, previous)
+		delete(lastStatus, key)
+	}
+	if !status.Exists {
+		return
+	}
+	jobStatusGauge.WithLabelValues(cluster, namespace, status.ID, status.DerivedStatus).Set(1)
+	lastStatus[key] = status.DerivedStatus
+}
+
+// forgetJobStatus drops the status series of a job that was deregistered.
+func forgetJobStatus(cluster, namespace, jobID string) {
+	recordJobStatus(cluster, namespace, &JobStatus{ID: jobID, Exists: false})
+}
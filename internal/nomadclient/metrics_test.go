@@ -0,0 +1,28 @@
+package nomadclient
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecordJobStatusKeepsOneSeriesPerJob(t *testing.T) {
+	series := func() int { return testutil.CollectAndCount(jobStatusGauge) }
+	before := series()
+
+	recordJobStatus("east", "apps", &JobStatus{ID: "metrics-api", Exists: true, DerivedStatus: "deploying"})
+	recordJobStatus("east", "apps", &JobStatus{ID: "metrics-api", Exists: true, DerivedStatus: "running"})
+	recordJobStatus("west", "apps", &JobStatus{ID: "metrics-api", Exists: true, DerivedStatus: "running"})
+	if got := series(); got != before+2 {
+		t.Fatalf("expected one series per cluster, got %d new", got-before)
+	}
+	if got := testutil.ToFloat64(jobStatusGauge.WithLabelValues("east", "apps", "metrics-api", "running")); got != 1 {
+		t.Fatalf("expected running status on east, got %v", got)
+	}
+
+	recordJobStatus("east", "apps", &JobStatus{ID: "metrics-api", Exists: false})
+	forgetJobStatus("west", "apps", "metrics-api")
+	if got := series(); got != before {
+		t.Fatalf("expected dropped jobs to leave no series, got %d left", got-before)
+	}
+}
@@ -0,0 +1,118 @@
+package nomadclient
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// DefaultCluster identifies the cluster configured through the environment.
+const DefaultCluster int64 = 0
+
+// Target is a Nomad cluster compass deploys to.
+type Target struct {
+	Client Client
+	// Address is the cluster's HTTP address, used to link to its UI.
+	Address string
+	// Namespace is where jobs that do not declare one are registered.
+	Namespace string
+}
+
+// DefaultNamespace returns the target's namespace, or Nomad's default when
+// none is configured.
+func (t Target) DefaultNamespace() string {
+	if t.Namespace != "" {
+		return t.Namespace
+	}
+	return api.DefaultNamespace
+}
+
+// Pool hands out a target per cluster, building each one on first use.
+type Pool struct {
+	fallback Target
+	build    func(ctx context.Context, clusterID int64) (Target, error)
+
+	mu      sync.Mutex
+	targets map[int64]Target
+}
+
+// NewPool constructs a pool around the default cluster. build creates the
+// target for a stored cluster; it may be nil when only the default exists.
+func NewPool(fallback Target, build func(ctx context.Context, clusterID int64) (Target, error)) *Pool {
+	return &Pool{fallback: fallback, build: build, targets: make(map[int64]Target)}
+}
+
+// Default returns the target for the default cluster.
+func (p *Pool) Default() Target {
+	return p.fallback
+}
+
+// Target returns the target for clusterID.
+func (p *Pool) Target(ctx context.Context, clusterID int64) (Target, error) {
+	if clusterID == DefaultCluster || p.build == nil {
+		return p.fallback, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if target, ok := p.targets[clusterID]; ok {
+		return target, nil
+	}
+	target, err := p.build(ctx, clusterID)
+	if err != nil {
+		return Target{}, err
+	}
+	p.targets[clusterID] = target
+	return target, nil
+}
+
+// Forget drops the cached target for clusterID so it is rebuilt on next use.
+func (p *Pool) Forget(clusterID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.targets, clusterID)
+}
+
+// Unavailable returns a client whose calls all fail with err, for a cluster
+// that could not be reached or configured.
+func Unavailable(err error) Client {
+	return unavailable{err: err}
+}
+
+type unavailable struct{ err error }
+
+func (u unavailable) RegisterJob(context.Context, *api.Job, *api.JobSubmission) error {
+	return u.err
+}
+
+func (u unavailable) DeregisterJob(context.Context, string, string, bool) error {
+	return u.err
+}
+
+func (u unavailable) Ping(context.Context) error {
+	return u.err
+}
+
+func (u unavailable) JobStatus(context.Context, string, string) (*JobStatus, error) {
+	return nil, u.err
+}
+
+func (u unavailable) PlanJob(context.Context, *api.Job) (*api.JobPlanResponse, error) {
+	return nil, u.err
+}
+
+func (u unavailable) ListJobs(context.Context) ([]JobStub, error) {
+	return nil, u.err
+}
+
+func (u unavailable) JobVersion(context.Context, string, string) (uint64, error) {
+	return 0, u.err
+}
+
+func (u unavailable) LatestDeployment(context.Context, string, string) (*Deployment, error) {
+	return nil, u.err
+}
+
+func (u unavailable) RevertToStable(context.Context, string, string, uint64) (uint64, bool, error) {
+	return 0, false, u.err
+}
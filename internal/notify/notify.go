@@ -0,0 +1,199 @@
+// Package notify delivers reconcile events to the notification channels
+// stored in the database.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// EventType names something reconciliation did.
+type EventType string
+
+const (
+	// EventJobApplied is sent when a job is registered for a new commit.
+	EventJobApplied EventType = "job_applied"
+	// EventApplyFailed is sent when a job fails to apply or deploy.
+	EventApplyFailed EventType = "apply_failed"
+	// EventDriftCorrected is sent when a job is re-registered because Nomad
+	// no longer matched the repository.
+	EventDriftCorrected EventType = "drift_corrected"
+	// EventJobRemoved is sent when a job is deregistered.
+	EventJobRemoved EventType = "job_removed"
+	// EventSyncFailed is sent when a reconcile pass fails as a whole.
+	EventSyncFailed EventType = "sync_failed"
+)
+
+// ValidEvent reports whether t is a known event type.
+func ValidEvent(t string) bool {
+	switch EventType(t) {
+	case EventJobApplied, EventApplyFailed, EventDriftCorrected, EventJobRemoved, EventSyncFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Event describes one thing reconciliation did.
+type Event struct {
+	Type    EventType `json:"type"`
+	RepoID  int64     `json:"repo_id"`
+	Repo    string    `json:"repo"`
+	Commit  string    `json:"commit,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	JobID   string    `json:"job_id,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Text renders the event as a single line for chat and email.
+func (e Event) Text() string {
+	subject := e.Repo
+	if e.JobID != "" {
+		subject += " job " + e.JobID
+	} else if e.Path != "" {
+		subject += " " + e.Path
+	}
+	text := fmt.Sprintf("[%s] %s", e.Type, subject)
+	if e.Commit != "" {
+		text += " at " + shortCommit(e.Commit)
+	}
+	if e.Message != "" {
+		text += ": " + e.Message
+	}
+	return text
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
+
+type channelStore interface {
+	List(ctx context.Context) ([]storage.NotificationChannel, error)
+	DecryptSettings(c *storage.NotificationChannel) (*storage.NotificationSettings, error)
+}
+
+const (
+	queueSize       = 256
+	defaultAttempts = 3
+	defaultBackoff  = 2 * time.Second
+)
+
+// Dispatcher delivers events to matching channels in the background,
+// retrying failed deliveries.
+type Dispatcher struct {
+	channels channelStore
+	logger   *slog.Logger
+	queue    chan Event
+
+	http     *http.Client
+	sendMail func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error
+	attempts int
+	backoff  time.Duration
+
+	wg sync.WaitGroup
+}
+
+// NewDispatcher constructs a dispatcher. Call Run to start delivering.
+func NewDispatcher(channels channelStore, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		channels: channels,
+		logger:   logger,
+		queue:    make(chan Event, queueSize),
+		http:     &http.Client{Timeout: 10 * time.Second},
+		sendMail: sendMail,
+		attempts: defaultAttempts,
+		backoff:  defaultBackoff,
+	}
+}
+
+// Notify queues an event. It never blocks; events are dropped with a warning
+// when the queue is full.
+func (d *Dispatcher) Notify(event Event) {
+	if event.Time.IsZero() {
+		event.Time = storage.Now()
+	}
+	select {
+	case d.queue <- event:
+	default:
+		d.logger.Warn("notification queue full, dropping event", "type", event.Type, "repo", event.Repo)
+	}
+}
+
+// Run delivers queued events until ctx is cancelled, then waits for
+// in-flight deliveries to finish.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	defer d.wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-d.queue:
+			d.dispatch(ctx, event)
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, event Event) {
+	channels, err := d.channels.List(ctx)
+	if err != nil {
+		d.logger.Error("list notification channels failed", "error", err)
+		return
+	}
+	for _, channel := range channels {
+		if !matches(channel, event) {
+			continue
+		}
+		settings, err := d.channels.DecryptSettings(&channel)
+		if err != nil {
+			d.logger.Error("decrypt notification settings failed", "channel", channel.Name, "error", err)
+			continue
+		}
+		d.wg.Add(1)
+		go func(channel storage.NotificationChannel) {
+			defer d.wg.Done()
+			d.deliver(ctx, channel, settings, event)
+		}(channel)
+	}
+}
+
+// deliver sends event to one channel, backing off between attempts.
+func (d *Dispatcher) deliver(ctx context.Context, channel storage.NotificationChannel, settings *storage.NotificationSettings, event Event) {
+	backoff := d.backoff
+	for attempt := 1; ; attempt++ {
+		err := d.send(ctx, channel.Kind, settings, event)
+		if err == nil {
+			return
+		}
+		if attempt >= d.attempts {
+			d.logger.Error("notification failed", "channel", channel.Name, "type", event.Type, "repo", event.Repo, "attempts", attempt, "error", err)
+			return
+		}
+		d.logger.Warn("notification attempt failed", "channel", channel.Name, "type", event.Type, "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// matches reports whether channel wants event.
+func matches(channel storage.NotificationChannel, event Event) bool {
+	if channel.RepoID.Valid && channel.RepoID.Int64 != event.RepoID {
+		return false
+	}
+	return len(channel.Events) == 0 || slices.Contains(channel.Events, string(event.Type))
+}
@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+type fakeChannels struct {
+	channels []storage.NotificationChannel
+	settings map[int64]storage.NotificationSettings
+}
+
+func (f *fakeChannels) List(ctx context.Context) ([]storage.NotificationChannel, error) {
+	return f.channels, nil
+}
+
+func (f *fakeChannels) DecryptSettings(c *storage.NotificationChannel) (*storage.NotificationSettings, error) {
+	settings := f.settings[c.ID]
+	return &settings, nil
+}
+
+func TestDispatcherDeliversToMatchingChannelsWithRetries(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		webhook  Event
+		slack    map[string]string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/webhook":
+			attempts++
+			if attempts == 1 {
+				http.Error(w, "try again", http.StatusServiceUnavailable)
+				return
+			}
+			_ = json.NewDecoder(r.Body).Decode(&webhook)
+		case "/slack":
+			_ = json.NewDecoder(r.Body).Decode(&slack)
+		case "/other":
+			t.Errorf("channel for another repository received an event")
+		}
+	}))
+	defer srv.Close()
+
+	channels := &fakeChannels{
+		channels: []storage.NotificationChannel{
+			{ID: 1, Name: "hook", Kind: storage.NotificationKindWebhook},
+			{ID: 2, Name: "chat", Kind: storage.NotificationKindSlack, Events: []string{string(EventApplyFailed)}, RepoID: sql.NullInt64{Int64: 7, Valid: true}},
+			{ID: 3, Name: "other", Kind: storage.NotificationKindWebhook, RepoID: sql.NullInt64{Int64: 8, Valid: true}},
+			{ID: 4, Name: "drift-only", Kind: storage.NotificationKindWebhook, Events: []string{string(EventDriftCorrected)}},
+		},
+		settings: map[int64]storage.NotificationSettings{
+			1: {URL: srv.URL + "/webhook"},
+			2: {URL: srv.URL + "/slack"},
+			3: {URL: srv.URL + "/other"},
+			4: {URL: srv.URL + "/other"},
+		},
+	}
+	d := NewDispatcher(channels, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	d.backoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.dispatch(ctx, Event{Type: EventApplyFailed, RepoID: 7, Repo: "demo", JobID: "api", Commit: "0123456789abcdef", Message: "boom"})
+	d.wg.Wait()
+	cancel()
+
+	if attempts != 2 {
+		t.Fatalf("expected webhook to be retried once, got %d attempts", attempts)
+	}
+	if webhook.Type != EventApplyFailed || webhook.JobID != "api" {
+		t.Fatalf("unexpected webhook payload %+v", webhook)
+	}
+	if slack["text"] != "[apply_failed] demo job api at 01234567: boom" {
+		t.Fatalf("unexpected slack text %q", slack["text"])
+	}
+}
+
+func TestDispatcherSendsEmail(t *testing.T) {
+	d := NewDispatcher(&fakeChannels{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var (
+		gotAddr string
+		gotTo   []string
+		gotMsg  string
+	)
+	d.sendMail = func(_ context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotTo, gotMsg = addr, to, string(msg)
+		return nil
+	}
+	err := d.send(context.Background(), storage.NotificationKindEmail, &storage.NotificationSettings{
+		SMTPHost: "mail.example.com",
+		From:     "compass@example.com",
+		To:       []string{"ops@example.com"},
+	}, Event{Type: EventSyncFailed, Repo: "demo\r\nBcc: x@example.com", Message: "clone failed"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if gotAddr != "mail.example.com:587" || len(gotTo) != 1 {
+		t.Fatalf("unexpected envelope %s %v", gotAddr, gotTo)
+	}
+	headers, _, _ := strings.Cut(gotMsg, "\r\n\r\n")
+	if strings.Contains(headers, "\r\nBcc:") {
+		t.Fatalf("repository name injected a header: %q", gotMsg)
+	}
+	if !strings.Contains(gotMsg, "clone failed") {
+		t.Fatalf("expected message body, got %q", gotMsg)
+	}
+}
+
+func TestSendMailGivesUpWhenContextEnds(t *testing.T) {
+	// A server that accepts connections but never greets the client.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = sendMail(ctx, ln.Addr().String(), nil, "compass@example.com", []string{"ops@example.com"}, []byte("hi"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("send took %s", elapsed)
+	}
+}
@@ -0,0 +1,175 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+const (
+	defaultSMTPPort = 587
+	// smtpTimeout bounds a whole email delivery, like the HTTP client's
+	// timeout does for webhooks.
+	smtpTimeout = 10 * time.Second
+)
+
+// headerSafe keeps values interpolated into mail headers on one line.
+var headerSafe = strings.NewReplacer("\r", " ", "\n", " ")
+
+func (d *Dispatcher) send(ctx context.Context, kind storage.NotificationKind, settings *storage.NotificationSettings, event Event) error {
+	switch kind {
+	case storage.NotificationKindWebhook:
+		return d.postJSON(ctx, settings.URL, event)
+	case storage.NotificationKindSlack:
+		return d.postJSON(ctx, settings.URL, map[string]string{"text": event.Text()})
+	case storage.NotificationKindEmail:
+		return d.sendEmail(ctx, settings, event)
+	default:
+		return fmt.Errorf("unknown notification kind %q", kind)
+	}
+}
+
+func (d *Dispatcher) postJSON(ctx context.Context, url string, payload any) error {
+	if url == "" {
+		return errors.New("channel has no url")
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("post notification: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (d *Dispatcher) sendEmail(ctx context.Context, settings *storage.NotificationSettings, event Event) error {
+	if settings.SMTPHost == "" || settings.From == "" || len(settings.To) == 0 {
+		return errors.New("email channel needs smtp_host, from and to")
+	}
+	port := settings.SMTPPort
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	var auth smtp.Auth
+	if settings.Username != "" {
+		auth = smtp.PlainAuth("", settings.Username, settings.Password, settings.SMTPHost)
+	}
+	return d.sendMail(ctx, net.JoinHostPort(settings.SMTPHost, strconv.Itoa(port)), auth, settings.From, settings.To, emailMessage(settings, event))
+}
+
+// sendMail delivers msg the way smtp.SendMail does, but gives up once ctx is
+// done or smtpTimeout passes instead of waiting on the server forever.
+func sendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) (err error) {
+	for _, line := range append([]string{from}, to...) {
+		if strings.ContainsAny(line, "\r\n") {
+			return errors.New("smtp: address contains CR or LF")
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	defer func() {
+		if err == nil {
+			return
+		}
+		switch {
+		case ctx.Err() != nil:
+			err = ctx.Err()
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			// The socket deadline is ctx's, and can fire just before ctx
+			// notices it has passed.
+			if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+				err = context.DeadlineExceeded
+			}
+		}
+	}()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	// Closing the connection unblocks a conversation when ctx is cancelled.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := client.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func emailMessage(settings *storage.NotificationSettings, event Event) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", settings.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(settings.To, ", "))
+	fmt.Fprintf(&b, "Subject: nomad-compass: %s in %s\r\n", event.Type, headerSafe.Replace(event.Repo))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(event.Text())
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
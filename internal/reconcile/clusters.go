@@ -0,0 +1,77 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// ErrClusterInUse is returned when deleting a cluster that repositories
+// still deploy to.
+var ErrClusterInUse = errors.New("cluster is used by repositories")
+
+// defaultTarget returns the cluster configured through the environment.
+func (m *Manager) defaultTarget() nomadclient.Target {
+	return m.fence(nomadclient.Target{Client: m.nomad, Namespace: m.namespace})
+}
+
+// clusterTarget returns the cluster repoRecord deploys to.
+func (m *Manager) clusterTarget(ctx context.Context, repoRecord *storage.Repository) (nomadclient.Target, error) {
+	if repoRecord == nil || !repoRecord.ClusterID.Valid {
+		return m.defaultTarget(), nil
+	}
+	return m.targetByID(ctx, repoRecord.ClusterID.Int64)
+}
+
+// targetByID returns the target for a stored cluster, or the default cluster
+// for nomadclient.DefaultCluster.
+func (m *Manager) targetByID(ctx context.Context, clusterID int64) (nomadclient.Target, error) {
+	if clusterID == nomadclient.DefaultCluster || m.targets == nil {
+		return m.defaultTarget(), nil
+	}
+	target, err := m.targets.Target(ctx, clusterID)
+	if err != nil {
+		return nomadclient.Target{}, fmt.Errorf("nomad cluster %d: %w", clusterID, err)
+	}
+	return m.fence(target), nil
+}
+
+// target is clusterTarget for callers that surface errors through Nomad
+// calls: a cluster that cannot be resolved yields a client whose calls fail.
+func (m *Manager) target(ctx context.Context, repoRecord *storage.Repository) nomadclient.Target {
+	target, err := m.clusterTarget(ctx, repoRecord)
+	if err != nil {
+		return nomadclient.Target{Client: nomadclient.Unavailable(err), Namespace: m.namespace}
+	}
+	return target
+}
+
+// clusterID returns the cluster repoRecord deploys to.
+func clusterID(repoRecord *storage.Repository) int64 {
+	if repoRecord == nil || !repoRecord.ClusterID.Valid {
+		return nomadclient.DefaultCluster
+	}
+	return repoRecord.ClusterID.Int64
+}
+
+// DeleteCluster removes a stored cluster. Clusters that repositories still
+// deploy to cannot be removed.
+func (m *Manager) DeleteCluster(ctx context.Context, id int64) error {
+	repos, err := m.repos.ListByCluster(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(repos) > 0 {
+		return ErrClusterInUse
+	}
+	if err := m.clusters.Delete(ctx, id); err != nil {
+		return err
+	}
+	if m.targets != nil {
+		m.targets.Forget(id)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package reconcile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	repomodel "github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func TestEnsureJobsUsesRepositoryCluster(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	local := &fakeNomad{}
+	west := &fakeNomad{}
+	fileStore := storage.NewRepoFileStore(db)
+	m := &Manager{
+		files: fileStore,
+		nomad: local,
+		targets: nomadclient.NewPool(nomadclient.Target{Client: local}, func(ctx context.Context, id int64) (nomadclient.Target, error) {
+			if id != 7 {
+				return nomadclient.Target{}, errors.New("unknown cluster")
+			}
+			return nomadclient.Target{Client: west, Namespace: "apps"}, nil
+		}),
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	repoRecord := &storage.Repository{ID: 1, Name: "demo", ClusterID: sql.NullInt64{Int64: 7, Valid: true}}
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "new",
+		JobFiles: []repomodel.JobFile{{Path: ".nomad/api.nomad.hcl", Content: []byte(`job "api" {
+  datacenters = ["dc1"]
+}`)}},
+	}
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	if local.registerCalls != 0 || west.registerCalls != 1 {
+		t.Fatalf("expected job registered on the repository's cluster, got local=%d west=%d", local.registerCalls, west.registerCalls)
+	}
+	files, err := fileStore.ListByRepo(ctx, 1)
+	if err != nil {
+		t.Fatalf("list repo files: %v", err)
+	}
+	if len(files) != 1 || files[0].Namespace.String != "apps" {
+		t.Fatalf("expected cluster namespace tracked, got %+v", files)
+	}
+
+	repoRecord.ClusterID.Int64 = 8
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err == nil {
+		t.Fatal("expected an unknown cluster to fail the sync")
+	}
+}
@@ -0,0 +1,177 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+const (
+	// deploymentGrace is how long to wait for Nomad to create a deployment
+	// before assuming the registration does not produce one.
+	deploymentGrace = 30 * time.Second
+	// deploymentRecheck is the longest a repository waits for its next pass
+	// while deployments are in progress.
+	deploymentRecheck = 15 * time.Second
+)
+
+// AcknowledgeRepo clears a failed deployment so that held changes are applied
+// again, and queues the repository for reconciliation.
+func (m *Manager) AcknowledgeRepo(ctx context.Context, repoID int64) error {
+	repoRecord, err := m.repos.Get(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	if repoRecord == nil {
+		return errors.New("repository not found")
+	}
+	if err := m.repos.ClearUnhealthy(ctx, repoID); err != nil {
+		return err
+	}
+	return m.TriggerRepo(ctx, repoID)
+}
+
+// deployState is what a pass found out about a deployment compass watches.
+type deployState int
+
+const (
+	// deployPending means the deployment is still running.
+	deployPending deployState = iota + 1
+	// deployDone means the deployment succeeded, or the registration did not
+	// create one.
+	deployDone
+	// deployFailed means the deployment failed or did not finish in time.
+	deployFailed
+)
+
+// followsDeployments reports whether job creates deployments compass should
+// wait on. Batch and system jobs never do.
+func (m *Manager) followsDeployments(job *api.Job) bool {
+	if m.deployTimeout <= 0 || job == nil {
+		return false
+	}
+	if job.Type == nil {
+		return true
+	}
+	switch *job.Type {
+	case api.JobTypeBatch, api.JobTypeSysbatch, api.JobTypeSystem:
+		return false
+	default:
+		return true
+	}
+}
+
+// watchDeployment records the version of job just registered from path so
+// that later passes can follow its deployment without blocking this one. It
+// reports whether there is a deployment to wait on.
+func (m *Manager) watchDeployment(ctx context.Context, repoRecord *storage.Repository, path string, job *api.Job, commit string) bool {
+	if !m.followsDeployments(job) {
+		return false
+	}
+	target := m.target(ctx, repoRecord)
+	id := jobID(job)
+	version, err := target.Client.JobVersion(ctx, jobNamespace(target, job), id)
+	if err != nil {
+		m.logger.Warn("job version lookup failed; not following deployment", "repo", repoRecord.Name, "job_id", id, "error", err)
+		return false
+	}
+	if err := m.files.WatchDeployment(ctx, repoRecord.ID, path, version, commit); err != nil {
+		m.logger.Warn("record deployment watch failed", "repo", repoRecord.Name, "job_id", id, "error", err)
+		return false
+	}
+	return true
+}
+
+// checkDeployments looks once at every deployment the repository is waiting
+// on and returns the state of each by file path.
+func (m *Manager) checkDeployments(ctx context.Context, report *reconcileReport, repoRecord *storage.Repository, files []storage.RepoFile) map[string]deployState {
+	states := make(map[string]deployState)
+	for _, file := range files {
+		if !file.DeployVersion.Valid || !file.JobID.Valid {
+			continue
+		}
+		state := m.checkDeployment(ctx, report, repoRecord, file)
+		if state != deployPending {
+			if err := m.files.ClearDeployment(ctx, repoRecord.ID, file.Path); err != nil {
+				m.logger.Warn("clear deployment watch failed", "repo", repoRecord.Name, "file", file.Path, "error", err)
+			}
+		}
+		states[file.Path] = state
+	}
+	return states
+}
+
+// checkDeployment looks up the deployment of the watched version of file's
+// job. A deployment that failed, or that has not finished within the
+// deployment timeout, marks the repository unhealthy and, if configured,
+// reverts the job to its last stable version.
+func (m *Manager) checkDeployment(ctx context.Context, report *reconcileReport, repoRecord *storage.Repository, file storage.RepoFile) deployState {
+	target := m.target(ctx, repoRecord)
+	id := file.JobID.String
+	namespace := fileNamespace(target, file)
+	version := uint64(file.DeployVersion.Int64)
+	elapsed := time.Since(file.DeployStartedAt.Time)
+
+	deployment, err := target.Client.LatestDeployment(ctx, namespace, id)
+	if err != nil {
+		m.logger.Warn("deployment lookup failed", "repo", repoRecord.Name, "job_id", id, "error", err)
+		deployment = nil
+	} else if deployment != nil && deployment.JobVersion != version {
+		deployment = nil
+	}
+
+	var reason string
+	switch {
+	case deployment != nil && deployment.Status == api.DeploymentStatusSuccessful:
+		report.add(file.Path, id, storage.JobActionHealthy, storage.JobPhaseDeploy, "deployment "+shortID(deployment.ID)+" succeeded")
+		return deployDone
+	case deployment != nil && deployment.Terminal():
+		reason = fmt.Sprintf("deployment %s %s", shortID(deployment.ID), deployment.Status)
+		if deployment.StatusDescription != "" {
+			reason += ": " + deployment.StatusDescription
+		}
+	case deployment == nil && err == nil && elapsed >= m.deployGrace:
+		// Nomad did not create a deployment for this version.
+		return deployDone
+	case elapsed >= m.deployTimeout:
+		reason = fmt.Sprintf("deployment did not finish within %s", m.deployTimeout)
+	default:
+		report.DeploysPending = true
+		return deployPending
+	}
+
+	commit := file.DeployCommit.String
+	m.logger.Error("job deployment unhealthy", "repo", repoRecord.Name, "job_id", id, "commit", commit, "reason", reason)
+	report.add(file.Path, id, storage.JobActionUnhealthy, storage.JobPhaseDeploy, reason)
+	if err := m.repos.MarkUnhealthy(ctx, repoRecord.ID, commit, id+": "+reason); err != nil {
+		m.logger.Warn("mark repository unhealthy failed", "repo", repoRecord.Name, "error", err)
+	}
+
+	// A deployment that is still running when we stop waiting may yet
+	// succeed, so only revert ones Nomad has given up on.
+	if repoRecord.AutoRevert && deployment != nil && deployment.Terminal() {
+		reverted, ok, err := target.Client.RevertToStable(ctx, namespace, id, version)
+		switch {
+		case err != nil:
+			m.logger.Error("job revert failed", "repo", repoRecord.Name, "job_id", id, "error", err)
+			report.failed(file.Path, id, storage.JobPhaseDeploy, fmt.Errorf("revert: %w", err))
+		case !ok:
+			m.logger.Warn("no stable version to revert to", "repo", repoRecord.Name, "job_id", id)
+		default:
+			report.add(file.Path, id, storage.JobActionReverted, storage.JobPhaseDeploy, fmt.Sprintf("reverted to version %d", reverted))
+		}
+	}
+	return deployFailed
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
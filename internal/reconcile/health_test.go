@@ -0,0 +1,231 @@
+package reconcile
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	repomodel "github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func newHealthTestManager(t *testing.T, fake *fakeNomad) (*Manager, *storage.Repository) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	repoStore := storage.NewRepoStore(db, nil)
+	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{
+		Name:       "demo",
+		RepoURL:    "https://example.com/demo.git",
+		Branch:     "main",
+		AutoRevert: true,
+	})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+
+	m := &Manager{
+		repos:         repoStore,
+		files:         storage.NewRepoFileStore(db),
+		pending:       storage.NewPendingChangeStore(db),
+		nomad:         fake,
+		logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		deployTimeout: time.Second,
+		deployGrace:   10 * time.Millisecond,
+	}
+	return m, repoRecord
+}
+
+func healthTestSnapshot() *repomodel.Snapshot {
+	return &repomodel.Snapshot{
+		CommitHash: "new",
+		JobFiles: []repomodel.JobFile{
+			{Path: ".nomad/api.nomad.hcl", Content: []byte(`job "api" { datacenters = ["dc1"] }`)},
+			{Path: ".nomad/web.nomad.hcl", Content: []byte(`job "web" {
+  datacenters = ["dc1"]
+  meta = { "nomad-compass/wave" = "1" }
+}`)},
+		},
+	}
+}
+
+func TestEnsureJobsWaitsForDeploymentBeforeNextWave(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeNomad{jobVersion: 3}
+	m, repoRecord := newHealthTestManager(t, fake)
+
+	report, err := m.ensureJobs(ctx, repoRecord, healthTestSnapshot(), true)
+	if err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	if fake.registerCalls != 1 {
+		t.Fatalf("expected only the first wave registered, got %d", fake.registerCalls)
+	}
+	if !report.DeploysPending {
+		t.Fatal("expected the pass to report a pending deployment")
+	}
+	if got := report.count(storage.JobActionSkipped); got != 1 {
+		t.Fatalf("expected later wave skipped, got %d skipped events", got)
+	}
+
+	files, err := m.files.ListByRepo(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("list files: %v", err)
+	}
+	var watched int
+	for _, file := range files {
+		if file.DeployVersion.Valid {
+			watched++
+			if file.Path != ".nomad/api.nomad.hcl" || file.DeployVersion.Int64 != 3 || file.DeployCommit.String != "new" {
+				t.Fatalf("unexpected deployment watch %+v", file)
+			}
+		}
+	}
+	if watched != 1 {
+		t.Fatalf("expected 1 deployment watched, got %d", watched)
+	}
+}
+
+func TestEnsureJobsRevertsFailedDeploymentAndStopsLaterWaves(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeNomad{jobVersion: 3}
+	m, repoRecord := newHealthTestManager(t, fake)
+
+	if _, err := m.ensureJobs(ctx, repoRecord, healthTestSnapshot(), true); err != nil {
+		t.Fatalf("first pass: %v", err)
+	}
+	fake.deployments = map[string]*nomadclient.Deployment{
+		"api": {ID: "deploy-api", JobVersion: 3, Status: api.DeploymentStatusFailed, StatusDescription: "Failed due to unhealthy allocations"},
+	}
+	report, err := m.ensureJobs(ctx, repoRecord, healthTestSnapshot(), false)
+	if err != nil {
+		t.Fatalf("second pass: %v", err)
+	}
+
+	if fake.registerCalls != 1 {
+		t.Fatalf("expected only the first job registered, got %d", fake.registerCalls)
+	}
+	if len(fake.reverted) != 1 || fake.reverted[0] != "api" {
+		t.Fatalf("expected api reverted, got %v", fake.reverted)
+	}
+	if got := report.count(storage.JobActionUnhealthy); got != 1 {
+		t.Fatalf("expected 1 unhealthy event, got %d", got)
+	}
+	if got := report.count(storage.JobActionReverted); got != 1 {
+		t.Fatalf("expected 1 reverted event, got %d", got)
+	}
+	if got := report.count(storage.JobActionSkipped); got != 1 {
+		t.Fatalf("expected later wave skipped, got %d skipped events", got)
+	}
+	if report.DeploysPending {
+		t.Fatal("expected no deployments left pending")
+	}
+
+	stored, err := m.repos.Get(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("get repo: %v", err)
+	}
+	if !stored.UnhealthyCommit.Valid || stored.UnhealthyCommit.String != "new" {
+		t.Fatalf("expected repo marked unhealthy at commit new, got %+v", stored.UnhealthyCommit)
+	}
+}
+
+func TestEnsureJobsStartsNextWaveAfterHealthyDeployment(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeNomad{jobVersion: 1}
+	m, repoRecord := newHealthTestManager(t, fake)
+
+	if _, err := m.ensureJobs(ctx, repoRecord, healthTestSnapshot(), true); err != nil {
+		t.Fatalf("first pass: %v", err)
+	}
+	fake.deployments = map[string]*nomadclient.Deployment{
+		"api": {ID: "deploy-api", JobVersion: 1, Status: api.DeploymentStatusSuccessful},
+	}
+	report, err := m.ensureJobs(ctx, repoRecord, healthTestSnapshot(), false)
+	if err != nil {
+		t.Fatalf("second pass: %v", err)
+	}
+	if fake.registerCalls != 2 {
+		t.Fatalf("expected both jobs registered, got %d", fake.registerCalls)
+	}
+	if got := report.count(storage.JobActionHealthy); got != 1 {
+		t.Fatalf("expected 1 healthy event, got %d", got)
+	}
+	if !report.DeploysPending {
+		t.Fatal("expected the second wave's deployment pending")
+	}
+	if len(fake.reverted) != 0 {
+		t.Fatalf("expected no reverts, got %v", fake.reverted)
+	}
+
+	stored, err := m.repos.Get(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("get repo: %v", err)
+	}
+	if stored.UnhealthyCommit.Valid {
+		t.Fatalf("expected repo to stay healthy, got %+v", stored.UnhealthyCommit)
+	}
+}
+
+func TestEnsureJobsDoesNotWaitOnSystemJobs(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeNomad{jobVersion: 1}
+	m, repoRecord := newHealthTestManager(t, fake)
+	snapshot := healthTestSnapshot()
+	snapshot.JobFiles[0].Content = []byte(`job "api" {
+  datacenters = ["dc1"]
+  type        = "system"
+}`)
+
+	report, err := m.ensureJobs(ctx, repoRecord, snapshot, true)
+	if err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	if fake.registerCalls != 2 {
+		t.Fatalf("expected both waves registered, got %d", fake.registerCalls)
+	}
+	if got := report.count(storage.JobActionSkipped); got != 0 {
+		t.Fatalf("expected no skipped jobs, got %d", got)
+	}
+}
+
+func TestAcknowledgeRepoQueuesReconcile(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeNomad{}
+	m, repoRecord := newHealthTestManager(t, fake)
+	m.queue = newWorkQueue()
+	if err := m.repos.MarkUnhealthy(ctx, repoRecord.ID, "new", "deployment failed"); err != nil {
+		t.Fatalf("mark unhealthy: %v", err)
+	}
+
+	if err := m.AcknowledgeRepo(ctx, repoRecord.ID); err != nil {
+		t.Fatalf("acknowledge: %v", err)
+	}
+	stored, err := m.repos.Get(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("get repo: %v", err)
+	}
+	if stored.UnhealthyCommit.Valid {
+		t.Fatalf("expected the failure acknowledged, got %+v", stored.UnhealthyCommit)
+	}
+	if got := m.queue.len(); got != 1 {
+		t.Fatalf("expected the repo queued, got %d", got)
+	}
+	if fake.registerCalls != 0 {
+		t.Fatalf("expected no reconcile on the caller's goroutine, got %d registers", fake.registerCalls)
+	}
+}
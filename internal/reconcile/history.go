@@ -0,0 +1,223 @@
+package reconcile
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// reconcileReport collects per-job outcomes for a single reconciliation pass so
+// they can be persisted to the history tables once the pass completes.
+type reconcileReport struct {
+	Events    []storage.JobEvent
+	Pending   []storage.PendingChange
+	Conflicts []storage.JobConflict
+	// DeploysPending is set when a deployment was still running at the end
+	// of the pass.
+	DeploysPending bool
+	// PreviousErrors holds the failure stored for each file before the pass,
+	// so failures that repeat every pass can be told from new ones.
+	PreviousErrors map[string]storage.FileError
+}
+
+func (r *reconcileReport) add(path, jobID, action, phase, summary string) {
+	r.Events = append(r.Events, storage.JobEvent{
+		Path:    path,
+		JobID:   nullString(jobID),
+		Action:  action,
+		Phase:   nullString(phase),
+		Summary: summary,
+	})
+}
+
+func (r *reconcileReport) failed(path, jobID, phase string, err error) {
+	event := storage.JobEvent{
+		Path:   path,
+		JobID:  nullString(jobID),
+		Action: storage.JobActionFailed,
+		Phase:  nullString(phase),
+	}
+	if err != nil {
+		event.Error = nullString(err.Error())
+	}
+	r.Events = append(r.Events, event)
+}
+
+// fileErrors returns the last failure recorded for each file.
+func (r *reconcileReport) fileErrors() map[string]storage.FileError {
+	errs := make(map[string]storage.FileError)
+	for _, event := range r.Events {
+		if event.Action != storage.JobActionFailed {
+			continue
+		}
+		errs[event.Path] = storage.FileError{Phase: event.Phase.String, Message: event.Error.String}
+	}
+	return errs
+}
+
+// repeatsFailure reports whether event is the same failure the file already
+// had before the pass.
+func (r *reconcileReport) repeatsFailure(event storage.JobEvent) bool {
+	previous, ok := r.PreviousErrors[event.Path]
+	return ok && previous.Phase == event.Phase.String && previous.Message == event.Error.String
+}
+
+func (r *reconcileReport) count(action string) int {
+	if r == nil {
+		return 0
+	}
+	n := 0
+	for _, event := range r.Events {
+		if event.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// summary renders counts for each action, e.g. "2 applied, 1 unchanged".
+func (r *reconcileReport) summary() string {
+	var parts []string
+	for _, action := range []string{storage.JobActionApplied, storage.JobActionUnchanged, storage.JobActionRemoved, storage.JobActionPending, storage.JobActionDrifted, storage.JobActionHealthy, storage.JobActionUnhealthy, storage.JobActionReverted, storage.JobActionSkipped, storage.JobActionFailed} {
+		if n := r.count(action); n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, action))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (m *Manager) startRun(ctx context.Context, repoRecord *storage.Repository) *storage.ReconcileRun {
+	if m.history == nil {
+		return nil
+	}
+	run, err := m.history.StartRun(ctx, repoRecord.ID)
+	if err != nil {
+		m.logger.Warn("record reconcile run failed", "repo", repoRecord.Name, "error", err)
+		return nil
+	}
+	return run
+}
+
+func (m *Manager) finishRun(ctx context.Context, repoRecord *storage.Repository, run *storage.ReconcileRun, snapshot *repo.Snapshot, report *reconcileReport, runErr error) {
+	if m.history == nil || run == nil {
+		return
+	}
+
+	var commit, ref string
+	if snapshot != nil {
+		commit = snapshot.CommitHash
+		ref = snapshot.Ref
+	}
+
+	if report != nil {
+		for _, event := range report.Events {
+			event.RunID = run.ID
+			event.RepoID = repoRecord.ID
+			event.Commit = nullString(commit)
+			if err := m.history.RecordEvent(ctx, event); err != nil {
+				m.logger.Warn("record job event failed", "repo", repoRecord.Name, "file", event.Path, "error", err)
+			}
+		}
+	}
+
+	run.Commit = nullString(commit)
+	run.Ref = nullString(ref)
+	run.Outcome = runOutcome(report, runErr)
+	run.Summary = report.summary()
+	if runErr != nil {
+		run.Error = nullString(runErr.Error())
+	}
+
+	if err := m.history.FinishRun(ctx, run); err != nil {
+		m.logger.Warn("finish reconcile run failed", "repo", repoRecord.Name, "error", err)
+	}
+}
+
+// runOutcome classifies a pass for its history record.
+func runOutcome(report *reconcileReport, err error) string {
+	switch {
+	case err != nil:
+		return storage.RunOutcomeFailed
+	case report.count(storage.JobActionFailed) > 0, report.count(storage.JobActionUnhealthy) > 0:
+		return storage.RunOutcomePartial
+	default:
+		return storage.RunOutcomeSucceeded
+	}
+}
+
+// abandonRuns closes runs left running by an instance that stopped mid-pass.
+func (m *Manager) abandonRuns(ctx context.Context) {
+	if m.history == nil {
+		return
+	}
+	n, err := m.history.AbandonRunning(ctx)
+	if err != nil {
+		m.logger.Warn("close abandoned runs failed", "error", err)
+		return
+	}
+	if n > 0 {
+		m.logger.Info("closed abandoned reconcile runs", "count", n)
+	}
+}
+
+func (m *Manager) pruneHistory(ctx context.Context) {
+	if m.history == nil || m.retention <= 0 {
+		return
+	}
+	if err := m.history.Prune(ctx, storage.Now().Add(-m.retention)); err != nil {
+		m.logger.Warn("prune history failed", "error", err)
+	}
+}
+
+// planSummary describes the changes Nomad reported for a plan.
+func planSummary(resp *api.JobPlanResponse) string {
+	if resp == nil || resp.Diff == nil {
+		return "job changed"
+	}
+	diff := resp.Diff
+	var parts []string
+	if n := countFieldChanges(diff.Fields); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d job field(s)", n))
+	}
+	if len(diff.Objects) > 0 {
+		parts = append(parts, fmt.Sprintf("%d job object(s)", len(diff.Objects)))
+	}
+	var groups []string
+	for _, tg := range diff.TaskGroups {
+		if taskGroupDiffHasChanges(tg) {
+			groups = append(groups, tg.Name)
+		}
+	}
+	if len(groups) > 0 {
+		parts = append(parts, "task groups "+strings.Join(groups, ", "))
+	}
+	if len(parts) == 0 {
+		return "job changed"
+	}
+	kind := strings.ToLower(diff.Type)
+	if kind == "" {
+		kind = "edited"
+	}
+	return kind + ": " + strings.Join(parts, "; ")
+}
+
+func countFieldChanges(fields []*api.FieldDiff) int {
+	n := 0
+	for _, field := range fields {
+		if field == nil || isCompassCommitMetadataField(field.Name) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
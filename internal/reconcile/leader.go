@@ -0,0 +1,56 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+)
+
+// ErrNotLeader is returned by writes to Nomad once this instance has stopped
+// leading, so a deposed leader cannot undo its successor's work.
+var ErrNotLeader = errors.New("this instance is no longer the leader")
+
+// isLeader reports whether this instance reconciles.
+func (m *Manager) isLeader() bool {
+	return m.leading == nil || m.leading()
+}
+
+// fence makes target's writes check leadership first.
+func (m *Manager) fence(target nomadclient.Target) nomadclient.Target {
+	if m.leading == nil {
+		return target
+	}
+	target.Client = fencedClient{Client: target.Client, leading: m.leading}
+	return target
+}
+
+// fencedClient refuses to change jobs unless this instance leads. Reads pass
+// through, so followers can still plan and report status.
+type fencedClient struct {
+	nomadclient.Client
+	leading func() bool
+}
+
+func (f fencedClient) RegisterJob(ctx context.Context, job *api.Job, submission *api.JobSubmission) error {
+	if !f.leading() {
+		return ErrNotLeader
+	}
+	return f.Client.RegisterJob(ctx, job, submission)
+}
+
+func (f fencedClient) DeregisterJob(ctx context.Context, namespace, jobID string, purge bool) error {
+	if !f.leading() {
+		return ErrNotLeader
+	}
+	return f.Client.DeregisterJob(ctx, namespace, jobID, purge)
+}
+
+func (f fencedClient) RevertToStable(ctx context.Context, namespace, jobID string, failedVersion uint64) (uint64, bool, error) {
+	if !f.leading() {
+		return 0, false, ErrNotLeader
+	}
+	return f.Client.RevertToStable(ctx, namespace, jobID, failedVersion)
+}
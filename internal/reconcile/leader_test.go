@@ -0,0 +1,53 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEnsureJobsStopsOnceDeposed(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeNomad{jobVersion: 1}
+	m, repoRecord := newHealthTestManager(t, fake)
+	var leading atomic.Bool
+	m.leading = leading.Load
+
+	_, err := m.ensureJobs(ctx, repoRecord, healthTestSnapshot(), true)
+	if !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("expected ErrNotLeader, got %v", err)
+	}
+	if fake.registerCalls != 0 {
+		t.Fatalf("expected no registrations from a deposed leader, got %d", fake.registerCalls)
+	}
+
+	leading.Store(true)
+	if _, err := m.ensureJobs(ctx, repoRecord, healthTestSnapshot(), true); err != nil {
+		t.Fatalf("ensure jobs as leader: %v", err)
+	}
+	if fake.registerCalls != 1 {
+		t.Fatalf("expected the leader to register the first wave, got %d", fake.registerCalls)
+	}
+}
+
+func TestTriggerRepoOnFollowerMarksRepoDue(t *testing.T) {
+	ctx := context.Background()
+	m, repoRecord := newHealthTestManager(t, &fakeNomad{})
+	m.queue = newWorkQueue()
+	m.leading = func() bool { return false }
+
+	if err := m.TriggerRepo(ctx, repoRecord.ID); err != nil {
+		t.Fatalf("trigger: %v", err)
+	}
+	if got := m.queue.len(); got != 0 {
+		t.Fatalf("expected nothing queued on a follower, got %d", got)
+	}
+	stored, err := m.repos.Get(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("get repo: %v", err)
+	}
+	if !stored.NextPollAt.Valid {
+		t.Fatal("expected the repo marked due for the leader")
+	}
+}
@@ -2,18 +2,29 @@ package reconcile
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/nomad/api"
 	"github.com/hashicorp/nomad/jobspec2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/brianmichel/nomad-compass/internal/commitstatus"
+	"github.com/brianmichel/nomad-compass/internal/jobpolicy"
 	"github.com/brianmichel/nomad-compass/internal/nomadclient"
 	"github.com/brianmichel/nomad-compass/internal/repo"
 	"github.com/brianmichel/nomad-compass/internal/storage"
+	"github.com/brianmichel/nomad-compass/internal/tracing"
 )
 
+var tracer = otel.Tracer("github.com/brianmichel/nomad-compass/internal/reconcile")
+
 const (
 	compassMetaRepoURL      = "nomad-compass/repo-url"
 	compassMetaRepoName     = "nomad-compass/repo-name"
@@ -21,39 +32,162 @@ const (
 	compassMetaCommit       = "nomad-compass/commit"
 	compassMetaCommitAuthor = "nomad-compass/commit-author"
 	compassMetaCommitTitle  = "nomad-compass/commit-title"
+	compassMetaWave         = "nomad-compass/wave"
+	compassMetaOverlay      = "nomad-compass/overlay"
+)
+
+const (
+	// scheduleTick is how often the scheduler looks for repositories that are
+	// due to be polled.
+	scheduleTick = time.Second
+	// maintenanceInterval is how often expired history is removed and
+	// orphaned jobs are collected.
+	maintenanceInterval = time.Hour
 )
 
 // Manager coordinates reconciliation cycles for onboarded repositories.
 type Manager struct {
-	repos    *storage.RepoStore
-	files    *storage.RepoFileStore
-	creds    *storage.CredentialStore
-	git      *repo.Manager
-	nomad    nomadclient.Client
-	interval time.Duration
-	logger   *slog.Logger
+	repos      *storage.RepoStore
+	files      *storage.RepoFileStore
+	creds      *storage.CredentialStore
+	history    *storage.HistoryStore
+	pending    *storage.PendingChangeStore
+	conflicts  *storage.JobConflictStore
+	clusters   *storage.ClusterStore
+	git        *repo.Manager
+	nomad      nomadclient.Client
+	targets    *nomadclient.Pool
+	interval   time.Duration
+	maxBackoff time.Duration
+	retention  time.Duration
+	workers    int
+	logger     *slog.Logger
+
+	deployTimeout time.Duration
+	deployGrace   time.Duration
+
+	orphanPolicy OrphanPolicy
+	// jobPolicy holds the global rules every job must satisfy.
+	jobPolicy jobpolicy.Rules
+
+	statuses  *commitstatus.Client
+	publicURL string
+	notifier  Notifier
+	// leading reports whether this instance may still write to Nomad. Nil
+	// means it runs alone and always may.
+	leading func() bool
+	// reported remembers the last commit status posted per repository.
+	statusMu sync.Mutex
+	reported map[int64]string
+	// namespace is where jobs that do not declare a namespace are registered.
+	namespace string
+
+	queue *workQueue
+	locks repoLocks
+}
+
+// Options tunes how the manager schedules and maintains reconciliation.
+type Options struct {
+	// Interval is the default poll interval for repositories.
+	Interval time.Duration
+	// MaxBackoff caps the poll delay after repeated failures.
+	MaxBackoff time.Duration
+	// Retention is how long history is kept. Zero keeps it forever.
+	Retention time.Duration
+	// Workers bounds how many repositories reconcile at once.
+	Workers int
+	// OrphanPolicy decides what the periodic orphan scan does.
+	OrphanPolicy OrphanPolicy
+	// DeploymentTimeout is how long to follow the deployment created by a
+	// registration. Zero disables health gating.
+	DeploymentTimeout time.Duration
+	// JobPolicy holds rules every job must satisfy before it is registered,
+	// in addition to each repository's own rules.
+	JobPolicy jobpolicy.Rules
+	// CommitStatus posts outcomes to repositories that configure a status
+	// provider. Nil disables reporting.
+	CommitStatus *commitstatus.Client
+	// PublicURL is compass's external URL, linked from commit statuses.
+	PublicURL string
+	// Notifier receives job and sync events. Nil disables notifications.
+	Notifier Notifier
+	// Leading reports whether this instance still leads. Writes to Nomad
+	// fail with ErrNotLeader once it returns false, and triggers are left for
+	// the leader to pick up. Nil means the instance runs alone.
+	Leading func() bool
 }
 
 // New constructs a reconciliation manager.
-func New(repos *storage.RepoStore, files *storage.RepoFileStore, creds *storage.CredentialStore, git *repo.Manager, nomad nomadclient.Client, interval time.Duration, logger *slog.Logger) *Manager {
-	return &Manager{repos: repos, files: files, creds: creds, git: git, nomad: nomad, interval: interval, logger: logger}
+func New(repos *storage.RepoStore, files *storage.RepoFileStore, creds *storage.CredentialStore, history *storage.HistoryStore, pending *storage.PendingChangeStore, conflicts *storage.JobConflictStore, clusters *storage.ClusterStore, git *repo.Manager, targets *nomadclient.Pool, opts Options, logger *slog.Logger) *Manager {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	return &Manager{
+		repos:         repos,
+		files:         files,
+		creds:         creds,
+		history:       history,
+		pending:       pending,
+		conflicts:     conflicts,
+		clusters:      clusters,
+		git:           git,
+		nomad:         targets.Default().Client,
+		targets:       targets,
+		interval:      opts.Interval,
+		maxBackoff:    opts.MaxBackoff,
+		retention:     opts.Retention,
+		workers:       workers,
+		orphanPolicy:  opts.OrphanPolicy,
+		jobPolicy:     opts.JobPolicy,
+		statuses:      opts.CommitStatus,
+		publicURL:     opts.PublicURL,
+		notifier:      opts.Notifier,
+		leading:       opts.Leading,
+		deployTimeout: opts.DeploymentTimeout,
+		deployGrace:   deploymentGrace,
+		namespace:     targets.Default().Namespace,
+		logger:        logger,
+		queue:         newWorkQueue(),
+	}
 }
 
-// Run executes reconciliation loops until the context is cancelled.
+// Run executes reconciliation loops until the context is cancelled. Due
+// repositories are queued on every scheduler tick, and a pool of workers
+// drains the queue.
 func (m *Manager) Run(ctx context.Context) error {
-	ticker := time.NewTicker(m.interval)
+	// Close runs from a previous leader before workers start new ones.
+	m.abandonRuns(ctx)
+
+	ticker := time.NewTicker(scheduleTick)
 	defer ticker.Stop()
+	maintenance := time.NewTicker(maintenanceInterval)
+	defer maintenance.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < m.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.work(ctx)
+		}()
+	}
+	defer wg.Wait()
 
-	m.logger.Info("reconciler started", "interval", m.interval)
+	m.logger.Info("reconciler started", "interval", m.interval, "max_backoff", m.maxBackoff, "workers", m.workers, "orphan_policy", m.orphanPolicy)
+	m.pruneHistory(ctx)
 
 	for {
+		if err := m.enqueueDue(ctx); err != nil {
+			m.logger.Error("reconciliation cycle failed", "error", err)
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-ticker.C:
-			if err := m.reconcileAll(ctx); err != nil {
-				m.logger.Error("reconciliation cycle failed", "error", err)
-			}
+		case <-maintenance.C:
+			m.pruneHistory(ctx)
+			m.collectOrphans(ctx)
 		}
 	}
 }
@@ -63,7 +197,7 @@ func (m *Manager) RunOnce(ctx context.Context) error {
 	return m.reconcileAll(ctx)
 }
 
-// ReconcileRepo triggers reconciliation for a single repository.
+// ReconcileRepo reconciles a single repository and waits for it to finish.
 func (m *Manager) ReconcileRepo(ctx context.Context, repoID int64) error {
 	repo, err := m.repos.Get(ctx, repoID)
 	if err != nil {
@@ -75,6 +209,57 @@ func (m *Manager) ReconcileRepo(ctx context.Context, repoID int64) error {
 	return m.reconcileRepo(ctx, repo)
 }
 
+// TriggerRepo queues a repository for reconciliation by the worker pool. A
+// repository that is already waiting in the queue is not queued twice.
+func (m *Manager) TriggerRepo(ctx context.Context, repoID int64) error {
+	repo, err := m.repos.Get(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	if repo == nil {
+		return errors.New("repository not found")
+	}
+	if !m.isLeader() {
+		// Only the leader drains the queue; it polls repositories as they
+		// fall due.
+		return m.repos.MarkDue(ctx, repoID)
+	}
+	if !m.queue.push(repoID) {
+		m.logger.Debug("reconcile already queued", "repo", repo.Name)
+	}
+	return nil
+}
+
+func (m *Manager) work(ctx context.Context) {
+	for {
+		repoID, ok := m.queue.pop(ctx)
+		if !ok {
+			return
+		}
+		if err := m.ReconcileRepo(ctx, repoID); err != nil {
+			m.logger.Error("repo reconciliation failed", "repo_id", repoID, "error", err)
+		}
+		m.queue.done(repoID)
+	}
+}
+
+// enqueueDue queues every idle repository whose next poll time has passed.
+// Repositories that have never been scheduled are due immediately.
+func (m *Manager) enqueueDue(ctx context.Context) error {
+	repos, err := m.repos.List(ctx)
+	if err != nil {
+		return err
+	}
+	now := storage.Now()
+	for _, repo := range repos {
+		if repo.NextPollAt.Valid && now.Before(repo.NextPollAt.Time) {
+			continue
+		}
+		m.queue.pushIfIdle(repo.ID)
+	}
+	return nil
+}
+
 func (m *Manager) reconcileAll(ctx context.Context) error {
 	repos, err := m.repos.List(ctx)
 	if err != nil {
@@ -89,58 +274,133 @@ func (m *Manager) reconcileAll(ctx context.Context) error {
 }
 
 func (m *Manager) reconcileRepo(ctx context.Context, repoRecord *storage.Repository) error {
-	var cred *storage.Credential
-	var payload *storage.CredentialPayload
-	if repoRecord.CredentialID.Valid {
-		var err error
-		cred, err = m.creds.Get(ctx, repoRecord.CredentialID.Int64)
-		if err != nil {
-			return err
-		}
-		if cred == nil {
-			return errors.New("linked credential not found")
-		}
-		payload, err = m.creds.DecryptPayload(cred)
-		if err != nil {
-			return err
-		}
+	return m.reconcileRepoAt(ctx, repoRecord, "")
+}
+
+// reconcileRepoAt runs a reconciliation pass. When approvedCommit is set the
+// repository's sync policy is bypassed, provided the synced commit still
+// matches the one whose changes were approved.
+// Callers must not hold the repository lock.
+func (m *Manager) reconcileRepoAt(ctx context.Context, repoRecord *storage.Repository, approvedCommit string) error {
+	unlock := m.locks.lock(repoRecord.ID)
+	defer unlock()
+
+	// Re-read the record now that no other pass can modify it; it may have
+	// been changed or deleted while we waited for the lock.
+	current, err := m.repos.Get(ctx, repoRecord.ID)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return errors.New("repository not found")
+	}
+	repoRecord = current
+
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, "reconcile repo", trace.WithAttributes(
+		tracing.RepoID.Int64(repoRecord.ID),
+		tracing.RepoName.String(repoRecord.Name),
+	))
+	defer span.End()
+
+	run := m.startRun(ctx, repoRecord)
+	snapshot, report, err := m.syncRepo(ctx, repoRecord, approvedCommit)
+	m.finishRun(ctx, repoRecord, run, snapshot, report, err)
+	recordPass(repoRecord, snapshot, report, err, start)
+	if snapshot != nil {
+		span.SetAttributes(tracing.Commit.String(snapshot.CommitHash))
+	}
+	tracing.Fail(span, err)
+	m.emitEvents(repoRecord, snapshot, report, err)
+	if snapshot != nil {
+		m.reportCommitStatus(ctx, repoRecord, snapshot.CommitHash, commitOutcome(report, err))
+	}
+	m.scheduleNext(ctx, repoRecord, shouldBackOff(report, err), report != nil && report.DeploysPending)
+	return err
+}
+
+func (m *Manager) syncRepo(ctx context.Context, repoRecord *storage.Repository, approvedCommit string) (*repo.Snapshot, *reconcileReport, error) {
+	cred, payload, err := m.credential(ctx, repoRecord)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	snapshot, err := m.git.Sync(ctx, *repoRecord, cred, payload)
 	if err != nil {
 		// Partial failures should still record the poll event
 		_ = m.repos.UpdatePollTimestamp(ctx, repoRecord.ID)
-		return err
+		return nil, nil, err
 	}
 
-	commitChanged := !repoRecord.LastCommit.Valid || repoRecord.LastCommit.String != snapshot.CommitHash
-	if err := m.ensureJobs(ctx, repoRecord, snapshot, commitChanged); err != nil {
-		return err
+	var approvalErr error
+	effective := repoRecord
+	if repoRecord.UnhealthyCommit.Valid && repoRecord.SyncPolicy == storage.SyncPolicyAuto {
+		// Hold changes after a failed deployment until it is acknowledged.
+		held := *repoRecord
+		held.SyncPolicy = storage.SyncPolicyManual
+		effective = &held
+	}
+	if approvedCommit != "" {
+		if snapshot.CommitHash == approvedCommit {
+			approved := *repoRecord
+			approved.SyncPolicy = storage.SyncPolicyAuto
+			effective = &approved
+		} else {
+			approvalErr = ErrPendingChangesStale
+		}
 	}
 
+	commitChanged := !repoRecord.LastCommit.Valid || repoRecord.LastCommit.String != snapshot.CommitHash
 	if commitChanged {
-		if err := m.repos.UpdateCommitMetadata(ctx, repoRecord.ID, snapshot.CommitHash, snapshot.CommitAuthor, snapshot.CommitTitle); err != nil {
-			return err
+		m.reportCommitStatus(ctx, repoRecord, snapshot.CommitHash, commitstatus.Status{State: commitstatus.StatePending, Description: "Reconciling"})
+	}
+	report, err := m.ensureJobs(ctx, effective, snapshot, commitChanged)
+	if err != nil {
+		return snapshot, report, err
+	}
+
+	if commitChanged || repoRecord.ResolvedRef.String != snapshot.Ref {
+		if err := m.repos.UpdateCommitMetadata(ctx, repoRecord.ID, snapshot.CommitHash, snapshot.CommitAuthor, snapshot.CommitTitle, snapshot.Ref); err != nil {
+			return snapshot, report, err
 		}
-		m.logger.Info("repo reconciled", "repo", repoRecord.Name, "commit", snapshot.CommitHash)
+		m.logger.Info("repo reconciled", "repo", repoRecord.Name, "ref", snapshot.Ref, "commit", snapshot.CommitHash)
 	} else {
 		if err := m.repos.UpdatePollTimestamp(ctx, repoRecord.ID); err != nil {
-			return err
+			return snapshot, report, err
 		}
 		m.logger.Info("repo state enforced", "repo", repoRecord.Name, "commit", snapshot.CommitHash)
 	}
 
-	return nil
+	return snapshot, report, approvalErr
+}
+
+// credential loads and decrypts the credential linked to a repository, if any.
+func (m *Manager) credential(ctx context.Context, repoRecord *storage.Repository) (*storage.Credential, *storage.CredentialPayload, error) {
+	if !repoRecord.CredentialID.Valid {
+		return nil, nil, nil
+	}
+	cred, err := m.creds.Get(ctx, repoRecord.CredentialID.Int64)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cred == nil {
+		return nil, nil, errors.New("linked credential not found")
+	}
+	payload, err := m.creds.DecryptPayload(cred)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cred, payload, nil
 }
 
 func (m *Manager) applyJob(ctx context.Context, repoRecord *storage.Repository, jobFile repo.JobFile, snapshot *repo.Snapshot, job *api.Job, submission *api.JobSubmission) (string, error) {
-	if job == nil || submission == nil {
-		return "", errors.New("job and submission are required")
+	if job == nil {
+		return "", errors.New("job is required")
 	}
 
 	annotateJob(job, repoRecord, jobFile, snapshot, true)
 
-	if err := m.nomad.RegisterJob(ctx, job, submission); err != nil {
+	if err := m.target(ctx, repoRecord).Client.RegisterJob(ctx, job, submission); err != nil {
 		return "", err
 	}
 	return jobID(job), nil
@@ -148,6 +408,9 @@ func (m *Manager) applyJob(ctx context.Context, repoRecord *storage.Repository,
 
 // DeleteRepository removes repository metadata and optionally unschedules jobs.
 func (m *Manager) DeleteRepository(ctx context.Context, repoID int64, unschedule bool) error {
+	unlock := m.locks.lock(repoID)
+	defer unlock()
+
 	repoRecord, err := m.repos.Get(ctx, repoID)
 	if err != nil {
 		return err
@@ -157,7 +420,7 @@ func (m *Manager) DeleteRepository(ctx context.Context, repoID int64, unschedule
 	}
 
 	if unschedule {
-		if err := m.unscheduleJobs(ctx, repoRecord.ID); err != nil {
+		if err := m.unscheduleJobs(ctx, repoRecord); err != nil {
 			return err
 		}
 	}
@@ -165,9 +428,20 @@ func (m *Manager) DeleteRepository(ctx context.Context, repoID int64, unschedule
 	if err := m.files.DeleteByRepo(ctx, repoRecord.ID); err != nil {
 		return err
 	}
+	if m.pending != nil {
+		if err := m.pending.DeleteByRepo(ctx, repoRecord.ID); err != nil {
+			return err
+		}
+	}
+	if m.conflicts != nil {
+		if err := m.conflicts.DeleteByRepo(ctx, repoRecord.ID); err != nil {
+			return err
+		}
+	}
 	if err := m.repos.Delete(ctx, repoRecord.ID); err != nil {
 		return err
 	}
+	lastSuccess.DeleteLabelValues(repoRecord.Name)
 	if err := m.git.RemoveRepo(repoRecord.ID); err != nil {
 		return err
 	}
@@ -208,8 +482,12 @@ func (m *Manager) DeleteCredential(ctx context.Context, credentialID int64, dele
 	return nil
 }
 
-func (m *Manager) unscheduleJobs(ctx context.Context, repoID int64) error {
-	files, err := m.files.ListByRepo(ctx, repoID)
+func (m *Manager) unscheduleJobs(ctx context.Context, repoRecord *storage.Repository) error {
+	target, err := m.clusterTarget(ctx, repoRecord)
+	if err != nil {
+		return err
+	}
+	files, err := m.files.ListByRepo(ctx, repoRecord.ID)
 	if err != nil {
 		return err
 	}
@@ -217,7 +495,15 @@ func (m *Manager) unscheduleJobs(ctx context.Context, repoID int64) error {
 		if !file.JobID.Valid || file.JobID.String == "" {
 			continue
 		}
-		if err := m.nomad.DeregisterJob(ctx, file.JobID.String, true); err != nil {
+		namespace := fileNamespace(target, file)
+		elsewhere, err := m.ownedElsewhere(ctx, repoRecord, file.Path, namespace, file.JobID.String)
+		if err != nil {
+			return err
+		}
+		if elsewhere {
+			continue
+		}
+		if err := target.Client.DeregisterJob(ctx, namespace, file.JobID.String, true); err != nil {
 			return err
 		}
 	}
@@ -237,8 +523,54 @@ func jobID(job *api.Job) string {
 	return ""
 }
 
-func parseJob(path string, contents []byte) (*api.Job, *api.JobSubmission, error) {
-	cfg := &jobspec2.ParseConfig{Body: contents, Path: path, Strict: true}
+// parseJob parses a job file and merges its overlay, if any. The submission
+// is always the base file's source and variables; an overlaid job records
+// its overlay path in meta, since no single file describes it.
+func parseJob(ctx context.Context, jobFile repo.JobFile, variables map[string]string) (*api.Job, *api.JobSubmission, error) {
+	ctx, span := tracer.Start(ctx, "parse job", trace.WithAttributes(tracing.JobFile.String(jobFile.Path)))
+	defer span.End()
+
+	job, submission, err := parseJobFile(jobFile, variables)
+	if err == nil && jobFile.Overlay != nil {
+		err = applyOverlay(ctx, job, jobFile, variables)
+	}
+	if err != nil {
+		tracing.Fail(span, err)
+		return nil, nil, err
+	}
+	span.SetAttributes(tracing.JobID.String(jobID(job)))
+	return job, submission, nil
+}
+
+func parseJobFile(jobFile repo.JobFile, variables map[string]string) (*api.Job, *api.JobSubmission, error) {
+	if jobFile.IsJSON() {
+		return parseJSONJob(jobFile)
+	}
+	// Repository variables and shared var files apply to every job in a
+	// directory, so only the values this job declares are passed on. The parse
+	// stays strict for everything else.
+	declared := declaredVariables(jobFile)
+	jobVariables := make(map[string]string)
+	argVars := make([]string, 0, len(variables))
+	for _, name := range sortedKeys(variables) {
+		if !declared[name] {
+			continue
+		}
+		jobVariables[name] = variables[name]
+		argVars = append(argVars, name+"="+variables[name])
+	}
+	varContent, err := declaredVarContent(jobFile.VarFiles, declared)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg := &jobspec2.ParseConfig{
+		Body:       jobFile.Content,
+		Path:       jobFile.Path,
+		ArgVars:    argVars,
+		VarContent: varContent,
+		Strict:     true,
+	}
 	job, err := jobspec2.ParseWithConfig(cfg)
 	if err != nil {
 		return nil, nil, err
@@ -247,88 +579,345 @@ func parseJob(path string, contents []byte) (*api.Job, *api.JobSubmission, error
 		job.Meta = map[string]string{}
 	}
 	submission := &api.JobSubmission{
-		Source: string(contents),
+		Source: string(jobFile.Content),
 		Format: "hcl2",
 	}
+	if len(jobVariables) > 0 {
+		submission.VariableFlags = jobVariables
+	}
+	submission.Variables = varContent
 	return job, submission, nil
 }
 
-func (m *Manager) ensureJobs(ctx context.Context, repoRecord *storage.Repository, snapshot *repo.Snapshot, commitChanged bool) error {
+// parseJSONJob decodes a JSON jobspec, either as written by
+// `nomad job run -output` or as a bare api.Job. HCL variables do not apply to
+// JSON jobs.
+func parseJSONJob(jobFile repo.JobFile) (*api.Job, *api.JobSubmission, error) {
+	var wrapped struct {
+		Job *api.Job
+	}
+	if err := json.Unmarshal(jobFile.Content, &wrapped); err != nil {
+		return nil, nil, fmt.Errorf("decode %s: %w", jobFile.Path, err)
+	}
+	job := wrapped.Job
+	if job == nil {
+		job = &api.Job{}
+		if err := json.Unmarshal(jobFile.Content, job); err != nil {
+			return nil, nil, fmt.Errorf("decode %s: %w", jobFile.Path, err)
+		}
+	}
+	if jobID(job) == "" {
+		return nil, nil, fmt.Errorf("%s: job ID is required", jobFile.Path)
+	}
+	if job.Meta == nil {
+		job.Meta = map[string]string{}
+	}
+	submission := &api.JobSubmission{
+		Source: string(jobFile.Content),
+		Format: "json",
+	}
+	return job, submission, nil
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *Manager) ensureJobs(ctx context.Context, repoRecord *storage.Repository, snapshot *repo.Snapshot, commitChanged bool) (*reconcileReport, error) {
+	report := &reconcileReport{}
+	target, err := m.clusterTarget(ctx, repoRecord)
+	if err != nil {
+		return report, err
+	}
 	repoFiles, err := m.files.ListByRepo(ctx, repoRecord.ID)
 	if err != nil {
-		return err
+		return report, err
 	}
 
 	fileIndex := make(map[string]storage.RepoFile, len(repoFiles))
+	report.PreviousErrors = make(map[string]storage.FileError)
 	for _, file := range repoFiles {
 		fileIndex[file.Path] = file
+		if file.LastError.Valid {
+			report.PreviousErrors[file.Path] = storage.FileError{Phase: file.LastErrorPhase.String, Message: file.LastError.String}
+		}
 	}
 
-	seen := make(map[string]struct{}, len(snapshot.JobFiles))
+	// Deployments started by earlier passes are checked once, not waited on.
+	deploys := m.checkDeployments(ctx, report, repoRecord, repoFiles)
+	for _, state := range deploys {
+		if state == deployFailed && !repoRecord.UnhealthyCommit.Valid {
+			// Hold changes from here on, as the next pass will.
+			held := *repoRecord
+			held.SyncPolicy = storage.SyncPolicyManual
+			held.UnhealthyCommit = nullString(snapshot.CommitHash)
+			repoRecord = &held
+			break
+		}
+	}
+
+	granted := make(map[string]storage.JobConflict)
+	if m.conflicts != nil {
+		conflicts, err := m.conflicts.ListByRepo(ctx, repoRecord.ID)
+		if err != nil {
+			return report, err
+		}
+		for _, conflict := range conflicts {
+			granted[conflict.Path] = conflict
+		}
+	}
 
+	seen := make(map[string]struct{}, len(snapshot.JobFiles))
 	for _, jobFile := range snapshot.JobFiles {
 		seen[jobFile.Path] = struct{}{}
-		existing, tracked := fileIndex[jobFile.Path]
-		job, submission, err := parseJob(jobFile.Path, jobFile.Content)
+	}
+
+	// Jobs are tracked per file, but what Nomad knows about is the job ID
+	// within its namespace. trackedIDs maps each job key to the present file
+	// tracking it, and declared maps each job key to the first file that
+	// declares it, so a renamed or moved file does not deregister the job it
+	// still declares.
+	trackedIDs := make(map[string]string, len(repoFiles))
+	trackedByID := make(map[string]storage.RepoFile, len(repoFiles))
+	for _, file := range repoFiles {
+		if !file.JobID.Valid || file.JobID.String == "" {
+			continue
+		}
+		key := jobKey(fileNamespace(target, file), file.JobID.String)
+		trackedByID[key] = file
+		if _, ok := seen[file.Path]; ok {
+			trackedIDs[key] = file.Path
+		}
+	}
+	declared := make(map[string]string, len(snapshot.JobFiles))
+	var replaced []storage.RepoFile
+
+	var parsed []parsedJobFile
+	for _, jobFile := range snapshot.JobFiles {
+		job, submission, err := parseJob(ctx, jobFile, repoRecord.Variables)
+		if err == nil {
+			var wave int
+			if wave, err = jobWave(job); err == nil {
+				parsed = append(parsed, parsedJobFile{file: jobFile, job: job, submission: submission, wave: wave})
+			}
+		}
 		if err != nil {
 			m.logger.Error("job parse failed", "repo", repoRecord.Name, "file", jobFile.Path, "error", err)
+			report.failed(jobFile.Path, "", storage.JobPhaseParse, err)
 			continue
 		}
+		if key := jobKey(jobNamespace(target, job), jobID(job)); declared[key] == "" {
+			declared[key] = jobFile.Path
+		}
+	}
 
-		needApply := !tracked
-		var trackedJobID string
-		if tracked && existing.JobID.Valid {
-			trackedJobID = existing.JobID.String
+	// Every job in a wave is registered and its deployment finished before
+	// the next wave starts. Deployments are checked on later passes, so the
+	// waves after one that is still deploying wait for them. A wave with
+	// failures stops the waves after it.
+	stopped := false
+	var stoppedReason string
+	for _, wave := range groupWaves(parsed) {
+		if stopped {
+			for _, pj := range wave {
+				report.add(pj.file.Path, jobID(pj.job), storage.JobActionSkipped, storage.JobPhaseWave, stoppedReason)
+			}
+			continue
 		}
+		failures := report.count(storage.JobActionFailed)
 
-		if tracked && !needApply {
-			if trackedJobID == "" {
-				needApply = true
-			} else {
-				status, err := m.nomad.JobStatus(ctx, trackedJobID)
-				if err != nil {
-					m.logger.Warn("job status check failed", "repo", repoRecord.Name, "job_id", trackedJobID, "file", jobFile.Path, "error", err)
-					if commitChanged {
+		for _, pj := range wave {
+			jobFile, job, submission := pj.file, pj.job, pj.submission
+			existing, tracked := fileIndex[jobFile.Path]
+			declaredID := jobID(job)
+			namespace := jobNamespace(target, job)
+			if !repoRecord.AllowsNamespace(namespace) {
+				err := fmt.Errorf("namespace %q is not allowed for this repository", namespace)
+				m.logger.Error("job namespace not allowed", "repo", repoRecord.Name, "file", jobFile.Path, "namespace", namespace)
+				report.failed(jobFile.Path, declaredID, storage.JobPhaseNamespace, err)
+				continue
+			}
+
+			needApply := !tracked
+			reason := "new job"
+			var movedFrom string
+			// A row without a job ID only carries an earlier error.
+			if !tracked || !existing.JobID.Valid || existing.JobID.String == "" {
+				if previous, ok := trackedByID[jobKey(namespace, declaredID)]; ok {
+					if _, stillPresent := seen[previous.Path]; !stillPresent {
+						movedFrom = previous.Path
+						reason = "moved from " + previous.Path
+					}
+				}
+			}
+			var plan *api.JobPlanResponse
+			var trackedJobID string
+			statusFailed := false
+			trackedNamespace := fileNamespace(target, existing)
+			if tracked && existing.JobID.Valid {
+				trackedJobID = existing.JobID.String
+			}
+
+			if tracked && !needApply {
+				if trackedJobID == "" {
+					needApply = true
+					reason = "job not yet registered"
+				} else {
+					status, err := target.Client.JobStatus(ctx, trackedNamespace, trackedJobID)
+					if err != nil {
+						m.logger.Warn("job status check failed", "repo", repoRecord.Name, "job_id", trackedJobID, "file", jobFile.Path, "error", err)
+						if commitChanged {
+							needApply = true
+							statusFailed = true
+							reason = "status check failed on new commit"
+						} else {
+							report.failed(jobFile.Path, trackedJobID, storage.JobPhaseStatus, err)
+							continue
+						}
+					}
+					if status == nil || !status.Exists {
 						needApply = true
-					} else {
-						continue
+						if err == nil {
+							reason = "job missing from Nomad"
+						}
 					}
 				}
-				if status == nil || !status.Exists {
+			}
+
+			if tracked && !needApply {
+				annotateJob(job, repoRecord, jobFile, snapshot, false)
+				plan, err = target.Client.PlanJob(ctx, job)
+				if err != nil {
+					m.logger.Warn("job plan failed", "repo", repoRecord.Name, "job_id", trackedJobID, "file", jobFile.Path, "error", err)
+					needApply = true
+					reason = "plan failed: " + err.Error()
+				} else if !jobPlanHasChanges(plan) {
+					if commitChanged {
+						if err := m.files.Upsert(ctx, repoRecord.ID, jobFile.Path, snapshot.CommitHash, trackedJobID, trackedNamespace); err != nil {
+							return report, err
+						}
+					}
+					report.add(jobFile.Path, trackedJobID, storage.JobActionUnchanged, "", "no changes")
+					continue
+				} else {
 					needApply = true
+					reason = planSummary(plan)
 				}
 			}
-		}
 
-		if tracked && !needApply {
-			annotateJob(job, repoRecord, jobFile, snapshot, false)
-			plan, err := m.nomad.PlanJob(ctx, job)
-			if err != nil {
-				m.logger.Warn("job plan failed", "repo", repoRecord.Name, "job_id", trackedJobID, "file", jobFile.Path, "error", err)
-				needApply = true
-			} else if !jobPlanHasChanges(plan) {
-				if commitChanged {
-					if err := m.files.Upsert(ctx, repoRecord.ID, jobFile.Path, snapshot.CommitHash, trackedJobID); err != nil {
-						return err
+			if !needApply {
+				continue
+			}
+
+			if err := jobpolicy.Error(jobpolicy.Check(job, m.jobPolicy, repoRecord.JobPolicy)); err != nil {
+				m.logger.Error("job violates policy", "repo", repoRecord.Name, "file", jobFile.Path, "error", err)
+				report.failed(jobFile.Path, declaredID, storage.JobPhasePolicy, err)
+				continue
+			}
+
+			// A job this file registered is reapplied on a new commit even
+			// when Nomad could not be read; checking its owner would read
+			// the same status again and block the deploy.
+			var conflict *storage.JobConflict
+			if !statusFailed || trackedJobID != declaredID || trackedNamespace != namespace {
+				conflict, err = m.ownershipConflict(ctx, repoRecord, jobFile.Path, namespace, declaredID)
+				if err != nil {
+					// Without knowing who owns the job, registering it could
+					// overwrite another repository's job.
+					m.logger.Error("job ownership check failed", "repo", repoRecord.Name, "file", jobFile.Path, "error", err)
+					if grant, ok := granted[jobFile.Path]; ok {
+						// Keep the recorded conflict and any takeover grant.
+						report.Conflicts = append(report.Conflicts, grant)
 					}
+					report.failed(jobFile.Path, declaredID, storage.JobPhaseOwnership, err)
+					continue
 				}
+			}
+			if conflict != nil && movedFrom != "" && conflict.OwnerRepoURL == repoRecord.RepoURL && conflict.OwnerJobFile == movedFrom {
+				// The job still carries the path it was registered from.
+				conflict = nil
+			}
+			if conflict != nil {
+				if !takeoverGranted(granted, conflict) {
+					m.logger.Warn("job owned by another repository", "repo", repoRecord.Name, "file", jobFile.Path, "job_id", conflict.JobID, "owner", conflict.OwnerRepoURL, "owner_file", conflict.OwnerJobFile)
+					report.Conflicts = append(report.Conflicts, *conflict)
+					report.failed(jobFile.Path, conflict.JobID, storage.JobPhaseOwnership, conflictError(conflict))
+					continue
+				}
+				m.logger.Info("taking over job", "repo", repoRecord.Name, "file", jobFile.Path, "job_id", conflict.JobID, "owner", conflict.OwnerRepoURL)
+				reason = "taken over from " + conflict.OwnerRepoURL
+			}
+
+			if repoRecord.SyncPolicy.HoldsChanges() {
+				if conflict != nil {
+					// Keep the takeover grant until the held change is approved.
+					report.Conflicts = append(report.Conflicts, *conflict)
+				}
+				m.holdJobChange(ctx, report, repoRecord, jobFile, snapshot, job, trackedJobID, plan, reason)
 				continue
-			} else {
-				needApply = true
+			}
+
+			jobID, err := m.applyJob(ctx, repoRecord, jobFile, snapshot, job, submission)
+			if errors.Is(err, ErrNotLeader) {
+				return report, err
+			}
+			if err != nil {
+				m.logger.Error("job apply failed", "repo", repoRecord.Name, "file", jobFile.Path, "error", err)
+				if conflict != nil {
+					report.Conflicts = append(report.Conflicts, *conflict)
+				}
+				report.failed(jobFile.Path, trackedJobID, storage.JobPhaseApply, err)
+				continue
+			}
+			if err := m.files.Upsert(ctx, repoRecord.ID, jobFile.Path, snapshot.CommitHash, jobID, namespace); err != nil {
+				return report, err
+			}
+			trackedIDs[jobKey(namespace, jobID)] = jobFile.Path
+			if trackedJobID != "" && jobKey(trackedNamespace, trackedJobID) != jobKey(namespace, jobID) {
+				replaced = append(replaced, existing)
+			}
+			report.add(jobFile.Path, jobID, storage.JobActionApplied, storage.JobPhaseApply, reason)
+
+			if m.watchDeployment(ctx, repoRecord, jobFile.Path, job, snapshot.CommitHash) {
+				deploys[jobFile.Path] = deployPending
+				report.DeploysPending = true
 			}
 		}
 
-		if !needApply {
-			continue
+		waiting, unhealthy := false, false
+		for _, pj := range wave {
+			switch deploys[pj.file.Path] {
+			case deployPending:
+				waiting = true
+			case deployFailed:
+				unhealthy = true
+			}
 		}
+		switch {
+		case unhealthy || report.count(storage.JobActionFailed) > failures:
+			stopped = true
+			stoppedReason = fmt.Sprintf("wave %d did not complete", wave[0].wave)
+		case waiting:
+			stopped = true
+			stoppedReason = fmt.Sprintf("waiting for wave %d to deploy", wave[0].wave)
+		}
+	}
 
-		jobID, err := m.applyJob(ctx, repoRecord, jobFile, snapshot, job, submission)
-		if err != nil {
-			m.logger.Error("job apply failed", "repo", repoRecord.Name, "file", jobFile.Path, "error", err)
+	// A file that now declares a different job ID or namespace leaves its
+	// previous job behind; remove it unless another file still declares it.
+	for _, file := range replaced {
+		oldID := file.JobID.String
+		oldNamespace := fileNamespace(target, file)
+		if _, ok := declared[jobKey(oldNamespace, oldID)]; ok {
 			continue
 		}
-		if err := m.files.Upsert(ctx, repoRecord.ID, jobFile.Path, snapshot.CommitHash, jobID); err != nil {
-			return err
+		if err := m.removeJob(ctx, report, repoRecord, file.Path, oldNamespace, oldID, "job renamed in "+file.Path); err != nil {
+			m.logger.Error("job deregister failed", "repo", repoRecord.Name, "job_id", oldID, "file", file.Path, "error", err)
 		}
 	}
 
@@ -336,23 +925,80 @@ func (m *Manager) ensureJobs(ctx context.Context, repoRecord *storage.Repository
 		if _, ok := seen[path]; ok {
 			continue
 		}
-		// Job file no longer exists in the repo. Unschedule and drop tracking metadata.
 		if file.JobID.Valid && file.JobID.String != "" {
-			if err := m.nomad.DeregisterJob(ctx, file.JobID.String, true); err != nil {
-				if m.logger != nil {
-					m.logger.Error("job deregister failed", "repo", repoRecord.Name, "job_id", file.JobID.String, "file", path, "error", err)
+			if newPath, ok := declared[jobKey(fileNamespace(target, file), file.JobID.String)]; ok {
+				// The file was renamed or moved. Drop the old tracking row once
+				// the new path has taken over the job; until then keep it.
+				if trackedIDs[jobKey(fileNamespace(target, file), file.JobID.String)] == "" {
+					continue
+				}
+				if err := m.files.Delete(ctx, repoRecord.ID, path); err != nil {
+					return report, err
 				}
+				m.logger.Info("job file moved", "repo", repoRecord.Name, "job_id", file.JobID.String, "from", path, "to", newPath)
+				continue
+			}
+		}
+		// Job file no longer exists in the repo. Unschedule and drop tracking metadata.
+		if repoRecord.SyncPolicy.HoldsChanges() {
+			report.hold(repoRecord.SyncPolicy, storage.PendingChange{
+				Path:    path,
+				JobID:   file.JobID,
+				Commit:  nullString(snapshot.CommitHash),
+				Action:  storage.PendingActionRemove,
+				Summary: "job file removed from repository",
+			})
+			continue
+		}
+		if file.JobID.Valid && file.JobID.String != "" {
+			if err := m.removeJob(ctx, report, repoRecord, path, fileNamespace(target, file), file.JobID.String, "job file removed from repository"); err != nil {
+				m.logger.Error("job deregister failed", "repo", repoRecord.Name, "job_id", file.JobID.String, "file", path, "error", err)
 				continue
 			}
+		} else {
+			report.add(path, "", storage.JobActionRemoved, storage.JobPhaseDeregister, "job file removed from repository")
 		}
 		if err := m.files.Delete(ctx, repoRecord.ID, path); err != nil {
-			return err
+			return report, err
+		}
+		m.logger.Info("job removed", "repo", repoRecord.Name, "file", path, "job_id", file.JobID.String)
+	}
+
+	if err := m.files.ReplaceErrors(ctx, repoRecord.ID, report.fileErrors()); err != nil {
+		return report, err
+	}
+	if m.pending != nil {
+		if err := m.pending.Replace(ctx, repoRecord.ID, report.Pending); err != nil {
+			return report, err
 		}
-		if m.logger != nil {
-			m.logger.Info("job removed", "repo", repoRecord.Name, "file", path, "job_id", file.JobID.String)
+	}
+	if m.conflicts != nil {
+		if err := m.conflicts.Replace(ctx, repoRecord.ID, report.Conflicts); err != nil {
+			return report, err
 		}
 	}
 
+	return report, nil
+}
+
+// removeJob deregisters jobID from namespace on behalf of the file at path and
+// records the outcome. A job that has been taken over by another repository
+// or file is left running.
+func (m *Manager) removeJob(ctx context.Context, report *reconcileReport, repoRecord *storage.Repository, path, namespace, jobID, summary string) error {
+	elsewhere, err := m.ownedElsewhere(ctx, repoRecord, path, namespace, jobID)
+	if err != nil {
+		report.failed(path, jobID, storage.JobPhaseOwnership, err)
+		return err
+	}
+	if elsewhere {
+		report.add(path, jobID, storage.JobActionRemoved, storage.JobPhaseDeregister, summary+"; job is owned elsewhere and was left running")
+		return nil
+	}
+	if err := m.target(ctx, repoRecord).Client.DeregisterJob(ctx, namespace, jobID, true); err != nil {
+		report.failed(path, jobID, storage.JobPhaseDeregister, err)
+		return err
+	}
+	report.add(path, jobID, storage.JobActionRemoved, storage.JobPhaseDeregister, summary)
 	return nil
 }
 
@@ -438,6 +1084,9 @@ func annotateJob(job *api.Job, repoRecord *storage.Repository, jobFile repo.JobF
 	job.Meta[compassMetaRepoURL] = repoRecord.RepoURL
 	job.Meta[compassMetaRepoName] = repoRecord.Name
 	job.Meta[compassMetaJobFile] = jobFile.Path
+	if jobFile.Overlay != nil {
+		job.Meta[compassMetaOverlay] = jobFile.Overlay.Path
+	}
 	if includeCommitMetadata && snapshot != nil {
 		job.Meta[compassMetaCommit] = snapshot.CommitHash
 		job.Meta[compassMetaCommitAuthor] = snapshot.CommitAuthor
@@ -5,18 +5,20 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/hashicorp/nomad/api"
 
+	"github.com/brianmichel/nomad-compass/internal/jobpolicy"
 	"github.com/brianmichel/nomad-compass/internal/nomadclient"
 	repomodel "github.com/brianmichel/nomad-compass/internal/repo"
 	"github.com/brianmichel/nomad-compass/internal/storage"
 )
 
 func TestParseJob(t *testing.T) {
-	job, submission, err := parseJob(".nomad/job.nomad.hcl", []byte(`job "demo" { datacenters = ["dc1"] }`))
+	job, submission, err := parseJob(context.Background(), repomodel.JobFile{Path: ".nomad/job.nomad.hcl", Content: []byte(`job "demo" { datacenters = ["dc1"] }`)}, nil)
 	if err != nil {
 		t.Fatalf("parse job: %v", err)
 	}
@@ -31,6 +33,127 @@ func TestParseJob(t *testing.T) {
 	}
 }
 
+func TestParseJobJSON(t *testing.T) {
+	for name, content := range map[string]string{
+		"run output": `{"Job": {"ID": "demo", "Name": "demo", "Datacenters": ["dc1"]}}`,
+		"bare job":   `{"ID": "demo", "Datacenters": ["dc1"]}`,
+	} {
+		job, submission, err := parseJob(context.Background(), repomodel.JobFile{Path: ".nomad/demo.nomad.json", Content: []byte(content)}, map[string]string{"ignored": "x"})
+		if err != nil {
+			t.Fatalf("%s: parse job: %v", name, err)
+		}
+		if jobID(job) != "demo" || len(job.Datacenters) != 1 || job.Meta == nil {
+			t.Fatalf("%s: unexpected job: %#v", name, job)
+		}
+		if submission.Format != "json" || submission.Source != content {
+			t.Fatalf("%s: unexpected submission: %#v", name, submission)
+		}
+	}
+
+	if _, _, err := parseJob(context.Background(), repomodel.JobFile{Path: ".nomad/bad.nomad.json", Content: []byte(`{"Datacenters": ["dc1"]}`)}, nil); err == nil {
+		t.Fatal("expected a JSON job without an ID to fail")
+	}
+}
+
+func TestParseJobWithVariables(t *testing.T) {
+	dir := t.TempDir()
+	varFilePath := filepath.Join(dir, "demo.vars.hcl")
+	varFileContent := []byte(`image = "nginx:1.27"` + "\n")
+	if err := os.WriteFile(varFilePath, varFileContent, 0o644); err != nil {
+		t.Fatalf("write var file: %v", err)
+	}
+
+	jobFile := repomodel.JobFile{
+		Path: ".nomad/demo.nomad.hcl",
+		Content: []byte(`variable "datacenter" {}
+variable "image" {}
+
+job "demo" {
+  datacenters = [var.datacenter]
+  group "web" {
+    task "app" {
+      driver = "docker"
+      config { image = var.image }
+    }
+  }
+}`),
+		VarFiles: []repomodel.VarFile{{Path: ".nomad/demo.vars.hcl", FullPath: varFilePath, Content: varFileContent}},
+	}
+
+	job, submission, err := parseJob(context.Background(), jobFile, map[string]string{"datacenter": "dc2", "unused": "ignored"})
+	if err != nil {
+		t.Fatalf("parse job: %v", err)
+	}
+	if len(job.Datacenters) != 1 || job.Datacenters[0] != "dc2" {
+		t.Fatalf("expected datacenter from repo variables, got %v", job.Datacenters)
+	}
+	if image := job.TaskGroups[0].Tasks[0].Config["image"]; image != "nginx:1.27" {
+		t.Fatalf("expected image from var file, got %v", image)
+	}
+	if _, ok := submission.VariableFlags["unused"]; ok {
+		t.Fatalf("expected undeclared variables to be left out, got %v", submission.VariableFlags)
+	}
+	if submission.VariableFlags["datacenter"] != "dc2" {
+		t.Fatalf("expected variable flags recorded, got %v", submission.VariableFlags)
+	}
+	if submission.Variables != string(varFileContent) {
+		t.Fatalf("expected var file content recorded, got %q", submission.Variables)
+	}
+}
+
+func TestParseJobSharedVarFiles(t *testing.T) {
+	jobFile := repomodel.JobFile{
+		Path: ".nomad/demo.nomad.hcl",
+		Content: []byte(`variable "image" {}
+job "demo" {
+  datacenters = ["dc1"]
+  group "web" {
+    task "app" {
+      driver = "docker"
+      config { image = var.image }
+    }
+  }
+}`),
+		VarFiles: []repomodel.VarFile{
+			{Path: ".nomad/a.vars.hcl", Content: []byte(`image = "nginx:1.26"` + "\nreplicas = 3\n")},
+			{Path: ".nomad/b.vars.hcl", Content: []byte(`image = "nginx:1.27"` + "\n")},
+		},
+	}
+	job, submission, err := parseJob(context.Background(), jobFile, nil)
+	if err != nil {
+		t.Fatalf("parse job: %v", err)
+	}
+	if image := job.TaskGroups[0].Tasks[0].Config["image"]; image != "nginx:1.27" {
+		t.Fatalf("expected the later var file to win, got %v", image)
+	}
+	if submission.Variables != `image = "nginx:1.27"`+"\n" {
+		t.Fatalf("expected only declared variables recorded, got %q", submission.Variables)
+	}
+}
+
+func TestParseJobUndefinedVariableFails(t *testing.T) {
+	_, _, err := parseJob(context.Background(), repomodel.JobFile{
+		Path: ".nomad/demo.nomad.hcl",
+		Content: []byte(`variable "image" {}
+job "demo" { datacenters = [var.imgae] }`),
+		VarFiles: []repomodel.VarFile{{Path: ".nomad/demo.vars.hcl", Content: []byte(`image = "nginx"` + "\n")}},
+	}, map[string]string{"region": "eu"})
+	if err == nil {
+		t.Fatal("expected a reference to an undeclared variable to fail")
+	}
+}
+
+func TestParseJobMissingVariableFails(t *testing.T) {
+	_, _, err := parseJob(context.Background(), repomodel.JobFile{
+		Path: ".nomad/demo.nomad.hcl",
+		Content: []byte(`variable "datacenter" {}
+job "demo" { datacenters = [var.datacenter] }`),
+	}, nil)
+	if err == nil {
+		t.Fatal("expected parse error for unset variable")
+	}
+}
+
 func TestApplyJobAddsMetadata(t *testing.T) {
 	fake := &fakeNomad{}
 	m := &Manager{nomad: fake}
@@ -39,7 +162,7 @@ func TestApplyJobAddsMetadata(t *testing.T) {
 	snapshot := &repomodel.Snapshot{CommitHash: "abc123", CommitAuthor: "Tester <test@example.com>", CommitTitle: "Initial"}
 	jobFile := repomodel.JobFile{Path: ".nomad/job.nomad.hcl", Content: []byte(`job "demo" { datacenters = ["dc1"] }`)}
 
-	job, submission, err := parseJob(jobFile.Path, jobFile.Content)
+	job, submission, err := parseJob(context.Background(), jobFile, nil)
 	if err != nil {
 		t.Fatalf("parse job: %v", err)
 	}
@@ -95,7 +218,7 @@ func TestEnsureJobsRemovesDeletedJobs(t *testing.T) {
 		t.Fatalf("migrate db: %v", err)
 	}
 
-	repoStore := storage.NewRepoStore(db)
+	repoStore := storage.NewRepoStore(db, nil)
 	fileStore := storage.NewRepoFileStore(db)
 
 	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{
@@ -107,7 +230,7 @@ func TestEnsureJobsRemovesDeletedJobs(t *testing.T) {
 		t.Fatalf("create repo: %v", err)
 	}
 
-	if err := fileStore.Upsert(ctx, repoRecord.ID, ".nomad/removed.nomad.hcl", "old", "demo-job"); err != nil {
+	if err := fileStore.Upsert(ctx, repoRecord.ID, ".nomad/removed.nomad.hcl", "old", "demo-job", ""); err != nil {
 		t.Fatalf("upsert repo file: %v", err)
 	}
 
@@ -119,7 +242,7 @@ func TestEnsureJobsRemovesDeletedJobs(t *testing.T) {
 	}
 
 	snapshot := &repomodel.Snapshot{JobFiles: nil, CommitHash: "new"}
-	if err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
 		t.Fatalf("ensure jobs: %v", err)
 	}
 
@@ -148,7 +271,7 @@ func TestEnsureJobsSkipsUnchangedJobs(t *testing.T) {
 		t.Fatalf("migrate db: %v", err)
 	}
 
-	repoStore := storage.NewRepoStore(db)
+	repoStore := storage.NewRepoStore(db, nil)
 	fileStore := storage.NewRepoFileStore(db)
 
 	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{
@@ -162,7 +285,7 @@ func TestEnsureJobsSkipsUnchangedJobs(t *testing.T) {
 
 	jobContent := []byte(`job "demo" { datacenters = ["dc1"] }`)
 	jobPath := ".nomad/demo.nomad.hcl"
-	if err := fileStore.Upsert(ctx, repoRecord.ID, jobPath, "old", "demo"); err != nil {
+	if err := fileStore.Upsert(ctx, repoRecord.ID, jobPath, "old", "demo", ""); err != nil {
 		t.Fatalf("upsert repo file: %v", err)
 	}
 
@@ -186,7 +309,7 @@ func TestEnsureJobsSkipsUnchangedJobs(t *testing.T) {
 		}},
 	}
 
-	if err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
 		t.Fatalf("ensure jobs: %v", err)
 	}
 
@@ -219,7 +342,7 @@ func TestEnsureJobsReappliesChangedJobs(t *testing.T) {
 		t.Fatalf("migrate db: %v", err)
 	}
 
-	repoStore := storage.NewRepoStore(db)
+	repoStore := storage.NewRepoStore(db, nil)
 	fileStore := storage.NewRepoFileStore(db)
 
 	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{
@@ -232,7 +355,7 @@ func TestEnsureJobsReappliesChangedJobs(t *testing.T) {
 	}
 
 	jobPath := ".nomad/demo.nomad.hcl"
-	if err := fileStore.Upsert(ctx, repoRecord.ID, jobPath, "old", "demo"); err != nil {
+	if err := fileStore.Upsert(ctx, repoRecord.ID, jobPath, "old", "demo", ""); err != nil {
 		t.Fatalf("upsert repo file: %v", err)
 	}
 
@@ -262,7 +385,7 @@ func TestEnsureJobsReappliesChangedJobs(t *testing.T) {
 		}},
 	}
 
-	if err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
 		t.Fatalf("ensure jobs: %v", err)
 	}
 
@@ -298,7 +421,7 @@ func TestEnsureJobsOnlyReappliesChangedJobAcrossRepo(t *testing.T) {
 		t.Fatalf("migrate db: %v", err)
 	}
 
-	repoStore := storage.NewRepoStore(db)
+	repoStore := storage.NewRepoStore(db, nil)
 	fileStore := storage.NewRepoFileStore(db)
 
 	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{
@@ -312,10 +435,10 @@ func TestEnsureJobsOnlyReappliesChangedJobAcrossRepo(t *testing.T) {
 
 	changedPath := ".nomad/changed.nomad.hcl"
 	unchangedPath := ".nomad/unchanged.nomad.hcl"
-	if err := fileStore.Upsert(ctx, repoRecord.ID, changedPath, "old", "job-changed"); err != nil {
+	if err := fileStore.Upsert(ctx, repoRecord.ID, changedPath, "old", "job-changed", ""); err != nil {
 		t.Fatalf("upsert changed repo file: %v", err)
 	}
-	if err := fileStore.Upsert(ctx, repoRecord.ID, unchangedPath, "old", "job-unchanged"); err != nil {
+	if err := fileStore.Upsert(ctx, repoRecord.ID, unchangedPath, "old", "job-unchanged", ""); err != nil {
 		t.Fatalf("upsert unchanged repo file: %v", err)
 	}
 
@@ -362,7 +485,7 @@ func TestEnsureJobsOnlyReappliesChangedJobAcrossRepo(t *testing.T) {
 		},
 	}
 
-	if err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
 		t.Fatalf("ensure jobs: %v", err)
 	}
 
@@ -399,7 +522,7 @@ func TestEnsureJobsIgnoresCompassCommitMetadataDiffsAcrossRepo(t *testing.T) {
 		t.Fatalf("migrate db: %v", err)
 	}
 
-	repoStore := storage.NewRepoStore(db)
+	repoStore := storage.NewRepoStore(db, nil)
 	fileStore := storage.NewRepoFileStore(db)
 
 	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{
@@ -417,7 +540,7 @@ func TestEnsureJobsIgnoresCompassCommitMetadataDiffsAcrossRepo(t *testing.T) {
 		"job-c": ".nomad/c.nomad.hcl",
 	}
 	for jobID, path := range paths {
-		if err := fileStore.Upsert(ctx, repoRecord.ID, path, "old", jobID); err != nil {
+		if err := fileStore.Upsert(ctx, repoRecord.ID, path, "old", jobID, ""); err != nil {
 			t.Fatalf("upsert %s repo file: %v", jobID, err)
 		}
 	}
@@ -469,7 +592,7 @@ func TestEnsureJobsIgnoresCompassCommitMetadataDiffsAcrossRepo(t *testing.T) {
 		},
 	}
 
-	if err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
 		t.Fatalf("ensure jobs: %v", err)
 	}
 
@@ -493,7 +616,7 @@ func TestEnsureJobsPlanUsesStableAnnotations(t *testing.T) {
 		t.Fatalf("migrate db: %v", err)
 	}
 
-	repoStore := storage.NewRepoStore(db)
+	repoStore := storage.NewRepoStore(db, nil)
 	fileStore := storage.NewRepoFileStore(db)
 
 	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{
@@ -506,7 +629,7 @@ func TestEnsureJobsPlanUsesStableAnnotations(t *testing.T) {
 	}
 
 	jobPath := ".nomad/demo.nomad.hcl"
-	if err := fileStore.Upsert(ctx, repoRecord.ID, jobPath, "old", "demo"); err != nil {
+	if err := fileStore.Upsert(ctx, repoRecord.ID, jobPath, "old", "demo", ""); err != nil {
 		t.Fatalf("upsert repo file: %v", err)
 	}
 
@@ -547,7 +670,7 @@ func TestEnsureJobsPlanUsesStableAnnotations(t *testing.T) {
 		}},
 	}
 
-	if err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
 		t.Fatalf("ensure jobs: %v", err)
 	}
 
@@ -571,7 +694,7 @@ func TestEnsureJobsReappliesOnStatusErrorWhenCommitChanged(t *testing.T) {
 		t.Fatalf("migrate db: %v", err)
 	}
 
-	repoStore := storage.NewRepoStore(db)
+	repoStore := storage.NewRepoStore(db, nil)
 	fileStore := storage.NewRepoFileStore(db)
 
 	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{
@@ -584,7 +707,7 @@ func TestEnsureJobsReappliesOnStatusErrorWhenCommitChanged(t *testing.T) {
 	}
 
 	jobPath := ".nomad/demo.nomad.hcl"
-	if err := fileStore.Upsert(ctx, repoRecord.ID, jobPath, "old", "demo"); err != nil {
+	if err := fileStore.Upsert(ctx, repoRecord.ID, jobPath, "old", "demo", ""); err != nil {
 		t.Fatalf("upsert repo file: %v", err)
 	}
 
@@ -611,7 +734,7 @@ func TestEnsureJobsReappliesOnStatusErrorWhenCommitChanged(t *testing.T) {
 		}},
 	}
 
-	if err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
 		t.Fatalf("ensure jobs: %v", err)
 	}
 
@@ -623,18 +746,72 @@ func TestEnsureJobsReappliesOnStatusErrorWhenCommitChanged(t *testing.T) {
 	}
 }
 
+func TestEnsureJobsFailsClosedWhenOwnershipCannotBeChecked(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	repoRecord, err := storage.NewRepoStore(db, nil).Create(ctx, storage.RepositoryInput{
+		Name:    "demo",
+		RepoURL: "https://example.com/demo.git",
+		Branch:  "main",
+	})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+
+	fake := &fakeNomad{jobStatusErr: errors.New("nomad read denied")}
+	m := &Manager{
+		files:  storage.NewRepoFileStore(db),
+		nomad:  fake,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "new",
+		JobFiles: []repomodel.JobFile{{
+			Path:    ".nomad/demo.nomad.hcl",
+			Content: []byte(`job "demo" { datacenters = ["dc1"] }`),
+		}},
+	}
+
+	report, err := m.ensureJobs(ctx, repoRecord, snapshot, true)
+	if err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	// The file has not registered the job before, so it must not be
+	// registered over a job another repository may own.
+	if fake.registerCalls != 0 {
+		t.Fatalf("expected no register when ownership cannot be checked, got %d", fake.registerCalls)
+	}
+	if len(report.Events) != 1 || report.Events[0].Action != storage.JobActionFailed || report.Events[0].Phase.String != storage.JobPhaseOwnership {
+		t.Fatalf("expected an ownership failure, got %+v", report.Events)
+	}
+}
+
 type fakeNomad struct {
 	lastJob          *api.Job
 	lastSubmission   *api.JobSubmission
 	registeredJobIDs []string
 	deregistered     []string
-	registerCalls    int
-	planResponses    map[string]*api.JobPlanResponse
-	planErr          error
-	planFn           func(job *api.Job) (*api.JobPlanResponse, error)
-	planCalls        int
-	jobStatusErr     error
-	jobStatuses      map[string]*nomadclient.JobStatus
+	// deregisteredNamespaces holds the namespace of each deregistration.
+	deregisteredNamespaces []string
+	registerCalls          int
+	planResponses          map[string]*api.JobPlanResponse
+	planErr                error
+	planFn                 func(job *api.Job) (*api.JobPlanResponse, error)
+	planCalls              int
+	jobStatusErr           error
+	jobStatuses            map[string]*nomadclient.JobStatus
+	jobs                   []nomadclient.JobStub
+	jobVersion             uint64
+	deployments            map[string]*nomadclient.Deployment
+	reverted               []string
 }
 
 func strPtr(s string) *string {
@@ -651,7 +828,8 @@ func (f *fakeNomad) RegisterJob(_ context.Context, job *api.Job, submission *api
 	return nil
 }
 
-func (f *fakeNomad) DeregisterJob(_ context.Context, jobID string, _ bool) error {
+func (f *fakeNomad) DeregisterJob(_ context.Context, namespace, jobID string, _ bool) error {
+	f.deregisteredNamespaces = append(f.deregisteredNamespaces, namespace)
 	if f.lastJob != nil && f.lastJob.ID != nil && *f.lastJob.ID == jobID {
 		f.lastJob = nil
 	}
@@ -659,11 +837,31 @@ func (f *fakeNomad) DeregisterJob(_ context.Context, jobID string, _ bool) error
 	return nil
 }
 
+func (f *fakeNomad) ListJobs(context.Context) ([]nomadclient.JobStub, error) {
+	return f.jobs, nil
+}
+
+func (f *fakeNomad) JobVersion(context.Context, string, string) (uint64, error) {
+	return f.jobVersion, nil
+}
+
+func (f *fakeNomad) LatestDeployment(_ context.Context, _ string, jobID string) (*nomadclient.Deployment, error) {
+	return f.deployments[jobID], nil
+}
+
+func (f *fakeNomad) RevertToStable(_ context.Context, _ string, jobID string, failedVersion uint64) (uint64, bool, error) {
+	if failedVersion == 0 {
+		return 0, false, nil
+	}
+	f.reverted = append(f.reverted, jobID)
+	return failedVersion - 1, true, nil
+}
+
 func (f *fakeNomad) Ping(context.Context) error {
 	return nil
 }
 
-func (f *fakeNomad) JobStatus(_ context.Context, jobID string) (*nomadclient.JobStatus, error) {
+func (f *fakeNomad) JobStatus(_ context.Context, _ string, jobID string) (*nomadclient.JobStatus, error) {
 	if f.jobStatusErr != nil {
 		return nil, f.jobStatusErr
 	}
@@ -687,6 +885,7 @@ func (f *fakeNomad) JobStatus(_ context.Context, jobID string) (*nomadclient.Job
 		Name:   name,
 		Status: "running",
 		Exists: true,
+		Meta:   f.lastJob.Meta,
 	}, nil
 }
 
@@ -706,3 +905,569 @@ func (f *fakeNomad) PlanJob(_ context.Context, job *api.Job) (*api.JobPlanRespon
 	}
 	return &api.JobPlanResponse{}, nil
 }
+
+func TestFinishRunRecordsHistory(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "test.sqlite")
+	db, err := storage.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	repoStore := storage.NewRepoStore(db, nil)
+	fileStore := storage.NewRepoFileStore(db)
+	historyStore := storage.NewHistoryStore(db)
+
+	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{
+		Name:    "demo",
+		RepoURL: "https://example.com/demo.git",
+		Branch:  "main",
+	})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+
+	m := &Manager{
+		files:   fileStore,
+		history: historyStore,
+		nomad:   &fakeNomad{},
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "abc123",
+		JobFiles: []repomodel.JobFile{
+			{Path: ".nomad/good.nomad.hcl", Content: []byte(`job "good" { datacenters = ["dc1"] }`)},
+			{Path: ".nomad/bad.nomad.hcl", Content: []byte(`job "bad" {`)},
+		},
+	}
+
+	run := m.startRun(ctx, repoRecord)
+	if run == nil {
+		t.Fatal("expected run to be started")
+	}
+	report, err := m.ensureJobs(ctx, repoRecord, snapshot, true)
+	if err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	m.finishRun(ctx, repoRecord, run, snapshot, report, nil)
+
+	runs, err := historyStore.ListRuns(ctx, repoRecord.ID, storage.Page{})
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(runs))
+	}
+	if runs[0].Outcome != storage.RunOutcomePartial {
+		t.Fatalf("expected partial outcome, got %s", runs[0].Outcome)
+	}
+	if runs[0].Summary != "1 applied, 1 failed" {
+		t.Fatalf("unexpected summary: %q", runs[0].Summary)
+	}
+	if runs[0].Commit.String != "abc123" {
+		t.Fatalf("unexpected commit: %+v", runs[0].Commit)
+	}
+
+	events, err := historyStore.ListEvents(ctx, storage.EventFilter{RunID: run.ID})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	byPath := map[string]storage.JobEvent{}
+	for _, event := range events {
+		byPath[event.Path] = event
+	}
+	if got := byPath[".nomad/good.nomad.hcl"]; got.Action != storage.JobActionApplied || got.JobID.String != "good" {
+		t.Fatalf("unexpected applied event: %+v", got)
+	}
+	if got := byPath[".nomad/bad.nomad.hcl"]; got.Action != storage.JobActionFailed || got.Phase.String != storage.JobPhaseParse || !got.Error.Valid {
+		t.Fatalf("unexpected failed event: %+v", got)
+	}
+}
+
+func TestEnsureJobsHoldsChangesForManualPolicy(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "test.sqlite")
+	db, err := storage.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	repoStore := storage.NewRepoStore(db, nil)
+	fileStore := storage.NewRepoFileStore(db)
+	pendingStore := storage.NewPendingChangeStore(db)
+
+	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{
+		Name:       "demo",
+		RepoURL:    "https://example.com/demo.git",
+		Branch:     "main",
+		SyncPolicy: storage.SyncPolicyManual,
+	})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+
+	if err := fileStore.Upsert(ctx, repoRecord.ID, ".nomad/removed.nomad.hcl", "old", "removed-job", ""); err != nil {
+		t.Fatalf("upsert repo file: %v", err)
+	}
+
+	fake := &fakeNomad{
+		planResponses: map[string]*api.JobPlanResponse{
+			"demo": {Diff: &api.JobDiff{Type: "Added", ID: "demo"}},
+		},
+	}
+	m := &Manager{
+		files:   fileStore,
+		pending: pendingStore,
+		nomad:   fake,
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "new",
+		JobFiles: []repomodel.JobFile{{
+			Path:    ".nomad/demo.nomad.hcl",
+			Content: []byte(`job "demo" { datacenters = ["dc1"] }`),
+		}},
+	}
+
+	report, err := m.ensureJobs(ctx, repoRecord, snapshot, true)
+	if err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+
+	if fake.registerCalls != 0 || len(fake.deregistered) != 0 {
+		t.Fatalf("expected no writes to nomad, got %d registrations and %v deregistrations", fake.registerCalls, fake.deregistered)
+	}
+	if fake.planCalls != 1 {
+		t.Fatalf("expected new job to be planned for review, got %d plan calls", fake.planCalls)
+	}
+	if got := report.count(storage.JobActionPending); got != 2 {
+		t.Fatalf("expected 2 pending events, got %d", got)
+	}
+
+	changes, err := pendingStore.ListByRepo(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("list pending: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 pending changes, got %d", len(changes))
+	}
+	if changes[0].Path != ".nomad/demo.nomad.hcl" || changes[0].Action != storage.PendingActionApply || !changes[0].Diff.Valid || changes[0].Commit.String != "new" {
+		t.Fatalf("unexpected apply change: %+v", changes[0])
+	}
+	if changes[1].Path != ".nomad/removed.nomad.hcl" || changes[1].Action != storage.PendingActionRemove {
+		t.Fatalf("unexpected remove change: %+v", changes[1])
+	}
+
+	files, err := fileStore.ListByRepo(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("list repo files: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != ".nomad/removed.nomad.hcl" {
+		t.Fatalf("expected tracking left untouched, got %+v", files)
+	}
+
+	approved := *repoRecord
+	approved.SyncPolicy = storage.SyncPolicyAuto
+	if _, err := m.ensureJobs(ctx, &approved, snapshot, true); err != nil {
+		t.Fatalf("ensure jobs after approval: %v", err)
+	}
+	if fake.registerCalls != 1 || len(fake.deregistered) != 1 {
+		t.Fatalf("expected approved changes applied, got %d registrations and %v deregistrations", fake.registerCalls, fake.deregistered)
+	}
+	changes, err = pendingStore.ListByRepo(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("list pending: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected pending changes cleared, got %d", len(changes))
+	}
+}
+
+func TestEnsureJobsReportsDriftForDetectPolicy(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "test.sqlite")
+	db, err := storage.Open(dbPath)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	fake := &fakeNomad{}
+	m := &Manager{
+		files:  storage.NewRepoFileStore(db),
+		nomad:  fake,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	repoRecord := &storage.Repository{ID: 1, Name: "demo", SyncPolicy: storage.SyncPolicyDetect}
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "new",
+		JobFiles: []repomodel.JobFile{{
+			Path:    ".nomad/demo.nomad.hcl",
+			Content: []byte(`job "demo" { datacenters = ["dc1"] }`),
+		}},
+	}
+
+	report, err := m.ensureJobs(ctx, repoRecord, snapshot, true)
+	if err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	if fake.registerCalls != 0 {
+		t.Fatalf("expected detect policy never to register, got %d", fake.registerCalls)
+	}
+	if got := report.count(storage.JobActionDrifted); got != 1 {
+		t.Fatalf("expected drift reported, got %d", got)
+	}
+}
+
+func TestEnsureJobsKeepsJobWhenFileRenamed(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	repoStore := storage.NewRepoStore(db, nil)
+	fileStore := storage.NewRepoFileStore(db)
+
+	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{Name: "demo", RepoURL: "https://example.com/demo.git", Branch: "main"})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+	if err := fileStore.Upsert(ctx, repoRecord.ID, ".nomad/api.nomad", "old", "api", ""); err != nil {
+		t.Fatalf("upsert repo file: %v", err)
+	}
+
+	fake := &fakeNomad{jobStatuses: map[string]*nomadclient.JobStatus{
+		"api": {ID: "api", Exists: true, Meta: map[string]string{
+			compassMetaRepoURL: repoRecord.RepoURL,
+			compassMetaJobFile: ".nomad/api.nomad",
+		}},
+	}}
+	m := &Manager{
+		files:  fileStore,
+		nomad:  fake,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "new",
+		JobFiles:   []repomodel.JobFile{{Path: ".nomad/api.nomad.hcl", Content: []byte(`job "api" { datacenters = ["dc1"] }`)}},
+	}
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+
+	if fake.registerCalls != 1 {
+		t.Fatalf("expected job registered from its new path, got %d", fake.registerCalls)
+	}
+	if len(fake.deregistered) != 0 {
+		t.Fatalf("expected renamed job to stay registered, got %v", fake.deregistered)
+	}
+	files, err := fileStore.ListByRepo(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("list repo files: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != ".nomad/api.nomad.hcl" || files[0].JobID.String != "api" {
+		t.Fatalf("expected tracking moved to new path, got %+v", files)
+	}
+}
+
+func TestEnsureJobsDeregistersReplacedJobID(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	repoStore := storage.NewRepoStore(db, nil)
+	fileStore := storage.NewRepoFileStore(db)
+
+	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{Name: "demo", RepoURL: "https://example.com/demo.git", Branch: "main"})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+	jobPath := ".nomad/api.nomad.hcl"
+	if err := fileStore.Upsert(ctx, repoRecord.ID, jobPath, "old", "api", ""); err != nil {
+		t.Fatalf("upsert repo file: %v", err)
+	}
+
+	fake := &fakeNomad{
+		jobStatuses: map[string]*nomadclient.JobStatus{
+			"api": {ID: "api", Exists: true, Meta: map[string]string{compassMetaRepoURL: repoRecord.RepoURL, compassMetaJobFile: jobPath}},
+		},
+		planResponses: map[string]*api.JobPlanResponse{
+			"api-v2": {Diff: &api.JobDiff{Type: "Added", Fields: []*api.FieldDiff{{Name: "Datacenters", New: "dc1"}}}},
+		},
+	}
+	m := &Manager{
+		files:  fileStore,
+		nomad:  fake,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "new",
+		JobFiles:   []repomodel.JobFile{{Path: jobPath, Content: []byte(`job "api-v2" { datacenters = ["dc1"] }`)}},
+	}
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+
+	if len(fake.registeredJobIDs) != 1 || fake.registeredJobIDs[0] != "api-v2" {
+		t.Fatalf("expected api-v2 registered, got %v", fake.registeredJobIDs)
+	}
+	if len(fake.deregistered) != 1 || fake.deregistered[0] != "api" {
+		t.Fatalf("expected replaced job deregistered, got %v", fake.deregistered)
+	}
+}
+
+func TestEnsureJobsRecordsFileErrors(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	fileStore := storage.NewRepoFileStore(db)
+	fake := &fakeNomad{}
+	m := &Manager{
+		files:  fileStore,
+		nomad:  fake,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	repoRecord := &storage.Repository{ID: 1, Name: "demo"}
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "broken",
+		JobFiles:   []repomodel.JobFile{{Path: ".nomad/demo.nomad.hcl", Content: []byte(`job "demo" {`)}},
+	}
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+
+	files, err := fileStore.ListByRepo(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("list repo files: %v", err)
+	}
+	if len(files) != 1 || files[0].LastErrorPhase.String != storage.JobPhaseParse || files[0].LastError.String == "" || files[0].JobID.Valid {
+		t.Fatalf("expected parse error recorded, got %+v", files)
+	}
+
+	snapshot = &repomodel.Snapshot{
+		CommitHash: "fixed",
+		JobFiles:   []repomodel.JobFile{{Path: ".nomad/demo.nomad.hcl", Content: []byte(`job "demo" { datacenters = ["dc1"] }`)}},
+	}
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	if fake.registerCalls != 1 {
+		t.Fatalf("expected fixed job registered, got %d", fake.registerCalls)
+	}
+	files, err = fileStore.ListByRepo(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("list repo files: %v", err)
+	}
+	if len(files) != 1 || files[0].LastError.Valid || files[0].JobID.String != "demo" {
+		t.Fatalf("expected error cleared after fix, got %+v", files)
+	}
+}
+
+func TestEnsureJobsBlocksPolicyViolations(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	fake := &fakeNomad{}
+	fileStore := storage.NewRepoFileStore(db)
+	m := &Manager{
+		files:     fileStore,
+		nomad:     fake,
+		jobPolicy: jobpolicy.Rules{DenyPrivileged: true},
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	repoRecord := &storage.Repository{ID: 1, Name: "demo", JobPolicy: jobpolicy.Rules{AllowedDatacenters: []string{"dc1"}}}
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "new",
+		JobFiles: []repomodel.JobFile{
+			{Path: ".nomad/api.nomad.hcl", Content: []byte(`job "api" {
+  datacenters = ["dc1"]
+  group "api" {
+    task "api" {
+      driver = "docker"
+      config {
+        image      = "api"
+        privileged = true
+      }
+    }
+  }
+}`)},
+			{Path: ".nomad/web.nomad.hcl", Content: []byte(`job "web" {
+  datacenters = ["dc2"]
+}`)},
+			{Path: ".nomad/ok.nomad.hcl", Content: []byte(`job "ok" {
+  datacenters = ["dc1"]
+}`)},
+		},
+	}
+	report, err := m.ensureJobs(ctx, repoRecord, snapshot, true)
+	if err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	if len(fake.registeredJobIDs) != 1 || fake.registeredJobIDs[0] != "ok" {
+		t.Fatalf("expected only the compliant job registered, got %v", fake.registeredJobIDs)
+	}
+	errs := report.fileErrors()
+	for _, path := range []string{".nomad/api.nomad.hcl", ".nomad/web.nomad.hcl"} {
+		if errs[path].Phase != storage.JobPhasePolicy {
+			t.Fatalf("expected policy error for %s, got %+v", path, errs)
+		}
+	}
+}
+
+func TestParseJobAppliesOverlay(t *testing.T) {
+	jobFile := repomodel.JobFile{
+		Path: ".nomad/api.nomad.hcl",
+		Content: []byte(`job "api" {
+  datacenters = ["dev"]
+  meta = {
+    team = "platform"
+  }
+  group "api" {
+    count = 1
+    task "api" {
+      driver = "docker"
+      config {
+        image = "api:1"
+        ports = ["http"]
+      }
+    }
+    task "proxy" {
+      driver = "docker"
+      config { image = "envoy" }
+    }
+  }
+}`),
+		Overlay: &repomodel.OverlayFile{
+			Path: "overlays/prod/api.nomad.hcl",
+			Content: []byte(`job "api" {
+  datacenters = ["prod-east", "prod-west"]
+  group "api" {
+    count = 5
+    task "api" {
+      config { image = "api:2" }
+    }
+  }
+  group "worker" {
+    task "worker" {
+      driver = "exec"
+    }
+  }
+}`),
+		},
+	}
+
+	job, submission, err := parseJob(context.Background(), jobFile, nil)
+	if err != nil {
+		t.Fatalf("parse job: %v", err)
+	}
+	if submission == nil || submission.Source != string(jobFile.Content) {
+		t.Fatalf("expected the base file submitted, got %#v", submission)
+	}
+	if len(job.Datacenters) != 2 || job.Datacenters[0] != "prod-east" {
+		t.Fatalf("expected overlay datacenters, got %v", job.Datacenters)
+	}
+	if job.Meta["team"] != "platform" {
+		t.Fatalf("expected base meta kept, got %v", job.Meta)
+	}
+	if len(job.TaskGroups) != 2 || *job.TaskGroups[1].Name != "worker" {
+		t.Fatalf("expected overlay group appended, got %d groups", len(job.TaskGroups))
+	}
+	group := job.TaskGroups[0]
+	if *group.Count != 5 || len(group.Tasks) != 2 {
+		t.Fatalf("unexpected merged group: count %d, %d tasks", *group.Count, len(group.Tasks))
+	}
+	task := group.Tasks[0]
+	if task.Driver != "docker" || task.Config["image"] != "api:2" || task.Config["ports"] == nil {
+		t.Fatalf("unexpected merged task: %#v", task)
+	}
+
+	jobFile.Overlay.Content = []byte(`job "other" {}`)
+	if _, _, err := parseJob(context.Background(), jobFile, nil); err == nil {
+		t.Fatal("expected an overlay for a different job to fail")
+	}
+}
+
+func TestEnsureJobsRegistersOverlaidJob(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	fake := &fakeNomad{}
+	m := &Manager{
+		files:  storage.NewRepoFileStore(db),
+		nomad:  fake,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "new",
+		JobFiles: []repomodel.JobFile{{
+			Path:    ".nomad/api.nomad.hcl",
+			Content: []byte(`job "api" { datacenters = ["dev"] }`),
+			Overlay: &repomodel.OverlayFile{Path: "overlays/prod/api.nomad.hcl", Content: []byte(`job "api" { datacenters = ["prod"] }`)},
+		}},
+	}
+	if _, err := m.ensureJobs(ctx, &storage.Repository{ID: 1, Name: "demo"}, snapshot, true); err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	if fake.registerCalls != 1 || fake.lastSubmission == nil || fake.lastSubmission.Source != string(snapshot.JobFiles[0].Content) {
+		t.Fatalf("expected overlaid job registered with the base submission, got %d calls, %#v", fake.registerCalls, fake.lastSubmission)
+	}
+	if got := fake.lastJob.Meta[compassMetaOverlay]; got != "overlays/prod/api.nomad.hcl" {
+		t.Fatalf("expected overlay path in meta, got %q", got)
+	}
+	if len(fake.lastJob.Datacenters) != 1 || fake.lastJob.Datacenters[0] != "prod" {
+		t.Fatalf("expected overlay applied, got %v", fake.lastJob.Datacenters)
+	}
+}
@@ -0,0 +1,73 @@
+package reconcile
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+var (
+	passDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "nomad_compass_reconcile_duration_seconds",
+		Help: "Duration of reconcile passes by outcome.",
+		// Passes that register jobs can take minutes.
+		Buckets: prometheus.ExponentialBucketsRange(0.01, 300, 14),
+	}, []string{"outcome"})
+	passCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nomad_compass_reconcile_runs_total",
+		Help: "Reconcile passes by outcome.",
+	}, []string{"outcome"})
+	lastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nomad_compass_repo_last_success_timestamp_seconds",
+		Help: "When each repository last reconciled without errors.",
+	}, []string{"repo"})
+	jobsApplied = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nomad_compass_jobs_applied_total",
+		Help: "Jobs registered with Nomad.",
+	}, []string{"repo"})
+	jobsDeregistered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nomad_compass_jobs_deregistered_total",
+		Help: "Jobs deregistered from Nomad.",
+	}, []string{"repo"})
+	jobsDrifted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nomad_compass_jobs_drifted_total",
+		Help: "Jobs found to differ from the repository on an unchanged commit.",
+	}, []string{"repo"})
+)
+
+// recordPass publishes metrics for a finished pass.
+func recordPass(repoRecord *storage.Repository, snapshot *repo.Snapshot, report *reconcileReport, err error, start time.Time) {
+	outcome := runOutcome(report, err)
+	passDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+	passCount.WithLabelValues(outcome).Inc()
+	if outcome == storage.RunOutcomeSucceeded {
+		lastSuccess.WithLabelValues(repoRecord.Name).SetToCurrentTime()
+	}
+	if report == nil {
+		return
+	}
+	sameCommit := unchangedCommit(repoRecord, snapshot)
+	for _, event := range report.Events {
+		switch event.Action {
+		case storage.JobActionApplied:
+			jobsApplied.WithLabelValues(repoRecord.Name).Inc()
+			if sameCommit {
+				jobsDrifted.WithLabelValues(repoRecord.Name).Inc()
+			}
+		case storage.JobActionDrifted:
+			jobsDrifted.WithLabelValues(repoRecord.Name).Inc()
+		case storage.JobActionRemoved:
+			jobsDeregistered.WithLabelValues(repoRecord.Name).Inc()
+		}
+	}
+}
+
+// unchangedCommit reports whether the pass synced the commit the repository
+// was already at, so any apply corrected drift.
+func unchangedCommit(repoRecord *storage.Repository, snapshot *repo.Snapshot) bool {
+	return snapshot != nil && repoRecord.LastCommit.Valid && repoRecord.LastCommit.String == snapshot.CommitHash
+}
@@ -0,0 +1,40 @@
+package reconcile
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	repomodel "github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func TestRecordPassPublishesMetrics(t *testing.T) {
+	repoRecord := &storage.Repository{ID: 1, Name: "metrics-demo", LastCommit: sql.NullString{String: "abc", Valid: true}}
+	report := &reconcileReport{}
+	report.add("api.nomad.hcl", "api", storage.JobActionApplied, storage.JobPhaseApply, "job missing from Nomad")
+	report.add("old.nomad.hcl", "old", storage.JobActionRemoved, storage.JobPhaseDeregister, "job file removed from repository")
+	recordPass(repoRecord, &repomodel.Snapshot{CommitHash: "abc"}, report, nil, time.Now())
+	recordPass(repoRecord, nil, nil, errors.New("clone failed"), time.Now())
+
+	for name, c := range map[string]prometheus.Collector{
+		"applied":      jobsApplied.WithLabelValues("metrics-demo"),
+		"drifted":      jobsDrifted.WithLabelValues("metrics-demo"),
+		"deregistered": jobsDeregistered.WithLabelValues("metrics-demo"),
+	} {
+		if got := testutil.ToFloat64(c); got != 1 {
+			t.Fatalf("expected 1 %s, got %v", name, got)
+		}
+	}
+	// Other tests run failing passes too.
+	if got := testutil.ToFloat64(passCount.WithLabelValues(storage.RunOutcomeFailed)); got < 1 {
+		t.Fatalf("expected a failed run counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(lastSuccess.WithLabelValues("metrics-demo")); got == 0 {
+		t.Fatal("expected a last success timestamp")
+	}
+}
@@ -0,0 +1,30 @@
+package reconcile
+
+import (
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// jobNamespace returns the namespace job is registered in on target.
+func jobNamespace(target nomadclient.Target, job *api.Job) string {
+	if job != nil && job.Namespace != nil && *job.Namespace != "" {
+		return *job.Namespace
+	}
+	return target.DefaultNamespace()
+}
+
+// fileNamespace returns the namespace the job tracked for file was registered
+// in. Files tracked before namespaces were recorded use the default.
+func fileNamespace(target nomadclient.Target, file storage.RepoFile) string {
+	if file.Namespace.Valid && file.Namespace.String != "" {
+		return file.Namespace.String
+	}
+	return target.DefaultNamespace()
+}
+
+// jobKey identifies a job across namespaces.
+func jobKey(namespace, jobID string) string {
+	return namespace + "/" + jobID
+}
@@ -0,0 +1,107 @@
+package reconcile
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	repomodel "github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func TestEnsureJobsRejectsDisallowedNamespace(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	fake := &fakeNomad{}
+	m := &Manager{
+		files:  storage.NewRepoFileStore(db),
+		nomad:  fake,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	repoRecord := &storage.Repository{ID: 1, Name: "demo", Namespaces: []string{"web"}}
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "new",
+		JobFiles: []repomodel.JobFile{
+			{Path: ".nomad/db.nomad.hcl", Content: []byte(`job "db" {
+  namespace   = "payments"
+  datacenters = ["dc1"]
+}`)},
+			{Path: ".nomad/site.nomad.hcl", Content: []byte(`job "site" {
+  namespace   = "web"
+  datacenters = ["dc1"]
+}`)},
+		},
+	}
+
+	report, err := m.ensureJobs(ctx, repoRecord, snapshot, true)
+	if err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	if len(fake.registeredJobIDs) != 1 || fake.registeredJobIDs[0] != "site" {
+		t.Fatalf("expected only the allowed namespace registered, got %v", fake.registeredJobIDs)
+	}
+	if len(report.Events) == 0 || report.Events[0].Phase.String != storage.JobPhaseNamespace {
+		t.Fatalf("expected namespace failure, got %+v", report.Events)
+	}
+}
+
+func TestEnsureJobsMovesJobBetweenNamespaces(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	fileStore := storage.NewRepoFileStore(db)
+	if err := fileStore.Upsert(ctx, 1, ".nomad/api.nomad.hcl", "old", "api", "payments"); err != nil {
+		t.Fatalf("upsert repo file: %v", err)
+	}
+
+	fake := &fakeNomad{}
+	m := &Manager{
+		files:  fileStore,
+		nomad:  fake,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	repoRecord := &storage.Repository{ID: 1, Name: "demo"}
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "new",
+		JobFiles: []repomodel.JobFile{{Path: ".nomad/api.nomad.hcl", Content: []byte(`job "api" {
+  namespace   = "billing"
+  datacenters = ["dc1"]
+}`)}},
+	}
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+
+	if fake.registerCalls != 1 {
+		t.Fatalf("expected job registered in its new namespace, got %d", fake.registerCalls)
+	}
+	if len(fake.deregistered) != 1 || fake.deregistered[0] != "api" || fake.deregisteredNamespaces[0] != "payments" {
+		t.Fatalf("expected old job deregistered from payments, got %v in %v", fake.deregistered, fake.deregisteredNamespaces)
+	}
+	files, err := fileStore.ListByRepo(ctx, 1)
+	if err != nil {
+		t.Fatalf("list repo files: %v", err)
+	}
+	if len(files) != 1 || files[0].Namespace.String != "billing" {
+		t.Fatalf("expected namespace tracked, got %+v", files)
+	}
+}
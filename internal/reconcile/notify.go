@@ -0,0 +1,82 @@
+package reconcile
+
+import (
+	"errors"
+
+	"github.com/brianmichel/nomad-compass/internal/notify"
+	"github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// Notifier receives events as reconciliation produces them. Notify must not
+// block.
+type Notifier interface {
+	Notify(event notify.Event)
+}
+
+// emitEvents turns the outcome of a pass into notifications. Applies on an
+// unchanged commit are drift corrections. Only failures to change a job in
+// Nomad are reported, and only when they differ from the file's last stored
+// failure; a broken jobspec fails the same way on every poll.
+func (m *Manager) emitEvents(repoRecord *storage.Repository, snapshot *repo.Snapshot, report *reconcileReport, err error) {
+	if m.notifier == nil {
+		return
+	}
+	var commit string
+	if snapshot != nil {
+		commit = snapshot.CommitHash
+	}
+	base := notify.Event{RepoID: repoRecord.ID, Repo: repoRecord.Name, Commit: commit}
+	if err != nil && !errors.Is(err, ErrPendingChangesStale) {
+		event := base
+		event.Type = notify.EventSyncFailed
+		event.Message = err.Error()
+		m.notifier.Notify(event)
+	}
+	if report == nil {
+		return
+	}
+	sameCommit := unchangedCommit(repoRecord, snapshot)
+	for _, jobEvent := range report.Events {
+		event := base
+		event.Path = jobEvent.Path
+		event.JobID = jobEvent.JobID.String
+		event.Message = jobEvent.Summary
+		switch jobEvent.Action {
+		case storage.JobActionApplied:
+			event.Type = notify.EventJobApplied
+			if sameCommit {
+				event.Type = notify.EventDriftCorrected
+			}
+		case storage.JobActionFailed:
+			if !notifiedPhase(jobEvent.Phase.String) || report.repeatsFailure(jobEvent) {
+				continue
+			}
+			event.Type = notify.EventApplyFailed
+			if jobEvent.Error.Valid {
+				event.Message = jobEvent.Error.String
+			}
+		case storage.JobActionUnhealthy:
+			event.Type = notify.EventApplyFailed
+			if jobEvent.Error.Valid {
+				event.Message = jobEvent.Error.String
+			}
+		case storage.JobActionRemoved:
+			event.Type = notify.EventJobRemoved
+		default:
+			continue
+		}
+		m.notifier.Notify(event)
+	}
+}
+
+// notifiedPhase reports whether failures in phase are sent as apply_failed.
+// Parse, policy and other checks that reject a job before it reaches Nomad
+// are left to the history and the UI.
+func notifiedPhase(phase string) bool {
+	switch phase {
+	case storage.JobPhaseApply, storage.JobPhaseDeploy, storage.JobPhaseDeregister:
+		return true
+	}
+	return false
+}
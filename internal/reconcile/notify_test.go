@@ -0,0 +1,81 @@
+package reconcile
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/brianmichel/nomad-compass/internal/notify"
+	repomodel "github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+type recordingNotifier struct {
+	events []notify.Event
+}
+
+func (r *recordingNotifier) Notify(event notify.Event) {
+	r.events = append(r.events, event)
+}
+
+func TestEmitEventsClassifiesReport(t *testing.T) {
+	notifier := &recordingNotifier{}
+	m := &Manager{notifier: notifier, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	repoRecord := &storage.Repository{ID: 2, Name: "demo", LastCommit: sql.NullString{String: "old", Valid: true}}
+	report := &reconcileReport{}
+	report.add("api.nomad.hcl", "api", storage.JobActionApplied, storage.JobPhaseApply, "2 to update")
+	report.add("web.nomad.hcl", "web", storage.JobActionUnchanged, "", "no changes")
+	report.add("gone.nomad.hcl", "gone", storage.JobActionRemoved, storage.JobPhaseDeregister, "job file removed from repository")
+	report.failed("db.nomad.hcl", "db", storage.JobPhaseApply, errors.New("register rejected"))
+
+	m.emitEvents(repoRecord, &repomodel.Snapshot{CommitHash: "new"}, report, nil)
+	want := []notify.EventType{notify.EventJobApplied, notify.EventJobRemoved, notify.EventApplyFailed}
+	if len(notifier.events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), notifier.events)
+	}
+	for i, event := range notifier.events {
+		if event.Type != want[i] || event.RepoID != 2 || event.Commit != "new" {
+			t.Fatalf("event %d: unexpected %+v", i, event)
+		}
+	}
+	if notifier.events[2].Message != "register rejected" {
+		t.Fatalf("expected failure message, got %q", notifier.events[2].Message)
+	}
+
+	notifier.events = nil
+	m.emitEvents(repoRecord, &repomodel.Snapshot{CommitHash: "old"}, report, errors.New("clone failed"))
+	if notifier.events[0].Type != notify.EventSyncFailed || notifier.events[1].Type != notify.EventDriftCorrected {
+		t.Fatalf("expected sync failure and drift correction, got %+v", notifier.events)
+	}
+}
+
+func TestEmitEventsSkipsRepeatedAndPreApplyFailures(t *testing.T) {
+	notifier := &recordingNotifier{}
+	m := &Manager{notifier: notifier, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	repoRecord := &storage.Repository{ID: 2, Name: "demo"}
+
+	report := &reconcileReport{PreviousErrors: map[string]storage.FileError{
+		"api.nomad.hcl": {Phase: storage.JobPhaseApply, Message: "register rejected"},
+		"web.nomad.hcl": {Phase: storage.JobPhaseApply, Message: "register rejected"},
+	}}
+	report.failed("api.nomad.hcl", "api", storage.JobPhaseApply, errors.New("register rejected"))
+	report.failed("web.nomad.hcl", "web", storage.JobPhaseApply, errors.New("permission denied"))
+	report.failed("bad.nomad.hcl", "", storage.JobPhaseParse, errors.New("bad hcl"))
+	report.failed("big.nomad.hcl", "big", storage.JobPhasePolicy, errors.New("privileged"))
+	report.failed("old.nomad.hcl", "old", storage.JobPhaseDeregister, errors.New("deregister failed"))
+
+	m.emitEvents(repoRecord, &repomodel.Snapshot{CommitHash: "new"}, report, nil)
+	var paths []string
+	for _, event := range notifier.events {
+		if event.Type != notify.EventApplyFailed {
+			t.Fatalf("unexpected event %+v", event)
+		}
+		paths = append(paths, event.Path)
+	}
+	if len(paths) != 2 || paths[0] != "web.nomad.hcl" || paths[1] != "old.nomad.hcl" {
+		t.Fatalf("expected only the changed apply failure and the deregister failure, got %v", paths)
+	}
+}
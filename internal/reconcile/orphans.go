@@ -0,0 +1,291 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// OrphanPolicy controls what the orphan scan does with jobs compass
+// registered but no longer tracks.
+type OrphanPolicy string
+
+const (
+	// OrphanPolicyReport only reports orphaned jobs through the API.
+	OrphanPolicyReport OrphanPolicy = "report"
+	// OrphanPolicyAdopt starts tracking orphans whose repository still exists.
+	OrphanPolicyAdopt OrphanPolicy = "adopt"
+	// OrphanPolicyPrune adopts orphans whose repository still exists and
+	// deregisters the rest.
+	OrphanPolicyPrune OrphanPolicy = "prune"
+)
+
+// Valid reports whether p is a known orphan policy.
+func (p OrphanPolicy) Valid() bool {
+	switch p {
+	case OrphanPolicyReport, OrphanPolicyAdopt, OrphanPolicyPrune:
+		return true
+	}
+	return false
+}
+
+// AnyCluster matches orphans in every cluster when looking one up.
+const AnyCluster int64 = -1
+
+var (
+	// ErrOrphanNotFound is returned when a job is not an orphan.
+	ErrOrphanNotFound = errors.New("orphaned job not found")
+	// ErrOrphanNoRepository is returned when adopting an orphan whose
+	// repository is not onboarded.
+	ErrOrphanNoRepository = errors.New("no repository matches the orphaned job")
+	// ErrOrphanAmbiguous is returned when a job ID is orphaned in more than
+	// one namespace or cluster and neither was given.
+	ErrOrphanAmbiguous = errors.New("orphaned job exists in several namespaces or clusters; specify one")
+)
+
+// OrphanJob is a Nomad job carrying compass metadata that no tracked job file
+// owns, for example after a repository was deleted without unscheduling.
+type OrphanJob struct {
+	JobID     string
+	Namespace string
+	// ClusterID is the cluster running the job; zero is the default cluster.
+	ClusterID int64
+	Status    string
+	RepoURL   string
+	RepoName  string
+	JobFile   string
+	Commit    string
+	// RepoID is the onboarded repository matching RepoURL on the same
+	// cluster, or zero.
+	RepoID int64
+}
+
+// Orphans lists the orphaned jobs currently registered in every cluster.
+// Stored clusters that cannot be reached are skipped.
+func (m *Manager) Orphans(ctx context.Context) ([]OrphanJob, error) {
+	clusterIDs := []int64{nomadclient.DefaultCluster}
+	if m.clusters != nil {
+		clusters, err := m.clusters.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, cluster := range clusters {
+			clusterIDs = append(clusterIDs, cluster.ID)
+		}
+	}
+	repos, err := m.repos.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files, err := m.files.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make(map[int64]nomadclient.Target, len(clusterIDs))
+	jobs := make(map[int64][]nomadclient.JobStub, len(clusterIDs))
+	for _, id := range clusterIDs {
+		target, err := m.targetByID(ctx, id)
+		var stubs []nomadclient.JobStub
+		if err == nil {
+			stubs, err = target.Client.ListJobs(ctx)
+		}
+		if err != nil {
+			if id == nomadclient.DefaultCluster {
+				return nil, err
+			}
+			m.logger.Warn("orphan scan skipped cluster", "cluster_id", id, "error", err)
+			continue
+		}
+		targets[id] = target
+		jobs[id] = stubs
+	}
+
+	repoByID := make(map[int64]*storage.Repository, len(repos))
+	repoIDs := make(map[string]int64, len(repos))
+	for i := range repos {
+		repo := &repos[i]
+		repoByID[repo.ID] = repo
+		key := clusterKey(clusterID(repo), repo.RepoURL)
+		if _, ok := repoIDs[key]; !ok {
+			repoIDs[key] = repo.ID
+		}
+	}
+	ownedIDs := make(map[string]struct{}, len(files))
+	ownedFiles := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		repo := repoByID[file.RepoID]
+		if repo == nil {
+			continue
+		}
+		cluster := clusterID(repo)
+		target, ok := targets[cluster]
+		if !ok {
+			continue
+		}
+		if file.JobID.Valid && file.JobID.String != "" {
+			ownedIDs[clusterKey(cluster, jobKey(fileNamespace(target, file), file.JobID.String))] = struct{}{}
+		}
+		ownedFiles[clusterKey(cluster, repo.RepoURL+"\x00"+file.Path)] = struct{}{}
+	}
+
+	var orphans []OrphanJob
+	for _, cluster := range clusterIDs {
+		target, ok := targets[cluster]
+		if !ok {
+			continue
+		}
+		for _, job := range jobs[cluster] {
+			repoURL := job.Meta[compassMetaRepoURL]
+			if repoURL == "" {
+				continue
+			}
+			namespace := job.Namespace
+			if namespace == "" {
+				namespace = target.DefaultNamespace()
+			}
+			if _, ok := ownedIDs[clusterKey(cluster, jobKey(namespace, job.ID))]; ok {
+				continue
+			}
+			jobFile := job.Meta[compassMetaJobFile]
+			if _, ok := ownedFiles[clusterKey(cluster, repoURL+"\x00"+jobFile)]; ok {
+				continue
+			}
+			orphans = append(orphans, OrphanJob{
+				JobID:     job.ID,
+				Namespace: namespace,
+				ClusterID: cluster,
+				Status:    job.Status,
+				RepoURL:   repoURL,
+				RepoName:  job.Meta[compassMetaRepoName],
+				JobFile:   jobFile,
+				Commit:    job.Meta[compassMetaCommit],
+				RepoID:    repoIDs[clusterKey(cluster, repoURL)],
+			})
+		}
+	}
+	sort.SliceStable(orphans, func(i, j int) bool { return orphans[i].JobID < orphans[j].JobID })
+	return orphans, nil
+}
+
+// AdoptOrphan starts tracking an orphaned job under the repository matching
+// its metadata. The next reconcile of that repository keeps the job if its
+// file still exists and deregisters it otherwise. An empty namespace matches
+// an orphan in any namespace, and AnyCluster one in any cluster.
+func (m *Manager) AdoptOrphan(ctx context.Context, cluster int64, namespace, jobID string) error {
+	orphan, err := m.findOrphan(ctx, cluster, namespace, jobID)
+	if err != nil {
+		return err
+	}
+	return m.adoptOrphan(ctx, *orphan)
+}
+
+// DeregisterOrphan removes an orphaned job from Nomad.
+func (m *Manager) DeregisterOrphan(ctx context.Context, cluster int64, namespace, jobID string) error {
+	orphan, err := m.findOrphan(ctx, cluster, namespace, jobID)
+	if err != nil {
+		return err
+	}
+	target, err := m.targetByID(ctx, orphan.ClusterID)
+	if err != nil {
+		return err
+	}
+	return target.Client.DeregisterJob(ctx, orphan.Namespace, orphan.JobID, true)
+}
+
+// findOrphan returns the orphan with jobID. A job ID that is orphaned in
+// several namespaces or clusters is only found when namespace and cluster
+// narrow it down to one.
+func (m *Manager) findOrphan(ctx context.Context, cluster int64, namespace, jobID string) (*OrphanJob, error) {
+	orphans, err := m.Orphans(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found *OrphanJob
+	for i, orphan := range orphans {
+		if orphan.JobID != jobID || (namespace != "" && orphan.Namespace != namespace) {
+			continue
+		}
+		if cluster != AnyCluster && orphan.ClusterID != cluster {
+			continue
+		}
+		if found != nil {
+			return nil, ErrOrphanAmbiguous
+		}
+		found = &orphans[i]
+	}
+	if found == nil {
+		return nil, ErrOrphanNotFound
+	}
+	return found, nil
+}
+
+func (m *Manager) adoptOrphan(ctx context.Context, orphan OrphanJob) error {
+	if orphan.RepoID == 0 || orphan.JobFile == "" {
+		return ErrOrphanNoRepository
+	}
+	unlock := m.locks.lock(orphan.RepoID)
+	defer unlock()
+
+	// A reconcile may have started tracking the job while we waited.
+	files, err := m.files.ListByRepo(ctx, orphan.RepoID)
+	if err != nil {
+		return err
+	}
+	target, err := m.targetByID(ctx, orphan.ClusterID)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Path == orphan.JobFile || jobKey(fileNamespace(target, file), file.JobID.String) == jobKey(orphan.Namespace, orphan.JobID) {
+			return nil
+		}
+	}
+	if err := m.files.Upsert(ctx, orphan.RepoID, orphan.JobFile, orphan.Commit, orphan.JobID, orphan.Namespace); err != nil {
+		return fmt.Errorf("adopt job %s: %w", orphan.JobID, err)
+	}
+	m.logger.Info("adopted orphaned job", "job", orphan.JobID, "repo_id", orphan.RepoID, "file", orphan.JobFile)
+	return nil
+}
+
+// collectOrphans applies the orphan policy. Orphans belonging to an onboarded
+// repository are only ever adopted, never deregistered, so a repository whose
+// tracking rows were lost cannot have its jobs removed by the scan.
+func (m *Manager) collectOrphans(ctx context.Context) {
+	if m.orphanPolicy == "" || m.orphanPolicy == OrphanPolicyReport {
+		return
+	}
+	orphans, err := m.Orphans(ctx)
+	if err != nil {
+		m.logger.Warn("orphan scan failed", "error", err)
+		return
+	}
+	for _, orphan := range orphans {
+		switch {
+		case orphan.RepoID != 0:
+			if err := m.adoptOrphan(ctx, orphan); err != nil {
+				m.logger.Warn("adopt orphaned job failed", "job", orphan.JobID, "error", err)
+			}
+		case m.orphanPolicy == OrphanPolicyPrune:
+			target, err := m.targetByID(ctx, orphan.ClusterID)
+			if err == nil {
+				err = target.Client.DeregisterJob(ctx, orphan.Namespace, orphan.JobID, true)
+			}
+			if err != nil {
+				m.logger.Warn("deregister orphaned job failed", "job", orphan.JobID, "error", err)
+				continue
+			}
+			m.logger.Info("deregistered orphaned job", "job", orphan.JobID, "repo_url", orphan.RepoURL, "file", orphan.JobFile)
+		}
+	}
+}
+
+// clusterKey scopes key to a cluster.
+func clusterKey(cluster int64, key string) string {
+	return strconv.FormatInt(cluster, 10) + "\x00" + key
+}
@@ -0,0 +1,80 @@
+package reconcile
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func TestOrphansAndPrunePolicy(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	repoStore := storage.NewRepoStore(db, nil)
+	fileStore := storage.NewRepoFileStore(db)
+
+	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{Name: "demo", RepoURL: "https://example.com/demo.git", Branch: "main"})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+	if err := fileStore.Upsert(ctx, repoRecord.ID, ".nomad/tracked.nomad.hcl", "abc", "tracked", ""); err != nil {
+		t.Fatalf("upsert repo file: %v", err)
+	}
+
+	meta := func(repoURL, file string) map[string]string {
+		return map[string]string{compassMetaRepoURL: repoURL, compassMetaJobFile: file, compassMetaCommit: "abc"}
+	}
+	fake := &fakeNomad{jobs: []nomadclient.JobStub{
+		{ID: "tracked", Meta: meta("https://example.com/demo.git", ".nomad/tracked.nomad.hcl")},
+		{ID: "unmanaged"},
+		{ID: "lost", Meta: meta("https://example.com/demo.git", ".nomad/lost.nomad.hcl")},
+		{ID: "deleted-repo", Meta: meta("https://example.com/gone.git", ".nomad/api.nomad")},
+	}}
+	m := &Manager{
+		repos:        repoStore,
+		files:        fileStore,
+		nomad:        fake,
+		orphanPolicy: OrphanPolicyPrune,
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	orphans, err := m.Orphans(ctx)
+	if err != nil {
+		t.Fatalf("list orphans: %v", err)
+	}
+	if len(orphans) != 2 || orphans[0].JobID != "deleted-repo" || orphans[1].JobID != "lost" {
+		t.Fatalf("unexpected orphans: %+v", orphans)
+	}
+	if orphans[0].RepoID != 0 || orphans[1].RepoID != repoRecord.ID {
+		t.Fatalf("expected only the lost job to match a repository: %+v", orphans)
+	}
+
+	m.collectOrphans(ctx)
+
+	if len(fake.deregistered) != 1 || fake.deregistered[0] != "deleted-repo" {
+		t.Fatalf("expected only the unmatched orphan to be deregistered, got %v", fake.deregistered)
+	}
+	files, err := fileStore.ListByRepo(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("list repo files: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected lost job to be adopted, got %+v", files)
+	}
+
+	if err := m.AdoptOrphan(ctx, AnyCluster, "", "tracked"); err != ErrOrphanNotFound {
+		t.Fatalf("expected tracked job not to be an orphan, got %v", err)
+	}
+}
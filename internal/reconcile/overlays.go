@@ -0,0 +1,123 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/repo"
+)
+
+// applyOverlay parses the partial job in jobFile's overlay and merges it into
+// job. The overlay must declare the same job.
+func applyOverlay(ctx context.Context, job *api.Job, jobFile repo.JobFile, variables map[string]string) error {
+	overlayFile := repo.JobFile{
+		Path:     jobFile.Overlay.Path,
+		FullPath: jobFile.Overlay.FullPath,
+		Content:  jobFile.Overlay.Content,
+		VarFiles: jobFile.VarFiles,
+	}
+	overlay, _, err := parseJob(ctx, overlayFile, variables)
+	if err != nil {
+		return fmt.Errorf("overlay: %w", err)
+	}
+	if jobID(overlay) != jobID(job) {
+		return fmt.Errorf("overlay %s declares job %q, not %q", overlayFile.Path, jobID(overlay), jobID(job))
+	}
+	mergeValue(reflect.ValueOf(job).Elem(), reflect.ValueOf(overlay).Elem())
+	return nil
+}
+
+// mergeValue copies everything src sets onto dst. Nil pointers and zero
+// values are treated as unset, structs and maps merge field by field, and
+// lists of named blocks such as groups and tasks merge by name. Other lists
+// replace the base list.
+func mergeValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+		if dst.IsNil() || src.Elem().Kind() != reflect.Struct {
+			dst.Set(src)
+			return
+		}
+		mergeValue(dst.Elem(), src.Elem())
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				mergeValue(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Map:
+		if src.Len() == 0 {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		}
+		iter := src.MapRange()
+		for iter.Next() {
+			dst.SetMapIndex(iter.Key(), iter.Value())
+		}
+	case reflect.Slice:
+		if src.Len() == 0 {
+			return
+		}
+		if !namedElements(src.Type()) {
+			dst.Set(src)
+			return
+		}
+		for i := 0; i < src.Len(); i++ {
+			item := src.Index(i)
+			if match := findNamed(dst, blockName(item)); match.IsValid() {
+				mergeValue(match, item)
+				continue
+			}
+			dst.Set(reflect.Append(dst, item))
+		}
+	default:
+		if !src.IsZero() {
+			dst.Set(src)
+		}
+	}
+}
+
+// namedElements reports whether a slice holds pointers to structs with a
+// Name field, such as task groups, tasks and services.
+func namedElements(t reflect.Type) bool {
+	elem := t.Elem()
+	if elem.Kind() != reflect.Pointer || elem.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	_, ok := elem.Elem().FieldByName("Name")
+	return ok
+}
+
+func blockName(v reflect.Value) string {
+	if v.IsNil() {
+		return ""
+	}
+	name := v.Elem().FieldByName("Name")
+	if name.Kind() == reflect.Pointer {
+		if name.IsNil() {
+			return ""
+		}
+		name = name.Elem()
+	}
+	return name.String()
+}
+
+func findNamed(list reflect.Value, name string) reflect.Value {
+	if name == "" {
+		return reflect.Value{}
+	}
+	for i := 0; i < list.Len(); i++ {
+		if blockName(list.Index(i)) == name {
+			return list.Index(i)
+		}
+	}
+	return reflect.Value{}
+}
@@ -0,0 +1,82 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// ErrConflictNotFound is returned when a takeover is requested for a file
+// that has no recorded ownership conflict.
+var ErrConflictNotFound = errors.New("no ownership conflict recorded for file")
+
+// JobConflicts lists the ownership conflicts recorded for a repository.
+func (m *Manager) JobConflicts(ctx context.Context, repoID int64) ([]storage.JobConflict, error) {
+	return m.conflicts.ListByRepo(ctx, repoID)
+}
+
+// TakeoverJob lets the job file at path replace the job's current owner and
+// queues the repository so the takeover is applied.
+func (m *Manager) TakeoverJob(ctx context.Context, repoID int64, path string) error {
+	ok, err := m.conflicts.AllowTakeover(ctx, repoID, path)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrConflictNotFound
+	}
+	return m.TriggerRepo(ctx, repoID)
+}
+
+// ownershipConflict reports whether jobID is registered in namespace by a
+// different compass repository or job file. Jobs without compass metadata
+// are not owned by anyone and never conflict.
+func (m *Manager) ownershipConflict(ctx context.Context, repoRecord *storage.Repository, path, namespace, jobID string) (*storage.JobConflict, error) {
+	status, err := m.target(ctx, repoRecord).Client.JobStatus(ctx, namespace, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil || !status.Exists {
+		return nil, nil
+	}
+	ownerURL := status.Meta[compassMetaRepoURL]
+	ownerFile := status.Meta[compassMetaJobFile]
+	if ownerURL == "" || (ownerURL == repoRecord.RepoURL && ownerFile == path) {
+		return nil, nil
+	}
+	return &storage.JobConflict{
+		RepoID:       repoRecord.ID,
+		Path:         path,
+		JobID:        jobID,
+		OwnerRepoURL: ownerURL,
+		OwnerJobFile: ownerFile,
+	}, nil
+}
+
+// takeoverGranted reports whether conflict matches a takeover an operator
+// has allowed.
+func takeoverGranted(granted map[string]storage.JobConflict, conflict *storage.JobConflict) bool {
+	grant, ok := granted[conflict.Path]
+	return ok && grant.Takeover && grant.JobID == conflict.JobID && grant.OwnerRepoURL == conflict.OwnerRepoURL && grant.OwnerJobFile == conflict.OwnerJobFile
+}
+
+// ownedElsewhere reports whether a job compass tracks for path has since been
+// taken over by another repository or file, in which case it must not be
+// deregistered on the old owner's behalf.
+func (m *Manager) ownedElsewhere(ctx context.Context, repoRecord *storage.Repository, path, namespace, jobID string) (bool, error) {
+	conflict, err := m.ownershipConflict(ctx, repoRecord, path, namespace, jobID)
+	if err != nil {
+		return false, err
+	}
+	return conflict != nil, nil
+}
+
+func conflictError(conflict *storage.JobConflict) error {
+	owner := conflict.OwnerRepoURL
+	if conflict.OwnerJobFile != "" {
+		owner += " (" + conflict.OwnerJobFile + ")"
+	}
+	return fmt.Errorf("job %q is owned by %s", conflict.JobID, owner)
+}
@@ -0,0 +1,141 @@
+package reconcile
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	repomodel "github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func TestEnsureJobsRefusesJobOwnedByAnotherRepo(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	repoStore := storage.NewRepoStore(db, nil)
+	fileStore := storage.NewRepoFileStore(db)
+	conflictStore := storage.NewJobConflictStore(db)
+
+	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{Name: "demo", RepoURL: "https://example.com/demo.git", Branch: "main"})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+
+	fake := &fakeNomad{jobStatuses: map[string]*nomadclient.JobStatus{
+		"api": {ID: "api", Exists: true, Meta: map[string]string{
+			compassMetaRepoURL: "https://example.com/other.git",
+			compassMetaJobFile: ".nomad/api.nomad",
+		}},
+	}}
+	m := &Manager{
+		repos:     repoStore,
+		files:     fileStore,
+		conflicts: conflictStore,
+		nomad:     fake,
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		queue:     newWorkQueue(),
+	}
+
+	jobPath := ".nomad/api.nomad.hcl"
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "abc",
+		JobFiles:   []repomodel.JobFile{{Path: jobPath, Content: []byte(`job "api" { datacenters = ["dc1"] }`)}},
+	}
+
+	report, err := m.ensureJobs(ctx, repoRecord, snapshot, true)
+	if err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	if fake.registerCalls != 0 {
+		t.Fatalf("expected conflicting job not to be registered, got %d", fake.registerCalls)
+	}
+	if report.count(storage.JobActionFailed) != 1 {
+		t.Fatalf("expected ownership failure event, got %+v", report.Events)
+	}
+
+	conflicts, err := conflictStore.ListByRepo(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("list conflicts: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Path != jobPath || conflicts[0].OwnerRepoURL != "https://example.com/other.git" || conflicts[0].Takeover {
+		t.Fatalf("unexpected conflicts: %+v", conflicts)
+	}
+
+	if err := m.TakeoverJob(ctx, repoRecord.ID, jobPath); err != nil {
+		t.Fatalf("takeover: %v", err)
+	}
+	// The takeover is applied by a worker, not on the caller's goroutine.
+	if fake.registerCalls != 0 || m.queue.len() != 1 {
+		t.Fatalf("expected the takeover queued, got %d registers and %d queued", fake.registerCalls, m.queue.len())
+	}
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, false); err != nil {
+		t.Fatalf("ensure jobs after takeover: %v", err)
+	}
+	if fake.registerCalls != 1 {
+		t.Fatalf("expected job registered after takeover, got %d", fake.registerCalls)
+	}
+	conflicts, err = conflictStore.ListByRepo(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("list conflicts: %v", err)
+	}
+	if len(conflicts) != 0 {
+		t.Fatalf("expected conflict cleared after takeover, got %+v", conflicts)
+	}
+}
+
+func TestEnsureJobsLeavesTakenOverJobOnRemoval(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	repoStore := storage.NewRepoStore(db, nil)
+	fileStore := storage.NewRepoFileStore(db)
+
+	repoRecord, err := repoStore.Create(ctx, storage.RepositoryInput{Name: "demo", RepoURL: "https://example.com/demo.git", Branch: "main"})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+	if err := fileStore.Upsert(ctx, repoRecord.ID, ".nomad/api.nomad", "old", "api", ""); err != nil {
+		t.Fatalf("upsert repo file: %v", err)
+	}
+
+	fake := &fakeNomad{jobStatuses: map[string]*nomadclient.JobStatus{
+		"api": {ID: "api", Exists: true, Meta: map[string]string{compassMetaRepoURL: "https://example.com/other.git"}},
+	}}
+	m := &Manager{
+		files:  fileStore,
+		nomad:  fake,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	if _, err := m.ensureJobs(ctx, repoRecord, &repomodel.Snapshot{CommitHash: "new"}, true); err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	if len(fake.deregistered) != 0 {
+		t.Fatalf("expected job owned elsewhere to be left running, got %v", fake.deregistered)
+	}
+	files, err := fileStore.ListByRepo(ctx, repoRecord.ID)
+	if err != nil {
+		t.Fatalf("list repo files: %v", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected tracking dropped, got %+v", files)
+	}
+}
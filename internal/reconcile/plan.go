@@ -0,0 +1,200 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/jobpolicy"
+	"github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// Planned actions for a job file in a dry run.
+const (
+	PlanActionCreate    = "create"
+	PlanActionUpdate    = "update"
+	PlanActionUnchanged = "unchanged"
+	PlanActionRemove    = "remove"
+	PlanActionError     = "error"
+)
+
+// RepoPlan is the result of a dry run against a repository.
+type RepoPlan struct {
+	Commit string
+	Ref    string
+	Jobs   []JobPlan
+}
+
+// JobPlan is the planned outcome for a single job file.
+type JobPlan struct {
+	Path      string
+	JobID     string
+	Namespace string
+	Wave      int
+	Action    string
+	// Diff is Nomad's job diff with compass-only metadata changes removed.
+	Diff *api.JobDiff
+	// PlacementFailures maps task groups to allocations Nomad could not place.
+	PlacementFailures map[string]*api.AllocationMetric
+	Warnings          string
+	Error             string
+}
+
+// PlanRepo syncs a repository and plans every job in it without registering
+// or deregistering anything.
+func (m *Manager) PlanRepo(ctx context.Context, repoID int64) (*RepoPlan, error) {
+	unlock := m.locks.lock(repoID)
+	defer unlock()
+
+	repoRecord, err := m.repos.Get(ctx, repoID)
+	if err != nil {
+		return nil, err
+	}
+	if repoRecord == nil {
+		return nil, errors.New("repository not found")
+	}
+	cred, payload, err := m.credential(ctx, repoRecord)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := m.git.Sync(ctx, *repoRecord, cred, payload)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := m.planJobs(ctx, repoRecord, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &RepoPlan{Commit: snapshot.CommitHash, Ref: snapshot.Ref, Jobs: jobs}, nil
+}
+
+// planJobs plans each job in the snapshot, in wave order, followed by the
+// tracked jobs that the snapshot no longer declares.
+func (m *Manager) planJobs(ctx context.Context, repoRecord *storage.Repository, snapshot *repo.Snapshot) ([]JobPlan, error) {
+	target, err := m.clusterTarget(ctx, repoRecord)
+	if err != nil {
+		return nil, err
+	}
+	repoFiles, err := m.files.ListByRepo(ctx, repoRecord.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	plans := make([]JobPlan, 0, len(snapshot.JobFiles))
+	unparsed := make(map[string]struct{})
+	declared := make(map[string]struct{}, len(snapshot.JobFiles))
+	for _, jobFile := range snapshot.JobFiles {
+		job, _, err := parseJob(ctx, jobFile, repoRecord.Variables)
+		var wave int
+		if err == nil {
+			wave, err = jobWave(job)
+		}
+		if err != nil {
+			unparsed[jobFile.Path] = struct{}{}
+			plans = append(plans, JobPlan{Path: jobFile.Path, Action: PlanActionError, Error: err.Error()})
+			continue
+		}
+
+		plan := JobPlan{Path: jobFile.Path, JobID: jobID(job), Namespace: jobNamespace(target, job), Wave: wave}
+		declared[jobKey(plan.Namespace, plan.JobID)] = struct{}{}
+		if !repoRecord.AllowsNamespace(plan.Namespace) {
+			plan.Action = PlanActionError
+			plan.Error = fmt.Sprintf("namespace %q is not allowed for this repository", plan.Namespace)
+			plans = append(plans, plan)
+			continue
+		}
+		if err := jobpolicy.Error(jobpolicy.Check(job, m.jobPolicy, repoRecord.JobPolicy)); err != nil {
+			plan.Action = PlanActionError
+			plan.Error = err.Error()
+			plans = append(plans, plan)
+			continue
+		}
+		annotateJob(job, repoRecord, jobFile, snapshot, false)
+		resp, err := target.Client.PlanJob(ctx, job)
+		if err != nil {
+			plan.Action = PlanActionError
+			plan.Error = err.Error()
+		} else {
+			plan.Diff = filterJobDiff(resp.Diff)
+			plan.Action = planAction(plan.Diff)
+			plan.PlacementFailures = resp.FailedTGAllocs
+			plan.Warnings = resp.Warnings
+		}
+		plans = append(plans, plan)
+	}
+	sort.SliceStable(plans, func(i, j int) bool { return plans[i].Wave < plans[j].Wave })
+
+	for _, file := range repoFiles {
+		if !file.JobID.Valid || file.JobID.String == "" {
+			continue
+		}
+		namespace := fileNamespace(target, file)
+		if _, ok := declared[jobKey(namespace, file.JobID.String)]; ok {
+			continue
+		}
+		// A file that fails to parse keeps its job, as it does when applying.
+		if _, ok := unparsed[file.Path]; ok {
+			continue
+		}
+		plans = append(plans, JobPlan{Path: file.Path, JobID: file.JobID.String, Namespace: namespace, Action: PlanActionRemove})
+	}
+	return plans, nil
+}
+
+func planAction(diff *api.JobDiff) string {
+	switch {
+	case diff != nil && diff.Type == "Added":
+		return PlanActionCreate
+	case jobDiffHasChanges(diff):
+		return PlanActionUpdate
+	default:
+		return PlanActionUnchanged
+	}
+}
+
+// filterJobDiff copies diff without the compass commit metadata fields that
+// change on every commit.
+func filterJobDiff(diff *api.JobDiff) *api.JobDiff {
+	if diff == nil {
+		return nil
+	}
+	filtered := *diff
+	filtered.Fields = filterFieldDiffs(diff.Fields)
+	filtered.TaskGroups = make([]*api.TaskGroupDiff, 0, len(diff.TaskGroups))
+	for _, tg := range diff.TaskGroups {
+		if tg == nil {
+			continue
+		}
+		group := *tg
+		group.Fields = filterFieldDiffs(tg.Fields)
+		group.Tasks = make([]*api.TaskDiff, 0, len(tg.Tasks))
+		for _, task := range tg.Tasks {
+			if task == nil {
+				continue
+			}
+			t := *task
+			t.Fields = filterFieldDiffs(task.Fields)
+			group.Tasks = append(group.Tasks, &t)
+		}
+		filtered.TaskGroups = append(filtered.TaskGroups, &group)
+	}
+	if filtered.Type == "Edited" && !jobDiffHasChanges(&filtered) {
+		filtered.Type = "None"
+	}
+	return &filtered
+}
+
+func filterFieldDiffs(fields []*api.FieldDiff) []*api.FieldDiff {
+	kept := make([]*api.FieldDiff, 0, len(fields))
+	for _, field := range fields {
+		if field == nil || isCompassCommitMetadataField(field.Name) {
+			continue
+		}
+		kept = append(kept, field)
+	}
+	return kept
+}
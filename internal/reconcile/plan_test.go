@@ -0,0 +1,96 @@
+package reconcile
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+
+	repomodel "github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func TestPlanJobs(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	fileStore := storage.NewRepoFileStore(db)
+	for path, id := range map[string]string{
+		".nomad/api.nomad.hcl":    "api",
+		".nomad/old.nomad.hcl":    "old",
+		".nomad/broken.nomad.hcl": "broken",
+	} {
+		if err := fileStore.Upsert(ctx, 1, path, "abc", id, ""); err != nil {
+			t.Fatalf("upsert repo file: %v", err)
+		}
+	}
+
+	fake := &fakeNomad{
+		planResponses: map[string]*api.JobPlanResponse{
+			"api": {Diff: &api.JobDiff{Type: "Edited", ID: "api", Fields: []*api.FieldDiff{
+				{Type: "Deleted", Name: nomadMetaFieldName(compassMetaCommit), Old: "abc"},
+			}}},
+			"web": {
+				Diff:           &api.JobDiff{Type: "Added", ID: "web"},
+				FailedTGAllocs: map[string]*api.AllocationMetric{"web": {NodesEvaluated: 3}},
+			},
+		},
+	}
+	m := &Manager{
+		files:  fileStore,
+		nomad:  fake,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	repoRecord := &storage.Repository{ID: 1, Name: "demo"}
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "def",
+		JobFiles: []repomodel.JobFile{
+			{Path: ".nomad/web.nomad.hcl", Content: []byte(`job "web" {
+  datacenters = ["dc1"]
+  meta = { "nomad-compass/wave" = "1" }
+}`)},
+			{Path: ".nomad/api.nomad.hcl", Content: []byte(`job "api" { datacenters = ["dc1"] }`)},
+			{Path: ".nomad/broken.nomad.hcl", Content: []byte(`job "broken" {`)},
+		},
+	}
+
+	plans, err := m.planJobs(ctx, repoRecord, snapshot)
+	if err != nil {
+		t.Fatalf("plan jobs: %v", err)
+	}
+	if fake.registerCalls != 0 || len(fake.deregistered) != 0 {
+		t.Fatalf("expected a dry run, got %d registrations and %v deregistrations", fake.registerCalls, fake.deregistered)
+	}
+	if len(plans) != 4 {
+		t.Fatalf("expected 4 job plans, got %+v", plans)
+	}
+
+	byPath := make(map[string]JobPlan, len(plans))
+	for _, plan := range plans {
+		byPath[plan.Path] = plan
+	}
+	if plans[len(plans)-1].Path != ".nomad/old.nomad.hcl" || byPath[".nomad/old.nomad.hcl"].Action != PlanActionRemove {
+		t.Fatalf("expected removed job planned last, got %+v", plans)
+	}
+	if apiPlan := byPath[".nomad/api.nomad.hcl"]; apiPlan.Action != PlanActionUnchanged || len(apiPlan.Diff.Fields) != 0 || apiPlan.Diff.Type != "None" {
+		t.Fatalf("expected compass metadata diff dropped, got %+v", apiPlan)
+	}
+	web := byPath[".nomad/web.nomad.hcl"]
+	if web.Action != PlanActionCreate || web.Wave != 1 || web.PlacementFailures["web"] == nil {
+		t.Fatalf("unexpected web plan: %+v", web)
+	}
+	if broken := byPath[".nomad/broken.nomad.hcl"]; broken.Action != PlanActionError || broken.Error == "" {
+		t.Fatalf("expected parse error planned, got %+v", broken)
+	}
+}
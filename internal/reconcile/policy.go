@@ -0,0 +1,100 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+var (
+	// ErrNoPendingChanges is returned when approving a repository with nothing held.
+	ErrNoPendingChanges = errors.New("repository has no pending changes")
+	// ErrPendingChangesStale is returned when the branch moved after changes were
+	// planned; the refreshed plan must be reviewed again.
+	ErrPendingChangesStale = errors.New("pending changes are stale; review the refreshed plan")
+	// ErrDetectOnly is returned when approving a repository that never writes to Nomad.
+	ErrDetectOnly = errors.New("repository uses the detect-only sync policy")
+)
+
+// PendingChanges returns the job changes held back by a repository's sync policy.
+func (m *Manager) PendingChanges(ctx context.Context, repoID int64) ([]storage.PendingChange, error) {
+	return m.pending.ListByRepo(ctx, repoID)
+}
+
+// ApproveRepo applies the pending changes for a manual repository. The
+// repository is re-synced first and the approval is refused if the branch has
+// moved past the commit the pending plan was computed from.
+func (m *Manager) ApproveRepo(ctx context.Context, repoID int64) error {
+	repoRecord, err := m.repos.Get(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	if repoRecord == nil {
+		return errors.New("repository not found")
+	}
+	if repoRecord.SyncPolicy == storage.SyncPolicyDetect {
+		return ErrDetectOnly
+	}
+
+	changes, err := m.pending.ListByRepo(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return ErrNoPendingChanges
+	}
+	commit := changes[0].Commit.String
+	if commit == "" {
+		return ErrPendingChangesStale
+	}
+
+	return m.reconcileRepoAt(ctx, repoRecord, commit)
+}
+
+// holdJobChange records a change that the repository's sync policy prevents
+// from being registered. A plan is computed when one is not already available
+// so reviewers can see what would change.
+func (m *Manager) holdJobChange(ctx context.Context, report *reconcileReport, repoRecord *storage.Repository, jobFile repo.JobFile, snapshot *repo.Snapshot, job *api.Job, trackedJobID string, plan *api.JobPlanResponse, reason string) {
+	if plan == nil {
+		annotateJob(job, repoRecord, jobFile, snapshot, false)
+		var err error
+		plan, err = m.target(ctx, repoRecord).Client.PlanJob(ctx, job)
+		if err != nil {
+			m.logger.Warn("job plan failed", "repo", repoRecord.Name, "file", jobFile.Path, "error", err)
+		} else {
+			reason = planSummary(plan)
+		}
+	}
+
+	id := trackedJobID
+	if id == "" {
+		id = jobID(job)
+	}
+	change := storage.PendingChange{
+		Path:    jobFile.Path,
+		JobID:   nullString(id),
+		Commit:  nullString(snapshot.CommitHash),
+		Action:  storage.PendingActionApply,
+		Summary: reason,
+	}
+	if plan != nil && plan.Diff != nil {
+		if raw, err := json.Marshal(plan.Diff); err == nil {
+			change.Diff = nullString(string(raw))
+		}
+	}
+	report.hold(repoRecord.SyncPolicy, change)
+}
+
+func (r *reconcileReport) hold(policy storage.SyncPolicy, change storage.PendingChange) {
+	action := storage.JobActionPending
+	if policy == storage.SyncPolicyDetect {
+		action = storage.JobActionDrifted
+	}
+	r.Pending = append(r.Pending, change)
+	r.add(change.Path, change.JobID.String, action, storage.JobPhasePlan, change.Summary)
+}
@@ -0,0 +1,138 @@
+package reconcile
+
+import (
+	"context"
+	"sync"
+)
+
+// workQueue is a FIFO of repository IDs that ignores IDs already waiting to be
+// processed, so repeated triggers for the same repository collapse into one.
+// It also tracks which repositories a worker is currently reconciling.
+type workQueue struct {
+	mu     sync.Mutex
+	order  []int64
+	queued map[int64]struct{}
+	active map[int64]struct{}
+	notify chan struct{}
+}
+
+func newWorkQueue() *workQueue {
+	return &workQueue{queued: make(map[int64]struct{}), active: make(map[int64]struct{}), notify: make(chan struct{}, 1)}
+}
+
+// push adds repoID to the queue and reports whether it was newly queued. A
+// repository that is being reconciled may be queued again so that changes
+// arriving mid-run are picked up.
+func (q *workQueue) push(repoID int64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pushLocked(repoID)
+}
+
+// pushIfIdle is like push but also skips repositories that are being
+// reconciled. Scheduled polls use it so a slow run is not immediately repeated.
+func (q *workQueue) pushIfIdle(repoID int64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.active[repoID]; ok {
+		return false
+	}
+	return q.pushLocked(repoID)
+}
+
+func (q *workQueue) pushLocked(repoID int64) bool {
+	if _, ok := q.queued[repoID]; ok {
+		return false
+	}
+	q.queued[repoID] = struct{}{}
+	q.order = append(q.order, repoID)
+	q.signal()
+	return true
+}
+
+// pop blocks until a repository is available or ctx is cancelled. The
+// repository is marked active until done is called.
+func (q *workQueue) pop(ctx context.Context) (int64, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.order) > 0 {
+			repoID := q.order[0]
+			q.order = q.order[1:]
+			delete(q.queued, repoID)
+			q.active[repoID] = struct{}{}
+			if len(q.order) > 0 {
+				// Wake another worker for the remaining items.
+				q.signal()
+			}
+			q.mu.Unlock()
+			return repoID, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return 0, false
+		case <-q.notify:
+		}
+	}
+}
+
+// done marks a popped repository as no longer being reconciled.
+func (q *workQueue) done(repoID int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.active, repoID)
+}
+
+func (q *workQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.order)
+}
+
+func (q *workQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// repoLocks hands out one mutex per repository so that reconciles, approvals,
+// rollbacks and deletes never operate on the same working copy concurrently.
+// A mutex is dropped once nobody holds or waits for it, so deleted
+// repositories do not leave entries behind.
+type repoLocks struct {
+	mu    sync.Mutex
+	locks map[int64]*repoLock
+}
+
+type repoLock struct {
+	sync.Mutex
+	// refs counts holders and waiters. Guarded by repoLocks.mu.
+	refs int
+}
+
+func (l *repoLocks) lock(repoID int64) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[int64]*repoLock)
+	}
+	rl, ok := l.locks[repoID]
+	if !ok {
+		rl = &repoLock{}
+		l.locks[repoID] = rl
+	}
+	rl.refs++
+	l.mu.Unlock()
+
+	rl.Lock()
+	return func() {
+		rl.Unlock()
+		l.mu.Lock()
+		rl.refs--
+		if rl.refs == 0 {
+			delete(l.locks, repoID)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,125 @@
+package reconcile
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkQueueDeduplicatesPendingRepos(t *testing.T) {
+	q := newWorkQueue()
+	if !q.push(1) {
+		t.Fatalf("expected first push to queue repo")
+	}
+	if q.push(1) {
+		t.Fatalf("expected duplicate push to be ignored")
+	}
+	if !q.push(2) {
+		t.Fatalf("expected second repo to be queued")
+	}
+	if q.len() != 2 {
+		t.Fatalf("expected 2 queued repos, got %d", q.len())
+	}
+
+	ctx := context.Background()
+	if id, ok := q.pop(ctx); !ok || id != 1 {
+		t.Fatalf("expected repo 1, got %d (ok=%v)", id, ok)
+	}
+	// Scheduled polls skip a repo that is being reconciled, but triggers may
+	// queue it again.
+	if q.pushIfIdle(1) {
+		t.Fatalf("expected active repo to be skipped by scheduled poll")
+	}
+	if !q.push(1) {
+		t.Fatalf("expected repo to be re-queued after pop")
+	}
+	q.done(1)
+	if id, _ := q.pop(ctx); id != 2 {
+		t.Fatalf("expected repo 2, got %d", id)
+	}
+	if id, _ := q.pop(ctx); id != 1 {
+		t.Fatalf("expected repo 1, got %d", id)
+	}
+}
+
+func TestWorkQueuePopStopsOnCancel(t *testing.T) {
+	q := newWorkQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ok := q.pop(ctx); ok {
+		t.Fatalf("expected pop to stop when context is cancelled")
+	}
+}
+
+func TestWorkQueueWakesAllWorkers(t *testing.T) {
+	q := newWorkQueue()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	results := make(chan int64, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if id, ok := q.pop(ctx); ok {
+				results <- id
+			}
+		}()
+	}
+	for id := int64(1); id <= 3; id++ {
+		q.push(id)
+	}
+	wg.Wait()
+	close(results)
+	if len(results) != 3 {
+		t.Fatalf("expected every worker to receive a repo, got %d", len(results))
+	}
+}
+
+func TestRepoLocksSerializeSameRepo(t *testing.T) {
+	var locks repoLocks
+	unlock := locks.lock(1)
+
+	acquired := make(chan struct{})
+	go func() {
+		release := locks.lock(1)
+		close(acquired)
+		release()
+	}()
+
+	// A different repository is not blocked.
+	locks.lock(2)()
+
+	select {
+	case <-acquired:
+		t.Fatalf("expected second lock on the same repo to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected lock to be acquired after release")
+	}
+}
+
+func TestRepoLocksDropReleasedEntries(t *testing.T) {
+	var locks repoLocks
+	unlock := locks.lock(1)
+
+	acquired := make(chan func())
+	go func() { acquired <- locks.lock(1) }()
+	// Let the waiter register before the holder releases.
+	time.Sleep(20 * time.Millisecond)
+	unlock()
+	release := <-acquired
+	if len(locks.locks) != 1 {
+		t.Fatalf("expected the entry kept while the waiter holds it, got %d", len(locks.locks))
+	}
+	release()
+	if len(locks.locks) != 0 {
+		t.Fatalf("expected no entries once every lock is released, got %d", len(locks.locks))
+	}
+}
@@ -0,0 +1,66 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+
+	"github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// ErrInvalidCommit is returned when a rollback target is not a full commit SHA.
+var ErrInvalidCommit = errors.New("rollback target must be a full commit SHA")
+
+// RollbackRepo re-applies the jobspecs from commit and pauses automatic
+// reconciliation at that commit until ResumeRepo is called. The rollback is an
+// explicit operator action, so it is applied even for manual repositories.
+func (m *Manager) RollbackRepo(ctx context.Context, repoID int64, commit string) error {
+	if !repo.IsCommitHash(commit) {
+		return ErrInvalidCommit
+	}
+	repoRecord, err := m.repos.Get(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	if repoRecord == nil {
+		return errors.New("repository not found")
+	}
+	if repoRecord.SyncPolicy == storage.SyncPolicyDetect {
+		return ErrDetectOnly
+	}
+
+	previous := repoRecord.RollbackCommit
+	if err := m.repos.SetRollbackCommit(ctx, repoID, commit); err != nil {
+		return err
+	}
+	repoRecord.RollbackCommit.String = commit
+	repoRecord.RollbackCommit.Valid = true
+
+	err = m.reconcileRepoAt(ctx, repoRecord, commit)
+	if errors.Is(err, repo.ErrRevisionNotFound) {
+		// Leave the repository as it was rather than pinning it to a commit
+		// that cannot be checked out.
+		if restoreErr := m.repos.SetRollbackCommit(ctx, repoID, previous.String); restoreErr != nil {
+			m.logger.Error("restore rollback commit failed", "repo", repoRecord.Name, "error", restoreErr)
+		}
+	}
+	return err
+}
+
+// ResumeRepo clears a rollback and reconciles the repository against its
+// branch head again.
+func (m *Manager) ResumeRepo(ctx context.Context, repoID int64) error {
+	repoRecord, err := m.repos.Get(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	if repoRecord == nil {
+		return errors.New("repository not found")
+	}
+	if err := m.repos.SetRollbackCommit(ctx, repoID, ""); err != nil {
+		return err
+	}
+	repoRecord.RollbackCommit.Valid = false
+	repoRecord.RollbackCommit.String = ""
+	return m.reconcileRepo(ctx, repoRecord)
+}
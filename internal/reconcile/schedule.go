@@ -0,0 +1,78 @@
+package reconcile
+
+import (
+	"context"
+	"time"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// scheduleNext records when the repository should next be polled. Failed
+// passes increase the consecutive failure count and back off the next poll;
+// a successful pass resets it. While deployments are in progress the next
+// pass comes sooner, to check on them.
+func (m *Manager) scheduleNext(ctx context.Context, repoRecord *storage.Repository, failed, deploying bool) {
+	failures := 0
+	if failed {
+		failures = repoRecord.FailureCount + 1
+	}
+	delay := pollDelay(m.pollInterval(repoRecord), m.maxBackoff, failures)
+	if deploying && failures == 0 && delay > deploymentRecheck {
+		delay = deploymentRecheck
+	}
+	if err := m.repos.UpdateSchedule(ctx, repoRecord.ID, failures, storage.Now().Add(delay)); err != nil {
+		m.logger.Warn("update poll schedule failed", "repo", repoRecord.Name, "error", err)
+	}
+	if failures > 0 {
+		m.logger.Info("backing off repository polling", "repo", repoRecord.Name, "failures", failures, "delay", delay)
+	}
+}
+
+// shouldBackOff reports whether a pass failed in a way that retrying sooner
+// would not fix: the sync itself failed, or Nomad rejected a register or
+// deregister. Problems in the jobspecs, such as parse errors or policy
+// violations, are fixed by a new commit, which should be picked up at the
+// normal interval.
+func shouldBackOff(report *reconcileReport, err error) bool {
+	if err != nil {
+		return true
+	}
+	if report == nil {
+		return false
+	}
+	for _, event := range report.Events {
+		if event.Action != storage.JobActionFailed {
+			continue
+		}
+		switch event.Phase.String {
+		case storage.JobPhaseApply, storage.JobPhaseDeregister:
+			return true
+		}
+	}
+	return false
+}
+
+// pollInterval returns the repository's own interval, falling back to the
+// global one.
+func (m *Manager) pollInterval(repoRecord *storage.Repository) time.Duration {
+	if repoRecord.PollInterval.Valid && repoRecord.PollInterval.Int64 > 0 {
+		return time.Duration(repoRecord.PollInterval.Int64) * time.Second
+	}
+	return m.interval
+}
+
+// pollDelay doubles interval for each consecutive failure, up to maxBackoff.
+// The delay never drops below interval, even if maxBackoff is smaller.
+func pollDelay(interval, maxBackoff time.Duration, failures int) time.Duration {
+	if maxBackoff < interval {
+		maxBackoff = interval
+	}
+	delay := interval
+	for i := 0; i < failures && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,65 @@
+package reconcile
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func TestPollDelayBacksOffWithCap(t *testing.T) {
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 5 * time.Minute},
+		{20, 5 * time.Minute},
+	}
+	for _, tc := range cases {
+		if got := pollDelay(30*time.Second, 5*time.Minute, tc.failures); got != tc.want {
+			t.Fatalf("failures=%d: expected %s, got %s", tc.failures, tc.want, got)
+		}
+	}
+	if got := pollDelay(time.Hour, time.Minute, 3); got != time.Hour {
+		t.Fatalf("expected cap below interval to fall back to interval, got %s", got)
+	}
+}
+
+func TestPollIntervalPrefersRepositoryOverride(t *testing.T) {
+	m := &Manager{interval: 30 * time.Second}
+	if got := m.pollInterval(&storage.Repository{}); got != 30*time.Second {
+		t.Fatalf("expected global interval, got %s", got)
+	}
+	repo := &storage.Repository{PollInterval: sql.NullInt64{Int64: 10, Valid: true}}
+	if got := m.pollInterval(repo); got != 10*time.Second {
+		t.Fatalf("expected repository interval, got %s", got)
+	}
+}
+
+func TestShouldBackOff(t *testing.T) {
+	if !shouldBackOff(nil, errors.New("clone failed")) {
+		t.Fatal("expected a failed sync to back off")
+	}
+	if shouldBackOff(nil, nil) {
+		t.Fatal("expected a clean pass not to back off")
+	}
+
+	report := &reconcileReport{}
+	report.failed("a.nomad", "", storage.JobPhaseParse, errors.New("syntax error"))
+	report.failed("b.nomad", "b", storage.JobPhasePolicy, errors.New("privileged"))
+	report.failed("c.nomad", "c", storage.JobPhaseOwnership, errors.New("owned elsewhere"))
+	if shouldBackOff(report, nil) {
+		t.Fatal("expected jobspec problems not to back off")
+	}
+
+	report.failed("d.nomad", "d", storage.JobPhaseApply, errors.New("register rejected"))
+	if !shouldBackOff(report, nil) {
+		t.Fatal("expected a failed register to back off")
+	}
+}
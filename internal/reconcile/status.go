@@ -0,0 +1,74 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/brianmichel/nomad-compass/internal/commitstatus"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+// reportCommitStatus posts status for commit to the repository's Git host.
+// A state already posted for the commit is not posted again, so passes that
+// change nothing stay quiet.
+func (m *Manager) reportCommitStatus(ctx context.Context, repoRecord *storage.Repository, commit string, status commitstatus.Status) {
+	if m.statuses == nil || repoRecord.StatusProvider == "" || commit == "" {
+		return
+	}
+	key := commit + "\x00" + string(status.State) + "\x00" + status.Description
+	m.statusMu.Lock()
+	posted := m.reported[repoRecord.ID] == key
+	m.statusMu.Unlock()
+	if posted {
+		return
+	}
+
+	_, payload, err := m.credential(ctx, repoRecord)
+	if err != nil || payload == nil || payload.Token == "" {
+		m.logger.Warn("commit status needs an HTTPS token credential", "repo", repoRecord.Name, "error", err)
+		return
+	}
+	if m.publicURL != "" {
+		status.TargetURL = strings.TrimRight(m.publicURL, "/") + "/repos/" + strconv.FormatInt(repoRecord.ID, 10)
+	}
+	target := commitstatus.Target{
+		Provider: repoRecord.StatusProvider,
+		APIURL:   repoRecord.StatusAPIURL,
+		RepoURL:  repoRecord.RepoURL,
+		Token:    payload.Token,
+	}
+	if err := m.statuses.Report(ctx, target, commit, status); err != nil {
+		// Nothing is recorded, so the next pass tries again.
+		m.logger.Warn("report commit status failed", "repo", repoRecord.Name, "commit", commit, "error", err)
+		return
+	}
+	m.statusMu.Lock()
+	if m.reported == nil {
+		m.reported = make(map[int64]string)
+	}
+	m.reported[repoRecord.ID] = key
+	m.statusMu.Unlock()
+}
+
+// commitOutcome summarises a pass as a commit status. A commit whose
+// deployments are still running, or whose later waves are waiting on them,
+// stays pending until a later pass sees how they ended.
+func commitOutcome(report *reconcileReport, err error) commitstatus.Status {
+	summary := report.summary()
+	switch {
+	case err != nil && !errors.Is(err, ErrPendingChangesStale):
+		return commitstatus.Status{State: commitstatus.StateFailure, Description: "Reconcile failed: " + err.Error()}
+	case report.count(storage.JobActionFailed) > 0, report.count(storage.JobActionUnhealthy) > 0:
+		return commitstatus.Status{State: commitstatus.StateFailure, Description: summary}
+	case report.count(storage.JobActionPending) > 0:
+		return commitstatus.Status{State: commitstatus.StatePending, Description: "Awaiting approval: " + summary}
+	case report != nil && report.DeploysPending:
+		return commitstatus.Status{State: commitstatus.StatePending, Description: "Deploying: " + summary}
+	case summary == "":
+		return commitstatus.Status{State: commitstatus.StateSuccess, Description: "No jobs to deploy"}
+	default:
+		return commitstatus.Status{State: commitstatus.StateSuccess, Description: summary}
+	}
+}
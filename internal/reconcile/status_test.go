@@ -0,0 +1,145 @@
+package reconcile
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/auth"
+	"github.com/brianmichel/nomad-compass/internal/commitstatus"
+	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func TestReportCommitStatusPostsEachStateOnce(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	enc, err := auth.NewEncryptor([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+	creds := storage.NewCredentialStore(db, enc)
+	cred, err := creds.Create(ctx, "git", storage.CredentialTypeHTTPToken, storage.CredentialPayload{Token: "secret"})
+	if err != nil {
+		t.Fatalf("create credential: %v", err)
+	}
+
+	var (
+		mu     sync.Mutex
+		states []map[string]string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		states = append(states, body)
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	m := &Manager{
+		creds:     creds,
+		statuses:  commitstatus.NewClient(nil),
+		publicURL: "https://compass.example.com/",
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	repoRecord := &storage.Repository{
+		ID:             3,
+		Name:           "demo",
+		RepoURL:        "https://github.com/acme/api.git",
+		CredentialID:   sql.NullInt64{Int64: cred.ID, Valid: true},
+		StatusProvider: commitstatus.ProviderGitHub,
+		StatusAPIURL:   srv.URL,
+	}
+
+	report := &reconcileReport{}
+	report.add("api.nomad.hcl", "api", storage.JobActionApplied, "", "")
+	// A status that could not be posted is tried again.
+	withoutToken := *repoRecord
+	withoutToken.CredentialID = sql.NullInt64{}
+	m.reportCommitStatus(ctx, &withoutToken, "abc123", commitOutcome(report, nil))
+	m.reportCommitStatus(ctx, repoRecord, "abc123", commitOutcome(report, nil))
+	m.reportCommitStatus(ctx, repoRecord, "abc123", commitOutcome(report, nil))
+
+	report.failed("web.nomad.hcl", "web", storage.JobPhaseApply, io.EOF)
+	m.reportCommitStatus(ctx, repoRecord, "abc123", commitOutcome(report, nil))
+
+	if len(states) != 2 {
+		t.Fatalf("expected 2 statuses posted, got %d", len(states))
+	}
+	if states[0]["state"] != "success" || states[0]["description"] != "1 applied" {
+		t.Fatalf("unexpected first status %#v", states[0])
+	}
+	if states[0]["target_url"] != "https://compass.example.com/repos/3" {
+		t.Fatalf("unexpected target url %q", states[0]["target_url"])
+	}
+	if states[1]["state"] != "failure" {
+		t.Fatalf("expected failure status, got %#v", states[1])
+	}
+}
+
+func TestCommitOutcome(t *testing.T) {
+	if got := commitOutcome(&reconcileReport{}, nil); got.State != commitstatus.StateSuccess {
+		t.Fatalf("expected success for empty pass, got %s", got.State)
+	}
+	held := &reconcileReport{}
+	held.add("api.nomad.hcl", "api", storage.JobActionPending, "", "")
+	if got := commitOutcome(held, ErrPendingChangesStale); got.State != commitstatus.StatePending {
+		t.Fatalf("expected pending for held changes, got %s", got.State)
+	}
+	if got := commitOutcome(nil, io.EOF); got.State != commitstatus.StateFailure {
+		t.Fatalf("expected failure for sync error, got %s", got.State)
+	}
+}
+
+func TestCommitOutcomePendingWhileDeploying(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeNomad{jobVersion: 3}
+	m, repoRecord := newHealthTestManager(t, fake)
+
+	// The first wave is registered and deploying; the second waits on it.
+	report, err := m.ensureJobs(ctx, repoRecord, healthTestSnapshot(), true)
+	if err != nil {
+		t.Fatalf("first pass: %v", err)
+	}
+	got := commitOutcome(report, nil)
+	if got.State != commitstatus.StatePending || !strings.HasPrefix(got.Description, "Deploying: ") {
+		t.Fatalf("expected pending while deploying, got %+v", got)
+	}
+
+	fake.deployments = map[string]*nomadclient.Deployment{
+		"api": {ID: "deploy-api", JobVersion: 3, Status: api.DeploymentStatusSuccessful},
+		"web": {ID: "deploy-web", JobVersion: 3, Status: api.DeploymentStatusSuccessful},
+	}
+	report, err = m.ensureJobs(ctx, repoRecord, healthTestSnapshot(), false)
+	if err != nil {
+		t.Fatalf("second pass: %v", err)
+	}
+	if got := commitOutcome(report, nil); got.State != commitstatus.StatePending {
+		t.Fatalf("expected pending while the second wave deploys, got %+v", got)
+	}
+
+	healthy := &reconcileReport{}
+	healthy.add("web.nomad.hcl", "web", storage.JobActionHealthy, storage.JobPhaseDeploy, "deployment succeeded")
+	if got := commitOutcome(healthy, nil); got.State != commitstatus.StateSuccess {
+		t.Fatalf("expected success once the last deployment is healthy, got %+v", got)
+	}
+}
@@ -0,0 +1,87 @@
+package reconcile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+
+	"github.com/brianmichel/nomad-compass/internal/repo"
+)
+
+var variableSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "variable", LabelNames: []string{"name"}},
+		{Type: "variables"},
+	},
+}
+
+// declaredVariables returns the names of the variables a jobspec declares. A
+// body that does not parse declares nothing; the jobspec parser reports the
+// syntax error itself.
+func declaredVariables(jobFile repo.JobFile) map[string]bool {
+	declared := make(map[string]bool)
+	file, diags := hclparse.NewParser().ParseHCL(jobFile.Content, jobFile.Path)
+	if diags.HasErrors() {
+		return declared
+	}
+	content, _, _ := file.Body.PartialContent(variableSchema)
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "variable":
+			declared[block.Labels[0]] = true
+		case "variables":
+			attrs, _ := block.Body.JustAttributes()
+			for name := range attrs {
+				declared[name] = true
+			}
+		}
+	}
+	return declared
+}
+
+// declaredVarContent merges the assignments in varFiles to variables the job
+// declares into one var file. Later files win, as they do in Nomad.
+// Assignments to other variables are dropped, since shared var files set
+// values for every job in a directory.
+func declaredVarContent(varFiles []repo.VarFile, declared map[string]bool) (string, error) {
+	var names []string
+	values := make(map[string]string)
+	for _, varFile := range varFiles {
+		file, diags := hclparse.NewParser().ParseHCL(varFile.Content, varFile.Path)
+		if diags.HasErrors() {
+			return "", fmt.Errorf("parse var file %s: %s", varFile.Path, diags.Error())
+		}
+		attrs, diags := file.Body.JustAttributes()
+		if diags.HasErrors() {
+			return "", fmt.Errorf("parse var file %s: %s", varFile.Path, diags.Error())
+		}
+		for _, attr := range sortedAttributes(attrs) {
+			if !declared[attr.Name] {
+				continue
+			}
+			if _, ok := values[attr.Name]; !ok {
+				names = append(names, attr.Name)
+			}
+			rng := attr.Expr.Range()
+			values[attr.Name] = string(varFile.Content[rng.Start.Byte:rng.End.Byte])
+		}
+	}
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s = %s\n", name, values[name])
+	}
+	return b.String(), nil
+}
+
+// sortedAttributes orders attrs as they appear in their file.
+func sortedAttributes(attrs hcl.Attributes) []*hcl.Attribute {
+	sorted := make([]*hcl.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		sorted = append(sorted, attr)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Range.Start.Byte < sorted[j].Range.Start.Byte })
+	return sorted
+}
@@ -0,0 +1,51 @@
+package reconcile
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/repo"
+)
+
+// parsedJobFile is a job file from the snapshot together with its parsed job.
+type parsedJobFile struct {
+	file       repo.JobFile
+	job        *api.Job
+	submission *api.JobSubmission
+	wave       int
+}
+
+// jobWave reads the sync wave from the job's meta. Jobs without one are in
+// wave 0.
+func jobWave(job *api.Job) (int, error) {
+	raw := strings.TrimSpace(job.Meta[compassMetaWave])
+	if raw == "" {
+		return 0, nil
+	}
+	wave, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s meta %q: must be an integer", compassMetaWave, raw)
+	}
+	return wave, nil
+}
+
+// groupWaves splits jobs into waves in ascending order, keeping the snapshot
+// order within each wave.
+func groupWaves(jobs []parsedJobFile) [][]parsedJobFile {
+	sorted := make([]parsedJobFile, len(jobs))
+	copy(sorted, jobs)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].wave < sorted[j].wave })
+
+	var waves [][]parsedJobFile
+	for i, pj := range sorted {
+		if i == 0 || pj.wave != sorted[i-1].wave {
+			waves = append(waves, nil)
+		}
+		waves[len(waves)-1] = append(waves[len(waves)-1], pj)
+	}
+	return waves
+}
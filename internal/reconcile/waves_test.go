@@ -0,0 +1,115 @@
+package reconcile
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	repomodel "github.com/brianmichel/nomad-compass/internal/repo"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func TestGroupWavesOrdersByWave(t *testing.T) {
+	jobs := []parsedJobFile{
+		{file: repomodel.JobFile{Path: "app"}, wave: 2},
+		{file: repomodel.JobFile{Path: "db"}, wave: 0},
+		{file: repomodel.JobFile{Path: "proxy"}, wave: 1},
+		{file: repomodel.JobFile{Path: "cache"}, wave: 0},
+	}
+	waves := groupWaves(jobs)
+	var got [][]string
+	for _, wave := range waves {
+		var paths []string
+		for _, pj := range wave {
+			paths = append(paths, pj.file.Path)
+		}
+		got = append(got, paths)
+	}
+	if len(got) != 3 || len(got[0]) != 2 || got[0][0] != "db" || got[0][1] != "cache" || got[1][0] != "proxy" || got[2][0] != "app" {
+		t.Fatalf("unexpected waves: %v", got)
+	}
+}
+
+func TestJobWave(t *testing.T) {
+	job := &api.Job{Meta: map[string]string{}}
+	if wave, err := jobWave(job); err != nil || wave != 0 {
+		t.Fatalf("expected default wave 0, got %d, %v", wave, err)
+	}
+	job.Meta[compassMetaWave] = " -1 "
+	if wave, err := jobWave(job); err != nil || wave != -1 {
+		t.Fatalf("expected wave -1, got %d, %v", wave, err)
+	}
+	job.Meta[compassMetaWave] = "first"
+	if _, err := jobWave(job); err == nil {
+		t.Fatalf("expected invalid wave to fail")
+	}
+}
+
+func TestEnsureJobsAppliesWavesInOrderAndStopsAfterFailure(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := storage.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	// The proxy job is owned by another repository, so wave 1 fails.
+	fake := &fakeNomad{jobStatuses: map[string]*nomadclient.JobStatus{
+		"proxy": {ID: "proxy", Exists: true, Meta: map[string]string{
+			compassMetaRepoURL: "https://example.com/other.git",
+			compassMetaJobFile: "proxy.nomad.hcl",
+		}},
+	}}
+	m := &Manager{
+		files:  storage.NewRepoFileStore(db),
+		nomad:  fake,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	repoRecord := &storage.Repository{ID: 1, Name: "demo", RepoURL: "https://example.com/demo.git"}
+	snapshot := &repomodel.Snapshot{
+		CommitHash: "new",
+		JobFiles: []repomodel.JobFile{
+			{Path: ".nomad/app.nomad.hcl", Content: []byte(`job "app" {
+  datacenters = ["dc1"]
+  meta = { "nomad-compass/wave" = "2" }
+}`)},
+			{Path: ".nomad/db.nomad.hcl", Content: []byte(`job "db" { datacenters = ["dc1"] }`)},
+			{Path: ".nomad/proxy.nomad.hcl", Content: []byte(`job "proxy" {
+  datacenters = ["dc1"]
+  meta = { "nomad-compass/wave" = "1" }
+}`)},
+		},
+	}
+
+	report, err := m.ensureJobs(ctx, repoRecord, snapshot, true)
+	if err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	if len(fake.registeredJobIDs) != 1 || fake.registeredJobIDs[0] != "db" {
+		t.Fatalf("expected only wave 0 registered, got %v", fake.registeredJobIDs)
+	}
+	if got := report.count(storage.JobActionFailed); got != 1 {
+		t.Fatalf("expected wave 1 to fail, got %d failures", got)
+	}
+	if got := report.count(storage.JobActionSkipped); got != 1 {
+		t.Fatalf("expected wave 2 skipped, got %d", got)
+	}
+
+	fake.jobStatuses = nil
+	fake.registeredJobIDs = nil
+	if _, err := m.ensureJobs(ctx, repoRecord, snapshot, true); err != nil {
+		t.Fatalf("ensure jobs: %v", err)
+	}
+	if len(fake.registeredJobIDs) != 2 || fake.registeredJobIDs[0] != "proxy" || fake.registeredJobIDs[1] != "app" {
+		t.Fatalf("expected proxy then app registered, got %v", fake.registeredJobIDs)
+	}
+}
@@ -8,15 +8,38 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
 	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/brianmichel/nomad-compass/internal/storage"
+	"github.com/brianmichel/nomad-compass/internal/tracing"
+)
+
+var tracer = otel.Tracer("github.com/brianmichel/nomad-compass/internal/repo")
+
+var (
+	syncDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "nomad_compass_git_sync_duration_seconds",
+		Help: "Time taken to fetch and check out a repository.",
+		// Clones of large repositories can take minutes.
+		Buckets: prometheus.ExponentialBucketsRange(0.01, 300, 14),
+	}, []string{"repo"})
+	syncErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nomad_compass_git_sync_errors_total",
+		Help: "Repository syncs that failed.",
+	}, []string{"repo"})
 )
 
 // Manager coordinates cloning, updating, and inspecting git repositories.
@@ -26,7 +49,10 @@ type Manager struct {
 
 // Snapshot represents the state of a repository after syncing.
 type Snapshot struct {
-	RepoPath     string
+	RepoPath string
+	// Ref is the fully qualified ref that was checked out, or the commit SHA
+	// when the repository is pinned to a commit.
+	Ref          string
 	CommitHash   string
 	CommitAuthor string
 	CommitTitle  string
@@ -38,6 +64,31 @@ type JobFile struct {
 	Path     string
 	FullPath string
 	Content  []byte
+	// VarFiles lists HCL2 variable files found in the same directory as the
+	// job file, ordered by name.
+	VarFiles []VarFile
+	// Overlay is the partial job at the same relative path in the
+	// repository's overlay directory, if any.
+	Overlay *OverlayFile
+}
+
+// IsJSON reports whether the job file holds a JSON jobspec rather than HCL.
+func (f JobFile) IsJSON() bool {
+	return strings.HasSuffix(f.Path, ".nomad.json")
+}
+
+// VarFile captures an HCL2 variable file discovered next to a job file.
+type VarFile struct {
+	Path     string
+	FullPath string
+	Content  []byte
+}
+
+// OverlayFile captures a partial job that is merged into a base job file.
+type OverlayFile struct {
+	Path     string
+	FullPath string
+	Content  []byte
 }
 
 // NewManager constructs a repository manager with a base directory.
@@ -57,8 +108,38 @@ func (m *Manager) RemoveRepo(repoID int64) error {
 	return os.RemoveAll(repoPath)
 }
 
+// ErrRevisionNotFound is returned when a requested commit does not exist in the
+// repository's history.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// IsCommitHash reports whether s is a full hexadecimal commit SHA.
+func IsCommitHash(s string) bool {
+	return plumbing.IsHash(s)
+}
+
 // Sync fetches the latest state for repo from remote and returns a snapshot.
+// The revision checked out follows the repository's ref type, unless the
+// repository is held at a rollback commit which always takes precedence.
 func (m *Manager) Sync(ctx context.Context, repo storage.Repository, credential *storage.Credential, payload *storage.CredentialPayload) (*Snapshot, error) {
+	ctx, span := tracer.Start(ctx, "git sync", trace.WithAttributes(
+		tracing.RepoID.Int64(repo.ID),
+		tracing.RepoName.String(repo.Name),
+	))
+	defer span.End()
+
+	start := time.Now()
+	snapshot, err := m.sync(ctx, repo, credential, payload)
+	syncDuration.WithLabelValues(repo.Name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		syncErrors.WithLabelValues(repo.Name).Inc()
+		tracing.Fail(span, err)
+		return nil, err
+	}
+	span.SetAttributes(tracing.Commit.String(snapshot.CommitHash))
+	return snapshot, nil
+}
+
+func (m *Manager) sync(ctx context.Context, repo storage.Repository, credential *storage.Credential, payload *storage.CredentialPayload) (*Snapshot, error) {
 	if err := os.MkdirAll(m.baseDir, 0o755); err != nil {
 		return nil, fmt.Errorf("create base dir: %w", err)
 	}
@@ -69,40 +150,33 @@ func (m *Manager) Sync(ctx context.Context, repo storage.Repository, credential
 		return nil, err
 	}
 
-	refName := plumbing.NewBranchReferenceName(repo.Branch)
+	gitRepo, err := m.openOrClone(ctx, repo, repoPath, authMethod)
+	if err != nil {
+		return nil, err
+	}
 
-	gitRepo, err := gogit.PlainOpen(repoPath)
-	if errors.Is(err, gogit.ErrRepositoryNotExists) {
-		gitRepo, err = gogit.PlainCloneContext(ctx, repoPath, false, &gogit.CloneOptions{
-			URL:           repo.RepoURL,
-			ReferenceName: refName,
-			SingleBranch:  true,
-			Depth:         1,
-			Auth:          authMethod,
-		})
-		if err != nil {
-			os.RemoveAll(repoPath)
-			return nil, fmt.Errorf("clone repo: %w", err)
-		}
-	} else if err != nil {
-		return nil, fmt.Errorf("open repo: %w", err)
-	} else {
-		worktree, wErr := gitRepo.Worktree()
-		if wErr != nil {
-			return nil, fmt.Errorf("worktree: %w", wErr)
-		}
-		if err := worktree.PullContext(ctx, &gogit.PullOptions{
-			RemoteName:    "origin",
-			ReferenceName: refName,
-			SingleBranch:  true,
-			Force:         true,
-			Auth:          authMethod,
-		}); err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
-			return nil, fmt.Errorf("pull repo: %w", err)
+	target, ref, err := resolveTarget(gitRepo, repo)
+	if errors.Is(err, ErrRevisionNotFound) && isShallow(gitRepo) {
+		// Older clones were shallow and cannot reach historic commits. Replace
+		// them with a full clone and try again.
+		if err := os.RemoveAll(repoPath); err != nil {
+			return nil, fmt.Errorf("remove shallow clone: %w", err)
 		}
-		if err := worktree.Checkout(&gogit.CheckoutOptions{Branch: refName, Force: true}); err != nil {
-			return nil, fmt.Errorf("checkout branch: %w", err)
+		if gitRepo, err = m.openOrClone(ctx, repo, repoPath, authMethod); err != nil {
+			return nil, err
 		}
+		target, ref, err = resolveTarget(gitRepo, repo)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	worktree, err := gitRepo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("worktree: %w", err)
+	}
+	if err := worktree.Checkout(&gogit.CheckoutOptions{Hash: target, Force: true}); err != nil {
+		return nil, fmt.Errorf("checkout %s: %w", target, err)
 	}
 
 	hash, author, title, err := headMetadata(gitRepo)
@@ -114,10 +188,20 @@ func (m *Manager) Sync(ctx context.Context, repo storage.Repository, credential
 	if jobPath == "" {
 		jobPath = ".nomad"
 	}
+	// Repositories stored before overlay paths were checked may still hold
+	// one that escapes the clone.
+	if err := storage.CheckOverlayPath(jobPath, repo.OverlayPath); err != nil {
+		return nil, err
+	}
 	jobFiles, err := discoverJobFiles(repoPath, jobPath)
 	if err != nil {
 		return nil, err
 	}
+	if repo.OverlayPath != "" {
+		if err := attachOverlays(repoPath, jobPath, repo.OverlayPath, jobFiles); err != nil {
+			return nil, err
+		}
+	}
 	if len(jobFiles) == 0 {
 		searchRoot := jobPath
 		if !filepath.IsAbs(searchRoot) {
@@ -128,6 +212,7 @@ func (m *Manager) Sync(ctx context.Context, repo storage.Repository, credential
 
 	return &Snapshot{
 		RepoPath:     repoPath,
+		Ref:          ref,
 		CommitHash:   hash,
 		CommitAuthor: author,
 		CommitTitle:  title,
@@ -135,6 +220,163 @@ func (m *Manager) Sync(ctx context.Context, repo storage.Repository, credential
 	}, nil
 }
 
+// openOrClone returns the local clone for repo, cloning it when missing and
+// fetching the refs it tracks otherwise. Branch repositories only fetch their
+// branch; tag and commit repositories fetch every branch and tag.
+func (m *Manager) openOrClone(ctx context.Context, repo storage.Repository, repoPath string, authMethod transport.AuthMethod) (*gogit.Repository, error) {
+	followsBranch := repo.RefType == "" || repo.RefType == storage.RefTypeBranch
+	refName := plumbing.NewBranchReferenceName(repo.Branch)
+
+	gitRepo, err := gogit.PlainOpen(repoPath)
+	if errors.Is(err, gogit.ErrRepositoryNotExists) {
+		opts := &gogit.CloneOptions{
+			URL:  repo.RepoURL,
+			Auth: authMethod,
+		}
+		if followsBranch {
+			opts.ReferenceName = refName
+			opts.SingleBranch = true
+		} else {
+			opts.Tags = gogit.AllTags
+		}
+		gitRepo, err = gogit.PlainCloneContext(ctx, repoPath, false, opts)
+		if err != nil {
+			os.RemoveAll(repoPath)
+			return nil, fmt.Errorf("clone repo: %w", err)
+		}
+		return gitRepo, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("open repo: %w", err)
+	}
+
+	refSpecs := []config.RefSpec{
+		config.RefSpec(fmt.Sprintf("+%s:%s", refName, plumbing.NewRemoteReferenceName("origin", repo.Branch))),
+	}
+	if !followsBranch {
+		refSpecs = []config.RefSpec{
+			"+refs/heads/*:refs/remotes/origin/*",
+			"+refs/tags/*:refs/tags/*",
+		}
+	}
+	if err := gitRepo.FetchContext(ctx, &gogit.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   refSpecs,
+		Force:      true,
+		Auth:       authMethod,
+	}); err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return nil, fmt.Errorf("fetch repo: %w", err)
+	}
+	return gitRepo, nil
+}
+
+// resolveTarget returns the commit to check out for repo along with the ref
+// that selected it.
+func resolveTarget(gitRepo *gogit.Repository, repo storage.Repository) (plumbing.Hash, string, error) {
+	if repo.RollbackCommit.Valid && repo.RollbackCommit.String != "" {
+		hash, err := resolveCommit(gitRepo, repo.RollbackCommit.String)
+		return hash, repo.RollbackCommit.String, err
+	}
+
+	switch repo.RefType {
+	case storage.RefTypeCommit:
+		hash, err := resolveCommit(gitRepo, repo.Ref)
+		return hash, repo.Ref, err
+	case storage.RefTypeTag:
+		return resolveTag(gitRepo, repo.Ref)
+	default:
+		ref, err := gitRepo.Reference(plumbing.NewRemoteReferenceName("origin", repo.Branch), true)
+		if err != nil {
+			return plumbing.ZeroHash, "", fmt.Errorf("resolve branch %s: %w", repo.Branch, err)
+		}
+		return ref.Hash(), plumbing.NewBranchReferenceName(repo.Branch).String(), nil
+	}
+}
+
+func resolveCommit(gitRepo *gogit.Repository, revision string) (plumbing.Hash, error) {
+	if !plumbing.IsHash(revision) {
+		return plumbing.ZeroHash, fmt.Errorf("%w: %q is not a full commit SHA", ErrRevisionNotFound, revision)
+	}
+	hash := plumbing.NewHash(revision)
+	if _, err := gitRepo.CommitObject(hash); err != nil {
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return plumbing.ZeroHash, fmt.Errorf("%w: %s", ErrRevisionNotFound, revision)
+		}
+		return plumbing.ZeroHash, fmt.Errorf("commit object: %w", err)
+	}
+	return hash, nil
+}
+
+// resolveTag picks the highest semantic version tag satisfying constraint.
+// Tags that are not valid semantic versions are ignored.
+func resolveTag(gitRepo *gogit.Repository, constraint string) (plumbing.Hash, string, error) {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return plumbing.ZeroHash, "", fmt.Errorf("parse tag constraint %q: %w", constraint, err)
+	}
+
+	tags, err := gitRepo.Tags()
+	if err != nil {
+		return plumbing.ZeroHash, "", fmt.Errorf("list tags: %w", err)
+	}
+	var best *semver.Version
+	var bestRef *plumbing.Reference
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		version, err := semver.NewVersion(ref.Name().Short())
+		if err != nil || !c.Check(version) {
+			return nil
+		}
+		if best == nil || version.GreaterThan(best) {
+			best = version
+			bestRef = ref
+		}
+		return nil
+	})
+	if err != nil {
+		return plumbing.ZeroHash, "", fmt.Errorf("list tags: %w", err)
+	}
+	if bestRef == nil {
+		return plumbing.ZeroHash, "", fmt.Errorf("%w: no tag matches %q", ErrRevisionNotFound, constraint)
+	}
+
+	hash := bestRef.Hash()
+	// Annotated tags point at a tag object rather than the commit itself.
+	if tagObject, err := gitRepo.TagObject(hash); err == nil {
+		commit, err := tagObject.Commit()
+		if err != nil {
+			return plumbing.ZeroHash, "", fmt.Errorf("resolve tag %s: %w", bestRef.Name().Short(), err)
+		}
+		hash = commit.Hash
+	}
+	return hash, bestRef.Name().String(), nil
+}
+
+// ValidateRef checks that the ref settings for a repository are usable before
+// it is stored.
+func ValidateRef(refType storage.RefType, ref string, branch string) error {
+	switch refType {
+	case "", storage.RefTypeBranch:
+		if strings.TrimSpace(branch) == "" {
+			return errors.New("branch is required")
+		}
+	case storage.RefTypeCommit:
+		if !plumbing.IsHash(ref) {
+			return errors.New("ref must be a full commit SHA")
+		}
+	case storage.RefTypeTag:
+		if _, err := semver.NewConstraint(ref); err != nil {
+			return fmt.Errorf("ref must be a semver constraint: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown ref type %q", refType)
+	}
+	return nil
+}
+
+func isShallow(gitRepo *gogit.Repository) bool {
+	shallows, err := gitRepo.Storer.Shallow()
+	return err == nil && len(shallows) > 0
+}
+
 func headMetadata(gitRepo *gogit.Repository) (hash string, author string, title string, err error) {
 	ref, err := gitRepo.Head()
 	if err != nil {
@@ -151,6 +393,7 @@ func headMetadata(gitRepo *gogit.Repository) (hash string, author string, title
 	return ref.Hash().String(), fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email), titleLine, nil
 }
 
+// discoverJobFiles finds the job files under jobPath.
 func discoverJobFiles(repoPath string, jobPath string) ([]JobFile, error) {
 	searchRoot := jobPath
 	if searchRoot == "" {
@@ -159,7 +402,6 @@ func discoverJobFiles(repoPath string, jobPath string) ([]JobFile, error) {
 	if !filepath.IsAbs(searchRoot) {
 		searchRoot = filepath.Join(repoPath, searchRoot)
 	}
-
 	info, err := os.Stat(searchRoot)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
@@ -196,22 +438,92 @@ func discoverJobFiles(repoPath string, jobPath string) ([]JobFile, error) {
 	}
 
 	var files []JobFile
+	varFilesByDir := make(map[string][]VarFile)
 	for _, path := range paths {
 		data, err := os.ReadFile(path)
 		if err != nil {
 			return nil, err
 		}
-		rel, err := filepath.Rel(repoPath, path)
+		dir := filepath.Dir(path)
+		varFiles, ok := varFilesByDir[dir]
+		if !ok {
+			varFiles, err = discoverVarFiles(repoPath, dir)
+			if err != nil {
+				return nil, err
+			}
+			varFilesByDir[dir] = varFiles
+		}
+		files = append(files, JobFile{Path: relativePath(repoPath, path), FullPath: path, Content: data, VarFiles: varFiles})
+	}
+	return files, nil
+}
+
+// attachOverlays pairs each job file with the file at the same path relative
+// to jobPath inside overlayPath.
+func attachOverlays(repoPath string, jobPath string, overlayPath string, jobFiles []JobFile) error {
+	searchRoot := jobPath
+	if !filepath.IsAbs(searchRoot) {
+		searchRoot = filepath.Join(repoPath, searchRoot)
+	}
+	info, err := os.Stat(searchRoot)
+	if err != nil {
+		return err
+	}
+	overlayRoot := filepath.Join(repoPath, overlayPath)
+	for i := range jobFiles {
+		rel := filepath.Base(jobFiles[i].FullPath)
+		if info.IsDir() {
+			if rel, err = filepath.Rel(searchRoot, jobFiles[i].FullPath); err != nil {
+				return err
+			}
+		}
+		path := filepath.Join(overlayRoot, rel)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		jobFiles[i].Overlay = &OverlayFile{Path: relativePath(repoPath, path), FullPath: path, Content: data}
+	}
+	return nil
+}
+
+func discoverVarFiles(repoPath string, dir string) ([]VarFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []VarFile
+	for _, entry := range entries {
+		if entry.IsDir() || !hasVarFileExtension(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
 		if err != nil {
-			rel = path
+			return nil, err
 		}
-		files = append(files, JobFile{Path: rel, FullPath: path, Content: data})
+		files = append(files, VarFile{Path: relativePath(repoPath, path), FullPath: path, Content: data})
 	}
 	return files, nil
 }
 
+func relativePath(repoPath string, path string) string {
+	rel, err := filepath.Rel(repoPath, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
 func hasNomadExtension(name string) bool {
-	return strings.HasSuffix(name, ".nomad") || strings.HasSuffix(name, ".nomad.hcl")
+	return strings.HasSuffix(name, ".nomad") || strings.HasSuffix(name, ".nomad.hcl") || strings.HasSuffix(name, ".nomad.json")
+}
+
+func hasVarFileExtension(name string) bool {
+	return strings.HasSuffix(name, ".vars.hcl") || strings.HasSuffix(name, ".nomad.vars")
 }
 
 func authMethodForCredential(cred *storage.Credential, payload *storage.CredentialPayload) (transport.AuthMethod, error) {
@@ -2,8 +2,11 @@ package repo
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -163,3 +166,256 @@ func TestManagerSyncCustomJobPath(t *testing.T) {
 		}
 	}
 }
+
+func TestDiscoverJobFilesAttachesVarFiles(t *testing.T) {
+	repoPath := t.TempDir()
+	jobDir := filepath.Join(repoPath, ".nomad")
+	if err := os.MkdirAll(jobDir, 0o755); err != nil {
+		t.Fatalf("mkdir job dir: %v", err)
+	}
+	files := map[string]string{
+		"api.nomad.hcl":   `job "api" {}`,
+		"api.vars.hcl":    `image = "api:1"`,
+		"prod.nomad.vars": `count = 3`,
+		"web.nomad.json":  `{"ID": "web"}`,
+		"README.md":       "ignored",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(jobDir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	jobFiles, err := discoverJobFiles(repoPath, ".nomad")
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if len(jobFiles) != 2 {
+		t.Fatalf("expected 2 job files, got %d", len(jobFiles))
+	}
+	if jobFiles[0].IsJSON() || !jobFiles[1].IsJSON() || jobFiles[1].Path != ".nomad/web.nomad.json" {
+		t.Fatalf("unexpected job files: %s, %s", jobFiles[0].Path, jobFiles[1].Path)
+	}
+	varFiles := jobFiles[0].VarFiles
+	if len(varFiles) != 2 {
+		t.Fatalf("expected 2 var files, got %d", len(varFiles))
+	}
+	if varFiles[0].Path != ".nomad/api.vars.hcl" || varFiles[1].Path != ".nomad/prod.nomad.vars" {
+		t.Fatalf("unexpected var files: %s, %s", varFiles[0].Path, varFiles[1].Path)
+	}
+	if string(varFiles[0].Content) != files["api.vars.hcl"] {
+		t.Fatalf("unexpected var file content: %q", varFiles[0].Content)
+	}
+}
+
+func TestDiscoverJobFilesAttachesOverlays(t *testing.T) {
+	repoPath := t.TempDir()
+	files := map[string]string{
+		".nomad/api.nomad.hcl":              `job "api" {}`,
+		".nomad/web/web.nomad.hcl":          `job "web" {}`,
+		"overlays/prod/api.nomad.hcl":       `job "api" { datacenters = ["prod"] }`,
+		"overlays/prod/web/web.nomad.hcl":   `job "web" { datacenters = ["prod"] }`,
+		"overlays/prod/unmatched.nomad.hcl": `job "unmatched" {}`,
+		"overlays/staging/api.nomad.hcl":    `job "api" { datacenters = ["staging"] }`,
+	}
+	for name, content := range files {
+		path := filepath.Join(repoPath, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	jobFiles, err := discoverJobFiles(repoPath, ".nomad")
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if len(jobFiles) != 2 {
+		t.Fatalf("expected 2 job files, got %d", len(jobFiles))
+	}
+	if err := attachOverlays(repoPath, ".nomad", "overlays/prod", jobFiles); err != nil {
+		t.Fatalf("attach overlays: %v", err)
+	}
+	for _, jobFile := range jobFiles {
+		if jobFile.Overlay == nil {
+			t.Fatalf("expected overlay for %s", jobFile.Path)
+		}
+		if want := filepath.Join("overlays/prod", jobFile.Path[len(".nomad/"):]); jobFile.Overlay.Path != want {
+			t.Fatalf("expected overlay %s for %s, got %s", want, jobFile.Path, jobFile.Overlay.Path)
+		}
+	}
+}
+
+func TestManagerSyncRollbackCommit(t *testing.T) {
+	tmp := t.TempDir()
+	remotePath := filepath.Join(tmp, "remote")
+	if err := os.MkdirAll(filepath.Join(remotePath, ".nomad"), 0o755); err != nil {
+		t.Fatalf("mkdir remote: %v", err)
+	}
+
+	repo, err := gogit.PlainInit(remotePath, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("worktree: %v", err)
+	}
+
+	commitJob := func(content string, message string) string {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(remotePath, ".nomad", "job.nomad.hcl"), []byte(content), 0o644); err != nil {
+			t.Fatalf("write job: %v", err)
+		}
+		if _, err := wt.Add(".nomad/job.nomad.hcl"); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		hash, err := wt.Commit(message, &gogit.CommitOptions{
+			Author: &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+		return hash.String()
+	}
+
+	first := commitJob(`job "example" { datacenters = ["dc1"] }`, "first")
+	second := commitJob(`job "example" { datacenters = ["dc2"] }`, "second")
+
+	manager := NewManager(filepath.Join(tmp, "clones"))
+	record := storage.Repository{ID: 3, Name: "example", RepoURL: remotePath, Branch: "master", JobPath: ".nomad"}
+
+	snapshot, err := manager.Sync(context.Background(), record, nil, nil)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if snapshot.CommitHash != second {
+		t.Fatalf("expected head commit %s, got %s", second, snapshot.CommitHash)
+	}
+
+	record.RollbackCommit = sql.NullString{String: first, Valid: true}
+	snapshot, err = manager.Sync(context.Background(), record, nil, nil)
+	if err != nil {
+		t.Fatalf("rollback sync: %v", err)
+	}
+	if snapshot.CommitHash != first || snapshot.CommitTitle != "first" {
+		t.Fatalf("expected rollback commit %s, got %s (%s)", first, snapshot.CommitHash, snapshot.CommitTitle)
+	}
+	if !strings.Contains(string(snapshot.JobFiles[0].Content), "dc1") {
+		t.Fatalf("expected job content from rollback commit, got %s", snapshot.JobFiles[0].Content)
+	}
+
+	record.RollbackCommit = sql.NullString{String: strings.Repeat("a", 40), Valid: true}
+	if _, err := manager.Sync(context.Background(), record, nil, nil); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("expected revision not found, got %v", err)
+	}
+
+	third := commitJob(`job "example" { datacenters = ["dc3"] }`, "third")
+
+	record.RollbackCommit = sql.NullString{}
+	snapshot, err = manager.Sync(context.Background(), record, nil, nil)
+	if err != nil {
+		t.Fatalf("resume sync: %v", err)
+	}
+	if snapshot.CommitHash != third {
+		t.Fatalf("expected fetched head commit %s after resume, got %s", third, snapshot.CommitHash)
+	}
+}
+
+func TestManagerSyncTagConstraint(t *testing.T) {
+	tmp := t.TempDir()
+	remotePath := filepath.Join(tmp, "remote")
+	if err := os.MkdirAll(filepath.Join(remotePath, ".nomad"), 0o755); err != nil {
+		t.Fatalf("mkdir remote: %v", err)
+	}
+
+	repo, err := gogit.PlainInit(remotePath, false)
+	if err != nil {
+		t.Fatalf("init repo: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("worktree: %v", err)
+	}
+
+	signature := &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()}
+	tagged := map[string]string{}
+	for _, tag := range []string{"v1.3.0", "v1.4.0", "v1.4.2", "v1.5.0", "not-a-version"} {
+		if err := os.WriteFile(filepath.Join(remotePath, ".nomad", "job.nomad.hcl"), []byte(`job "example" { meta { version = "`+tag+`" } }`), 0o644); err != nil {
+			t.Fatalf("write job: %v", err)
+		}
+		if _, err := wt.Add(".nomad/job.nomad.hcl"); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		hash, err := wt.Commit("release "+tag, &gogit.CommitOptions{Author: signature})
+		if err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+		tagged[tag] = hash.String()
+		var opts *gogit.CreateTagOptions
+		if tag == "v1.4.2" {
+			opts = &gogit.CreateTagOptions{Tagger: signature, Message: "annotated " + tag}
+		}
+		if _, err := repo.CreateTag(tag, hash, opts); err != nil {
+			t.Fatalf("tag %s: %v", tag, err)
+		}
+	}
+
+	manager := NewManager(filepath.Join(tmp, "clones"))
+	record := storage.Repository{ID: 4, Name: "example", RepoURL: remotePath, JobPath: ".nomad", RefType: storage.RefTypeTag, Ref: "v1.4.x"}
+	snapshot, err := manager.Sync(context.Background(), record, nil, nil)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if snapshot.Ref != "refs/tags/v1.4.2" {
+		t.Fatalf("expected v1.4.2 to be selected, got %s", snapshot.Ref)
+	}
+	if snapshot.CommitHash != tagged["v1.4.2"] {
+		t.Fatalf("expected annotated tag to resolve to its commit %s, got %s", tagged["v1.4.2"], snapshot.CommitHash)
+	}
+
+	record.RefType = storage.RefTypeCommit
+	record.Ref = tagged["v1.3.0"]
+	snapshot, err = manager.Sync(context.Background(), record, nil, nil)
+	if err != nil {
+		t.Fatalf("sync commit: %v", err)
+	}
+	if snapshot.CommitHash != tagged["v1.3.0"] || snapshot.Ref != tagged["v1.3.0"] {
+		t.Fatalf("expected pinned commit %s, got %s (%s)", tagged["v1.3.0"], snapshot.CommitHash, snapshot.Ref)
+	}
+
+	record.RefType = storage.RefTypeTag
+	record.Ref = ">= 2.0.0"
+	if _, err := manager.Sync(context.Background(), record, nil, nil); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("expected no matching tag error, got %v", err)
+	}
+}
+
+func TestValidateRef(t *testing.T) {
+	cases := []struct {
+		name    string
+		refType storage.RefType
+		ref     string
+		branch  string
+		wantErr bool
+	}{
+		{name: "branch", refType: storage.RefTypeBranch, branch: "main"},
+		{name: "default type", branch: "main"},
+		{name: "missing branch", refType: storage.RefTypeBranch, wantErr: true},
+		{name: "commit", refType: storage.RefTypeCommit, ref: strings.Repeat("a", 40)},
+		{name: "short commit", refType: storage.RefTypeCommit, ref: "abc123", wantErr: true},
+		{name: "tag", refType: storage.RefTypeTag, ref: "v1.4.x"},
+		{name: "bad tag", refType: storage.RefTypeTag, ref: "latest!", wantErr: true},
+		{name: "unknown", refType: "sha", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRef(tc.refType, tc.ref, tc.branch)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ValidateRef() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
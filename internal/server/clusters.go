@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	"github.com/brianmichel/nomad-compass/internal/reconcile"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func (s *Server) handleListClusters(w http.ResponseWriter, r *http.Request) {
+	clusters, err := s.clusters.List(r.Context())
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	resp := make([]clusterResponse, 0, len(clusters))
+	for _, cluster := range clusters {
+		resp = append(resp, newClusterResponse(cluster))
+	}
+	respondJSON(w, resp)
+}
+
+func (s *Server) handleCreateCluster(w http.ResponseWriter, r *http.Request) {
+	var req createClusterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" || strings.TrimSpace(req.Address) == "" {
+		respondStatus(w, http.StatusBadRequest, errors.New("name and address are required"))
+		return
+	}
+	if (req.ClientCert == "") != (req.ClientKey == "") {
+		respondStatus(w, http.StatusBadRequest, errors.New("client_cert and client_key must be set together"))
+		return
+	}
+
+	cluster, err := s.clusters.Create(r.Context(), storage.ClusterInput{
+		Name:      req.Name,
+		Address:   req.Address,
+		Region:    req.Region,
+		Namespace: strings.TrimSpace(req.Namespace),
+		Secrets: storage.ClusterSecrets{
+			Token:     req.Token,
+			ClientKey: req.ClientKey,
+		},
+		CACert:        req.CACert,
+		ClientCert:    req.ClientCert,
+		TLSServerName: req.TLSServerName,
+		TLSSkipVerify: req.TLSSkipVerify,
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondJSON(w, newClusterResponse(*cluster))
+}
+
+func (s *Server) handleDeleteCluster(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.reconciler.DeleteCluster(r.Context(), id); err != nil {
+		if errors.Is(err, reconcile.ErrClusterInUse) {
+			respondStatus(w, http.StatusConflict, err)
+			return
+		}
+		respondErr(w, err)
+		return
+	}
+	respondStatus(w, http.StatusOK, nil)
+}
+
+// repoTarget returns the cluster repo deploys to.
+func (s *Server) repoTarget(ctx context.Context, repo storage.Repository) nomadclient.Target {
+	if !repo.ClusterID.Valid {
+		return s.clusterTarget(ctx, nomadclient.DefaultCluster)
+	}
+	return s.clusterTarget(ctx, repo.ClusterID.Int64)
+}
+
+// clusterTarget returns the target for a cluster. A cluster that cannot be
+// resolved yields a client whose calls fail with the reason.
+func (s *Server) clusterTarget(ctx context.Context, id int64) nomadclient.Target {
+	if id == nomadclient.DefaultCluster || s.targets == nil {
+		return nomadclient.Target{Client: s.nomad, Address: s.nomadAddr}
+	}
+	target, err := s.targets.Target(ctx, id)
+	if err != nil {
+		return nomadclient.Target{Client: nomadclient.Unavailable(fmt.Errorf("nomad cluster %d: %w", id, err))}
+	}
+	return target
+}
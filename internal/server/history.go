@@ -0,0 +1,97 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func (s *Server) handleRepoHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	page, err := parsePage(r)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+
+	runs, err := s.history.ListRuns(r.Context(), id, page)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	resp := pageResponse[reconcileRunResponse]{Items: make([]reconcileRunResponse, 0, len(runs)), Limit: page.Limit, Offset: page.Offset}
+	for _, run := range runs {
+		resp.Items = append(resp.Items, newReconcileRunResponse(run))
+	}
+	respondJSON(w, resp)
+}
+
+func (s *Server) handleListEvents(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	filter := storage.EventFilter{Page: page}
+	if filter.RepoID, err = parseOptionalID(r, "repo_id"); err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if filter.RunID, err = parseOptionalID(r, "run_id"); err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+
+	events, err := s.history.ListEvents(r.Context(), filter)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	resp := pageResponse[jobEventResponse]{Items: make([]jobEventResponse, 0, len(events)), Limit: page.Limit, Offset: page.Offset}
+	for _, event := range events {
+		resp.Items = append(resp.Items, newJobEventResponse(event))
+	}
+	respondJSON(w, resp)
+}
+
+// parsePage reads limit and offset query parameters and clamps them to the
+// bounds enforced by the storage layer.
+func parsePage(r *http.Request) (storage.Page, error) {
+	var page storage.Page
+	query := r.URL.Query()
+	if raw := query.Get("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return page, errors.New("limit must be an integer")
+		}
+		page.Limit = v
+	}
+	if raw := query.Get("offset"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return page, errors.New("offset must be an integer")
+		}
+		page.Offset = v
+	}
+	return page.Normalize(), nil
+}
+
+func parseOptionalID(r *http.Request, key string) (int64, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, errors.New(key + " must be an integer")
+	}
+	return v, nil
+}
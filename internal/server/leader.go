@@ -0,0 +1,46 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Instance roles reported by /api/status.
+const (
+	roleLeader   = "leader"
+	roleFollower = "follower"
+)
+
+type leaderElection interface {
+	ID() string
+	IsLeader() bool
+	Leader() string
+}
+
+// isLeader reports whether this instance reconciles. Without an election the
+// instance runs alone and always does.
+func (s *Server) isLeader() bool {
+	return s.election == nil || s.election.IsLeader()
+}
+
+// requireLeader rejects requests that change state on a follower. Followers
+// do not reconcile, so they could not act on the change. Routes that work on
+// a follower, such as plans, triggers and webhooks, are mounted without it.
+func (s *Server) requireLeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !s.isLeader() {
+				err := errors.New("this instance is a follower; send changes to the leader")
+				if leader := s.election.Leader(); leader != "" {
+					err = fmt.Errorf("this instance is a follower; send changes to the leader (%s)", leader)
+				}
+				respondStatus(w, http.StatusServiceUnavailable, err)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeElection struct {
+	leading bool
+	leader  string
+}
+
+func (f *fakeElection) ID() string     { return "compass-b" }
+func (f *fakeElection) IsLeader() bool { return f.leading }
+func (f *fakeElection) Leader() string { return f.leader }
+
+func TestFollowerRejectsChanges(t *testing.T) {
+	srv, _, _, _, _ := setupServer(t)
+	srv.election = &fakeElection{leader: "compass-a"}
+	handler := srv.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/repos/1/approve", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 from a follower, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "compass-a") {
+		t.Fatalf("expected the error to name the leader, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/repos", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected reads to be served by a follower, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestFollowerServesPlansTriggersAndWebhooks(t *testing.T) {
+	srv, _, _, _, _ := setupServer(t)
+	srv.election = &fakeElection{leader: "compass-a"}
+	handler := srv.Handler()
+
+	// The handlers reject these requests themselves, which shows they got
+	// past the follower check.
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/api/repos/abc/plan", http.StatusBadRequest},
+		{"/api/repos/abc/reconcile", http.StatusBadRequest},
+		{"/api/webhooks/github", http.StatusUnauthorized},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader("{}")))
+		if rec.Code != tc.want {
+			t.Fatalf("POST %s: expected %d from a follower, got %d: %s", tc.path, tc.want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestStatusReportsRole(t *testing.T) {
+	srv, _, _, _, _ := setupServer(t)
+	handler := srv.Handler()
+
+	status := func() statusResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp statusResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode status: %v", err)
+		}
+		return resp
+	}
+
+	if resp := status(); resp.Role != roleLeader || resp.Instance != "" {
+		t.Fatalf("expected a standalone instance to lead, got %+v", resp)
+	}
+
+	election := &fakeElection{leader: "compass-a"}
+	srv.election = election
+	resp := status()
+	if resp.Role != roleFollower || resp.Instance != "compass-b" || resp.Leader != "compass-a" {
+		t.Fatalf("unexpected follower status %+v", resp)
+	}
+
+	election.leading, election.leader = true, "compass-b"
+	if resp := status(); resp.Role != roleLeader || resp.Leader != "compass-b" {
+		t.Fatalf("unexpected leader status %+v", resp)
+	}
+}
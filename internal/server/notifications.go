@@ -0,0 +1,111 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/brianmichel/nomad-compass/internal/notify"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func (s *Server) handleListNotifications(w http.ResponseWriter, r *http.Request) {
+	channels, err := s.notifications.List(r.Context())
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	resp := make([]notificationResponse, 0, len(channels))
+	for _, channel := range channels {
+		resp = append(resp, newNotificationResponse(channel))
+	}
+	respondJSON(w, resp)
+}
+
+func (s *Server) handleCreateNotification(w http.ResponseWriter, r *http.Request) {
+	var req createNotificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		respondStatus(w, http.StatusBadRequest, errors.New("name is required"))
+		return
+	}
+	kind := storage.NotificationKind(req.Kind)
+	switch kind {
+	case storage.NotificationKindWebhook, storage.NotificationKindSlack:
+		if strings.TrimSpace(req.URL) == "" {
+			respondStatus(w, http.StatusBadRequest, errors.New("url is required"))
+			return
+		}
+	case storage.NotificationKindEmail:
+		if req.SMTPHost == "" || req.From == "" || len(req.To) == 0 {
+			respondStatus(w, http.StatusBadRequest, errors.New("smtp_host, from and to are required"))
+			return
+		}
+	default:
+		respondStatus(w, http.StatusBadRequest, fmt.Errorf("unknown notification kind %q", req.Kind))
+		return
+	}
+	for _, event := range req.Events {
+		if !notify.ValidEvent(event) {
+			respondStatus(w, http.StatusBadRequest, fmt.Errorf("unknown event %q", event))
+			return
+		}
+	}
+	if req.RepoID != 0 {
+		repo, err := s.repos.Get(r.Context(), req.RepoID)
+		if err != nil {
+			respondErr(w, err)
+			return
+		}
+		if repo == nil {
+			respondStatus(w, http.StatusBadRequest, fmt.Errorf("unknown repository %d", req.RepoID))
+			return
+		}
+	}
+
+	channel, err := s.notifications.Create(r.Context(), storage.NotificationChannelInput{
+		Name: req.Name,
+		Kind: kind,
+		RepoID: sql.NullInt64{
+			Int64: req.RepoID,
+			Valid: req.RepoID > 0,
+		},
+		Events: req.Events,
+		Settings: storage.NotificationSettings{
+			URL:      strings.TrimSpace(req.URL),
+			SMTPHost: req.SMTPHost,
+			SMTPPort: req.SMTPPort,
+			Username: req.Username,
+			Password: req.Password,
+			From:     req.From,
+			To:       req.To,
+		},
+	})
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondJSON(w, newNotificationResponse(*channel))
+}
+
+func (s *Server) handleDeleteNotification(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.notifications.Delete(r.Context(), id); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondStatus(w, http.StatusOK, nil)
+}
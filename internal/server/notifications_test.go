@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/brianmichel/nomad-compass/internal/auth"
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+func TestCreateNotificationValidatesAndHidesSettings(t *testing.T) {
+	srv, _, _, _, _ := setupServer(t)
+	db, err := storage.Open(filepath.Join(t.TempDir(), "notify.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := storage.Migrate(t.Context(), db); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	enc, err := auth.NewEncryptor([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+	srv.notifications = storage.NewNotificationStore(db, enc)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/notifications", bytes.NewBufferString(body))
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, body := range []string{
+		`{"name":"ops","kind":"pager","url":"https://example.com"}`,
+		`{"name":"ops","kind":"slack"}`,
+		`{"name":"ops","kind":"slack","url":"https://example.com","events":["exploded"]}`,
+		`{"name":"ops","kind":"email","smtp_host":"mail.example.com"}`,
+		`{"name":"ops","kind":"slack","url":"https://example.com","repo_id":99}`,
+	} {
+		if rec := post(body); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", body, rec.Code)
+		}
+	}
+
+	rec := post(`{"name":"ops","kind":"slack","url":"https://hooks.slack.test/secret","events":["apply_failed"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if bytes.Contains(rec.Body.Bytes(), []byte("hooks.slack.test")) {
+		t.Fatalf("response leaked channel settings: %s", rec.Body.String())
+	}
+	var resp notificationResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Kind != "slack" || len(resp.Events) != 1 || resp.Events[0] != "apply_failed" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+}
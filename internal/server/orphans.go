@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/brianmichel/nomad-compass/internal/reconcile"
+)
+
+func (s *Server) handleListOrphans(w http.ResponseWriter, r *http.Request) {
+	orphans, err := s.reconciler.Orphans(r.Context())
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	resp := make([]orphanJobResponse, 0, len(orphans))
+	for _, orphan := range orphans {
+		resp = append(resp, newOrphanJobResponse(orphan))
+	}
+	respondJSON(w, resp)
+}
+
+func (s *Server) handleAdoptOrphan(w http.ResponseWriter, r *http.Request) {
+	cluster, err := orphanCluster(r)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.reconciler.AdoptOrphan(r.Context(), cluster, r.URL.Query().Get("namespace"), chi.URLParam(r, "jobID")); err != nil {
+		respondOrphanErr(w, err)
+		return
+	}
+	respondStatus(w, http.StatusOK, nil)
+}
+
+func (s *Server) handleDeregisterOrphan(w http.ResponseWriter, r *http.Request) {
+	cluster, err := orphanCluster(r)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.reconciler.DeregisterOrphan(r.Context(), cluster, r.URL.Query().Get("namespace"), chi.URLParam(r, "jobID")); err != nil {
+		respondOrphanErr(w, err)
+		return
+	}
+	respondStatus(w, http.StatusOK, nil)
+}
+
+// orphanCluster reads the optional cluster query parameter. Without it an
+// orphan in any cluster matches; 0 names the default cluster.
+func orphanCluster(r *http.Request) (int64, error) {
+	raw := r.URL.Query().Get("cluster")
+	if raw == "" {
+		return reconcile.AnyCluster, nil
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid cluster %q", raw)
+	}
+	return id, nil
+}
+
+func respondOrphanErr(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, reconcile.ErrOrphanNotFound):
+		respondStatus(w, http.StatusNotFound, err)
+	case errors.Is(err, reconcile.ErrOrphanNoRepository), errors.Is(err, reconcile.ErrOrphanAmbiguous):
+		respondStatus(w, http.StatusConflict, err)
+	default:
+		respondErr(w, err)
+	}
+}
@@ -44,8 +44,10 @@ func (s *Server) buildJobResponse(ctx context.Context, repo storage.Repository,
 	}
 
 	jobResp.JobID = file.JobID.String
+	jobResp.Namespace = file.Namespace.String
 
-	status, err := s.nomad.JobStatus(ctx, file.JobID.String)
+	target := s.repoTarget(ctx, repo)
+	status, err := target.Client.JobStatus(ctx, file.Namespace.String, file.JobID.String)
 	if err != nil {
 		if s.logger != nil {
 			s.logger.Warn("fetch job status failed", "repo_id", repo.ID, "repo", repo.Name, "job_id", file.JobID.String, "error", err)
@@ -58,7 +60,7 @@ func (s *Server) buildJobResponse(ctx context.Context, repo storage.Repository,
 	}
 
 	if status.Exists {
-		applyNomadStatus(&jobResp, status, s.nomadAddr)
+		applyNomadStatus(&jobResp, status, target.Address)
 	} else {
 		jobResp.Status = "missing"
 		jobResp.StatusDescription = "Job not found in Nomad"
@@ -2,9 +2,14 @@ package server
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/brianmichel/nomad-compass/internal/jobpolicy"
 	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	"github.com/brianmichel/nomad-compass/internal/reconcile"
 	"github.com/brianmichel/nomad-compass/internal/storage"
 )
 
@@ -32,6 +37,7 @@ type repositoryResponse struct {
 	RepoURL          string                  `json:"repo_url"`
 	Branch           string                  `json:"branch"`
 	JobPath          string                  `json:"job_path"`
+	OverlayPath      string                  `json:"overlay_path,omitempty"`
 	CredentialID     *int64                  `json:"credential_id,omitempty"`
 	CreatedAt        time.Time               `json:"created_at"`
 	UpdatedAt        time.Time               `json:"updated_at"`
@@ -39,16 +45,36 @@ type repositoryResponse struct {
 	LastCommitAuthor *string                 `json:"last_commit_author,omitempty"`
 	LastCommitTitle  *string                 `json:"last_commit_title,omitempty"`
 	LastPolledAt     *time.Time              `json:"last_polled_at,omitempty"`
+	Variables        map[string]string       `json:"variables,omitempty"`
+	SyncPolicy       string                  `json:"sync_policy"`
+	RollbackCommit   *string                 `json:"rollback_commit,omitempty"`
+	RefType          string                  `json:"ref_type"`
+	Ref              string                  `json:"ref,omitempty"`
+	ResolvedRef      *string                 `json:"resolved_ref,omitempty"`
+	PollInterval     *int64                  `json:"poll_interval_seconds,omitempty"`
+	FailureCount     int                     `json:"failure_count"`
+	NextPollAt       *time.Time              `json:"next_poll_at,omitempty"`
+	AutoRevert       bool                    `json:"auto_revert"`
+	UnhealthyCommit  *string                 `json:"unhealthy_commit,omitempty"`
+	UnhealthyReason  *string                 `json:"unhealthy_reason,omitempty"`
+	UnhealthyAt      *time.Time              `json:"unhealthy_at,omitempty"`
+	Namespaces       []string                `json:"namespaces,omitempty"`
+	ClusterID        *int64                  `json:"cluster_id,omitempty"`
+	JobPolicy        *jobpolicy.Rules        `json:"job_policy,omitempty"`
+	StatusProvider   string                  `json:"status_provider,omitempty"`
+	StatusAPIURL     string                  `json:"status_api_url,omitempty"`
+	WebhookEnabled   bool                    `json:"webhook_enabled"`
 	Jobs             []repositoryJobResponse `json:"jobs"`
 }
 
 func newRepositoryResponse(repo storage.Repository) repositoryResponse {
-	return repositoryResponse{
+	resp := repositoryResponse{
 		ID:               repo.ID,
 		Name:             repo.Name,
 		RepoURL:          repo.RepoURL,
 		Branch:           repo.Branch,
 		JobPath:          repo.JobPath,
+		OverlayPath:      repo.OverlayPath,
 		CredentialID:     nullableInt64(repo.CredentialID),
 		CreatedAt:        repo.CreatedAt,
 		UpdatedAt:        repo.UpdatedAt,
@@ -56,8 +82,31 @@ func newRepositoryResponse(repo storage.Repository) repositoryResponse {
 		LastCommitAuthor: nullableString(repo.LastCommitAuthor),
 		LastCommitTitle:  nullableString(repo.LastCommitTitle),
 		LastPolledAt:     nullableTime(repo.LastPolledAt),
+		Variables:        repo.Variables,
+		SyncPolicy:       string(repo.SyncPolicy),
+		RollbackCommit:   nullableString(repo.RollbackCommit),
+		RefType:          string(repo.RefType),
+		Ref:              repo.Ref,
+		ResolvedRef:      nullableString(repo.ResolvedRef),
+		PollInterval:     nullableInt64(repo.PollInterval),
+		FailureCount:     repo.FailureCount,
+		NextPollAt:       nullableTime(repo.NextPollAt),
+		AutoRevert:       repo.AutoRevert,
+		UnhealthyCommit:  nullableString(repo.UnhealthyCommit),
+		UnhealthyReason:  nullableString(repo.UnhealthyReason),
+		UnhealthyAt:      nullableTime(repo.UnhealthyAt),
+		Namespaces:       repo.Namespaces,
+		ClusterID:        nullableInt64(repo.ClusterID),
+		StatusProvider:   repo.StatusProvider,
+		StatusAPIURL:     repo.StatusAPIURL,
+		WebhookEnabled:   len(repo.WebhookSecret) > 0,
 		Jobs:             []repositoryJobResponse{},
 	}
+	if !repo.JobPolicy.Empty() {
+		rules := repo.JobPolicy
+		resp.JobPolicy = &rules
+	}
+	return resp
 }
 
 type repositoryJobResponse struct {
@@ -84,19 +133,227 @@ type repositoryJobResponse struct {
 	LatestAllocationName string                         `json:"latest_allocation_name,omitempty"`
 	JobURL               string                         `json:"job_url,omitempty"`
 	Allocations          []nomadclient.AllocationStatus `json:"allocations,omitempty"`
+	LastError            *string                        `json:"last_error,omitempty"`
+	LastErrorPhase       *string                        `json:"last_error_phase,omitempty"`
+	LastErrorAt          *time.Time                     `json:"last_error_at,omitempty"`
 }
 
 func newRepositoryJobResponse(file storage.RepoFile) repositoryJobResponse {
 	return repositoryJobResponse{
-		Path:       file.Path,
-		LastCommit: nullableString(file.LastCommit),
-		UpdatedAt:  file.UpdatedAt,
+		Path:           file.Path,
+		LastCommit:     nullableString(file.LastCommit),
+		UpdatedAt:      file.UpdatedAt,
+		LastError:      nullableString(file.LastError),
+		LastErrorPhase: nullableString(file.LastErrorPhase),
+		LastErrorAt:    nullableTime(file.LastErrorAt),
+	}
+}
+
+type reconcileRunResponse struct {
+	ID         int64      `json:"id"`
+	RepoID     int64      `json:"repo_id"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Commit     *string    `json:"commit,omitempty"`
+	Ref        *string    `json:"ref,omitempty"`
+	Outcome    string     `json:"outcome"`
+	Summary    string     `json:"summary,omitempty"`
+	Error      *string    `json:"error,omitempty"`
+}
+
+func newReconcileRunResponse(run storage.ReconcileRun) reconcileRunResponse {
+	return reconcileRunResponse{
+		ID:         run.ID,
+		RepoID:     run.RepoID,
+		StartedAt:  run.StartedAt,
+		FinishedAt: nullableTime(run.FinishedAt),
+		Commit:     nullableString(run.Commit),
+		Ref:        nullableString(run.Ref),
+		Outcome:    run.Outcome,
+		Summary:    run.Summary,
+		Error:      nullableString(run.Error),
+	}
+}
+
+type jobEventResponse struct {
+	ID        int64     `json:"id"`
+	RunID     int64     `json:"run_id"`
+	RepoID    int64     `json:"repo_id"`
+	Path      string    `json:"path"`
+	JobID     *string   `json:"job_id,omitempty"`
+	Commit    *string   `json:"commit,omitempty"`
+	Action    string    `json:"action"`
+	Phase     *string   `json:"phase,omitempty"`
+	Summary   string    `json:"summary,omitempty"`
+	Error     *string   `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newJobEventResponse(event storage.JobEvent) jobEventResponse {
+	return jobEventResponse{
+		ID:        event.ID,
+		RunID:     event.RunID,
+		RepoID:    event.RepoID,
+		Path:      event.Path,
+		JobID:     nullableString(event.JobID),
+		Commit:    nullableString(event.Commit),
+		Action:    event.Action,
+		Phase:     nullableString(event.Phase),
+		Summary:   event.Summary,
+		Error:     nullableString(event.Error),
+		CreatedAt: event.CreatedAt,
+	}
+}
+
+type pendingChangeResponse struct {
+	Path      string          `json:"path"`
+	JobID     *string         `json:"job_id,omitempty"`
+	Commit    *string         `json:"commit,omitempty"`
+	Action    string          `json:"action"`
+	Summary   string          `json:"summary,omitempty"`
+	Diff      json.RawMessage `json:"diff,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func newPendingChangeResponse(change storage.PendingChange) pendingChangeResponse {
+	resp := pendingChangeResponse{
+		Path:      change.Path,
+		JobID:     nullableString(change.JobID),
+		Commit:    nullableString(change.Commit),
+		Action:    change.Action,
+		Summary:   change.Summary,
+		CreatedAt: change.CreatedAt,
+	}
+	if change.Diff.Valid {
+		resp.Diff = json.RawMessage(change.Diff.String)
+	}
+	return resp
+}
+
+type jobConflictResponse struct {
+	Path         string    `json:"path"`
+	JobID        string    `json:"job_id"`
+	OwnerRepoURL string    `json:"owner_repo_url"`
+	OwnerJobFile string    `json:"owner_job_file,omitempty"`
+	Takeover     bool      `json:"takeover"`
+	DetectedAt   time.Time `json:"detected_at"`
+}
+
+func newJobConflictResponse(conflict storage.JobConflict) jobConflictResponse {
+	return jobConflictResponse{
+		Path:         conflict.Path,
+		JobID:        conflict.JobID,
+		OwnerRepoURL: conflict.OwnerRepoURL,
+		OwnerJobFile: conflict.OwnerJobFile,
+		Takeover:     conflict.Takeover,
+		DetectedAt:   conflict.DetectedAt,
+	}
+}
+
+type orphanJobResponse struct {
+	JobID     string `json:"job_id"`
+	Namespace string `json:"namespace,omitempty"`
+	ClusterID int64  `json:"cluster_id"`
+	Status    string `json:"status,omitempty"`
+	RepoURL   string `json:"repo_url"`
+	RepoName  string `json:"repo_name,omitempty"`
+	JobFile   string `json:"job_file,omitempty"`
+	Commit    string `json:"commit,omitempty"`
+	RepoID    *int64 `json:"repo_id,omitempty"`
+}
+
+func newOrphanJobResponse(orphan reconcile.OrphanJob) orphanJobResponse {
+	resp := orphanJobResponse{
+		JobID:     orphan.JobID,
+		Namespace: orphan.Namespace,
+		ClusterID: orphan.ClusterID,
+		Status:    orphan.Status,
+		RepoURL:   orphan.RepoURL,
+		RepoName:  orphan.RepoName,
+		JobFile:   orphan.JobFile,
+		Commit:    orphan.Commit,
+	}
+	if orphan.RepoID != 0 {
+		repoID := orphan.RepoID
+		resp.RepoID = &repoID
 	}
+	return resp
+}
+
+type pageResponse[T any] struct {
+	Items  []T `json:"items"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
 }
 
 type statusResponse struct {
-	NomadConnected bool   `json:"nomad_connected"`
-	NomadMessage   string `json:"nomad_message,omitempty"`
+	NomadConnected bool                    `json:"nomad_connected"`
+	NomadMessage   string                  `json:"nomad_message,omitempty"`
+	Clusters       []clusterStatusResponse `json:"clusters,omitempty"`
+	// Role is "leader" when this instance reconciles and "follower" when it
+	// only serves reads.
+	Role     string `json:"role"`
+	Instance string `json:"instance,omitempty"`
+	Leader   string `json:"leader,omitempty"`
+}
+
+type clusterStatusResponse struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+	Message   string `json:"message,omitempty"`
+}
+
+type clusterResponse struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	Address       string    `json:"address"`
+	Region        string    `json:"region,omitempty"`
+	Namespace     string    `json:"namespace,omitempty"`
+	TLSServerName string    `json:"tls_server_name,omitempty"`
+	TLSSkipVerify bool      `json:"tls_skip_verify"`
+	HasCACert     bool      `json:"has_ca_cert"`
+	HasClientCert bool      `json:"has_client_cert"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func newClusterResponse(c storage.Cluster) clusterResponse {
+	return clusterResponse{
+		ID:            c.ID,
+		Name:          c.Name,
+		Address:       c.Address,
+		Region:        c.Region,
+		Namespace:     c.Namespace,
+		TLSServerName: c.TLSServerName,
+		TLSSkipVerify: c.TLSSkipVerify,
+		HasCACert:     c.CACert != "",
+		HasClientCert: c.ClientCert != "",
+		CreatedAt:     c.CreatedAt,
+		UpdatedAt:     c.UpdatedAt,
+	}
+}
+
+type notificationResponse struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	RepoID    *int64    `json:"repo_id,omitempty"`
+	Events    []string  `json:"events,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newNotificationResponse(c storage.NotificationChannel) notificationResponse {
+	return notificationResponse{
+		ID:        c.ID,
+		Name:      c.Name,
+		Kind:      string(c.Kind),
+		RepoID:    nullableInt64(c.RepoID),
+		Events:    c.Events,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+	}
 }
 
 func nullableInt64(v sql.NullInt64) *int64 {
@@ -122,3 +379,43 @@ func nullableTime(v sql.NullTime) *time.Time {
 	val := v.Time
 	return &val
 }
+
+type repoPlanResponse struct {
+	Commit string            `json:"commit"`
+	Ref    string            `json:"ref,omitempty"`
+	Jobs   []jobPlanResponse `json:"jobs"`
+}
+
+type jobPlanResponse struct {
+	Path              string                           `json:"path"`
+	JobID             string                           `json:"job_id,omitempty"`
+	Namespace         string                           `json:"namespace,omitempty"`
+	Wave              int                              `json:"wave"`
+	Action            string                           `json:"action"`
+	Diff              *api.JobDiff                     `json:"diff,omitempty"`
+	PlacementFailures map[string]*api.AllocationMetric `json:"placement_failures,omitempty"`
+	Warnings          string                           `json:"warnings,omitempty"`
+	Error             string                           `json:"error,omitempty"`
+}
+
+func newRepoPlanResponse(plan *reconcile.RepoPlan) repoPlanResponse {
+	resp := repoPlanResponse{
+		Commit: plan.Commit,
+		Ref:    plan.Ref,
+		Jobs:   make([]jobPlanResponse, 0, len(plan.Jobs)),
+	}
+	for _, job := range plan.Jobs {
+		resp.Jobs = append(resp.Jobs, jobPlanResponse{
+			Path:              job.Path,
+			JobID:             job.JobID,
+			Namespace:         job.Namespace,
+			Wave:              job.Wave,
+			Action:            job.Action,
+			Diff:              job.Diff,
+			PlacementFailures: job.PlacementFailures,
+			Warnings:          job.Warnings,
+			Error:             job.Error,
+		})
+	}
+	return resp
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
@@ -14,8 +16,13 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/brianmichel/nomad-compass/internal/commitstatus"
+	"github.com/brianmichel/nomad-compass/internal/jobpolicy"
 	"github.com/brianmichel/nomad-compass/internal/nomadclient"
+	"github.com/brianmichel/nomad-compass/internal/reconcile"
+	repomodel "github.com/brianmichel/nomad-compass/internal/repo"
 	"github.com/brianmichel/nomad-compass/internal/storage"
 	"github.com/brianmichel/nomad-compass/internal/web"
 )
@@ -25,7 +32,9 @@ import (
 // touching handler code.
 type repoStore interface {
 	List(ctx context.Context) ([]storage.Repository, error)
+	Get(ctx context.Context, id int64) (*storage.Repository, error)
 	Create(ctx context.Context, input storage.RepositoryInput) (*storage.Repository, error)
+	DecryptWebhookSecret(r *storage.Repository) (string, error)
 }
 
 type repoFileStore interface {
@@ -37,33 +46,72 @@ type credentialStore interface {
 	Create(ctx context.Context, name string, ctype storage.CredentialType, payload storage.CredentialPayload) (*storage.Credential, error)
 }
 
+type clusterStore interface {
+	List(ctx context.Context) ([]storage.Cluster, error)
+	Get(ctx context.Context, id int64) (*storage.Cluster, error)
+	Create(ctx context.Context, input storage.ClusterInput) (*storage.Cluster, error)
+}
+
+type notificationStore interface {
+	List(ctx context.Context) ([]storage.NotificationChannel, error)
+	Create(ctx context.Context, input storage.NotificationChannelInput) (*storage.NotificationChannel, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+type historyStore interface {
+	ListRuns(ctx context.Context, repoID int64, page storage.Page) ([]storage.ReconcileRun, error)
+	ListEvents(ctx context.Context, filter storage.EventFilter) ([]storage.JobEvent, error)
+}
+
 type reconcileManager interface {
-	ReconcileRepo(ctx context.Context, repoID int64) error
+	TriggerRepo(ctx context.Context, repoID int64) error
 	DeleteRepository(ctx context.Context, repoID int64, unschedule bool) error
 	DeleteCredential(ctx context.Context, credentialID int64, deleteRepos bool, unschedule bool) error
+	PendingChanges(ctx context.Context, repoID int64) ([]storage.PendingChange, error)
+	ApproveRepo(ctx context.Context, repoID int64) error
+	RollbackRepo(ctx context.Context, repoID int64, commit string) error
+	ResumeRepo(ctx context.Context, repoID int64) error
+	Orphans(ctx context.Context) ([]reconcile.OrphanJob, error)
+	AdoptOrphan(ctx context.Context, cluster int64, namespace, jobID string) error
+	DeregisterOrphan(ctx context.Context, cluster int64, namespace, jobID string) error
+	JobConflicts(ctx context.Context, repoID int64) ([]storage.JobConflict, error)
+	TakeoverJob(ctx context.Context, repoID int64, path string) error
+	AcknowledgeRepo(ctx context.Context, repoID int64) error
+	PlanRepo(ctx context.Context, repoID int64) (*reconcile.RepoPlan, error)
+	DeleteCluster(ctx context.Context, id int64) error
 }
 
 // Server exposes HTTP handlers for UI and API requests.
 type Server struct {
-	repos      repoStore
-	files      repoFileStore
-	creds      credentialStore
-	reconciler reconcileManager
-	nomad      nomadclient.Client
-	logger     *slog.Logger
-	nomadAddr  string
+	repos         repoStore
+	files         repoFileStore
+	creds         credentialStore
+	clusters      clusterStore
+	notifications notificationStore
+	history       historyStore
+	reconciler    reconcileManager
+	election      leaderElection
+	nomad         nomadclient.Client
+	targets       *nomadclient.Pool
+	logger        *slog.Logger
+	nomadAddr     string
 }
 
 // New constructs a Server.
-func New(repos repoStore, files repoFileStore, creds credentialStore, reconciler reconcileManager, nomad nomadclient.Client, nomadAddr string, logger *slog.Logger) *Server {
+func New(repos repoStore, files repoFileStore, creds credentialStore, clusters clusterStore, notifications notificationStore, history historyStore, reconciler reconcileManager, election leaderElection, targets *nomadclient.Pool, logger *slog.Logger) *Server {
 	return &Server{
-		repos:      repos,
-		files:      files,
-		creds:      creds,
-		reconciler: reconciler,
-		nomad:      nomad,
-		logger:     logger,
-		nomadAddr:  nomadAddr,
+		repos:         repos,
+		files:         files,
+		creds:         creds,
+		clusters:      clusters,
+		notifications: notifications,
+		history:       history,
+		reconciler:    reconciler,
+		election:      election,
+		nomad:         targets.Default().Client,
+		targets:       targets,
+		logger:        logger,
+		nomadAddr:     targets.Default().Address,
 	}
 }
 
@@ -73,23 +121,51 @@ func (s *Server) Handler() http.Handler {
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
+	r.Use(traceRequests)
 	r.Use(middleware.Recoverer)
 
 	r.Get("/api/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	r.Handle("/metrics", promhttp.Handler())
 
 	r.Route("/api", func(api chi.Router) {
+		// Plans only read, and a follower leaves triggered reconciles for
+		// the leader to pick up, so followers serve these too.
+		api.Post("/repos/{id}/plan", s.handlePlanRepo)
+		api.Post("/repos/{id}/reconcile", s.handleTriggerRepo)
+		api.Post("/webhooks/{provider}", s.handleWebhook)
+
+		api = api.With(s.requireLeader)
 		api.Get("/status", s.handleStatus)
 		api.Get("/repos", s.handleListRepos)
 		api.Post("/repos", s.handleCreateRepo)
-		api.Post("/repos/{id}/reconcile", s.handleTriggerRepo)
 		api.Delete("/repos/{id}", s.handleDeleteRepo)
+		api.Get("/repos/{id}/history", s.handleRepoHistory)
+		api.Get("/repos/{id}/pending", s.handlePendingChanges)
+		api.Post("/repos/{id}/approve", s.handleApproveRepo)
+		api.Post("/repos/{id}/rollback", s.handleRollbackRepo)
+		api.Post("/repos/{id}/resume", s.handleResumeRepo)
+		api.Post("/repos/{id}/acknowledge", s.handleAcknowledgeRepo)
+		api.Get("/repos/{id}/conflicts", s.handleJobConflicts)
+		api.Post("/repos/{id}/takeover", s.handleTakeoverJob)
+		api.Get("/events", s.handleListEvents)
+		api.Get("/orphans", s.handleListOrphans)
+		api.Post("/orphans/{jobID}/adopt", s.handleAdoptOrphan)
+		api.Delete("/orphans/{jobID}", s.handleDeregisterOrphan)
 
 		api.Get("/credentials", s.handleListCredentials)
 		api.Post("/credentials", s.handleCreateCredential)
 		api.Delete("/credentials/{id}", s.handleDeleteCredential)
+
+		api.Get("/clusters", s.handleListClusters)
+		api.Post("/clusters", s.handleCreateCluster)
+		api.Delete("/clusters/{id}", s.handleDeleteCluster)
+
+		api.Get("/notifications", s.handleListNotifications)
+		api.Post("/notifications", s.handleCreateNotification)
+		api.Delete("/notifications/{id}", s.handleDeleteNotification)
 	})
 
 	distFS, err := fs.Sub(web.FS(), "dist")
@@ -118,6 +194,33 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 		respondStatus(w, http.StatusBadRequest, err)
 		return
 	}
+	if policy := storage.SyncPolicy(req.SyncPolicy); policy != "" && !policy.Valid() {
+		respondStatus(w, http.StatusBadRequest, fmt.Errorf("unknown sync policy %q", req.SyncPolicy))
+		return
+	}
+	if err := repomodel.ValidateRef(storage.RefType(req.RefType), req.Ref, req.Branch); err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.PollInterval < 0 {
+		respondStatus(w, http.StatusBadRequest, errors.New("poll_interval_seconds must not be negative"))
+		return
+	}
+	if req.StatusProvider != "" && !commitstatus.ValidProvider(req.StatusProvider) {
+		respondStatus(w, http.StatusBadRequest, fmt.Errorf("unknown status provider %q", req.StatusProvider))
+		return
+	}
+	if req.ClusterID != 0 {
+		cluster, err := s.clusters.Get(r.Context(), req.ClusterID)
+		if err != nil {
+			respondErr(w, err)
+			return
+		}
+		if cluster == nil {
+			respondStatus(w, http.StatusBadRequest, fmt.Errorf("unknown cluster %d", req.ClusterID))
+			return
+		}
+	}
 
 	repo, err := s.repos.Create(r.Context(), storage.RepositoryInput{
 		Name:    req.Name,
@@ -128,6 +231,22 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 			Int64: req.CredentialID,
 			Valid: req.CredentialID > 0,
 		},
+		Variables:    req.Variables,
+		SyncPolicy:   storage.SyncPolicy(req.SyncPolicy),
+		RefType:      storage.RefType(req.RefType),
+		Ref:          req.Ref,
+		PollInterval: req.PollInterval,
+		AutoRevert:   req.AutoRevert,
+		Namespaces:   cleanNamespaces(req.Namespaces),
+		ClusterID: sql.NullInt64{
+			Int64: req.ClusterID,
+			Valid: req.ClusterID > 0,
+		},
+		JobPolicy:      req.JobPolicy,
+		OverlayPath:    req.OverlayPath,
+		StatusProvider: req.StatusProvider,
+		StatusAPIURL:   req.StatusAPIURL,
+		WebhookSecret:  req.WebhookSecret,
 	})
 	if err != nil {
 		respondErr(w, err)
@@ -135,25 +254,179 @@ func (s *Server) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if s.reconciler != nil {
-		go func(repoID int64) {
-			if err := s.reconciler.ReconcileRepo(context.Background(), repoID); err != nil {
-				if s.logger != nil {
-					s.logger.Error("initial reconcile failed", "repo_id", repoID, "error", err)
-				}
-			}
-		}(repo.ID)
+		if err := s.reconciler.TriggerRepo(r.Context(), repo.ID); err != nil && s.logger != nil {
+			s.logger.Error("queue initial reconcile failed", "repo_id", repo.ID, "error", err)
+		}
 	}
 
 	respondJSON(w, newRepositoryResponse(*repo))
 }
 
+// cleanNamespaces trims namespace names and drops blanks and duplicates.
+func cleanNamespaces(namespaces []string) []string {
+	var cleaned []string
+	seen := make(map[string]struct{}, len(namespaces))
+	for _, namespace := range namespaces {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" {
+			continue
+		}
+		if _, ok := seen[namespace]; ok {
+			continue
+		}
+		seen[namespace] = struct{}{}
+		cleaned = append(cleaned, namespace)
+	}
+	return cleaned
+}
+
 func (s *Server) handleTriggerRepo(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
 		respondStatus(w, http.StatusBadRequest, err)
 		return
 	}
-	if err := s.reconciler.ReconcileRepo(r.Context(), id); err != nil {
+	if err := s.reconciler.TriggerRepo(r.Context(), id); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondStatus(w, http.StatusAccepted, nil)
+}
+
+func (s *Server) handlePendingChanges(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	changes, err := s.reconciler.PendingChanges(r.Context(), id)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	resp := make([]pendingChangeResponse, 0, len(changes))
+	for _, change := range changes {
+		resp = append(resp, newPendingChangeResponse(change))
+	}
+	respondJSON(w, resp)
+}
+
+func (s *Server) handleApproveRepo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.reconciler.ApproveRepo(r.Context(), id); err != nil {
+		if errors.Is(err, reconcile.ErrNoPendingChanges) || errors.Is(err, reconcile.ErrPendingChangesStale) || errors.Is(err, reconcile.ErrDetectOnly) {
+			respondStatus(w, http.StatusConflict, err)
+			return
+		}
+		respondErr(w, err)
+		return
+	}
+	respondStatus(w, http.StatusOK, nil)
+}
+
+func (s *Server) handleRollbackRepo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	var req rollbackRepoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.reconciler.RollbackRepo(r.Context(), id, strings.TrimSpace(req.Commit)); err != nil {
+		switch {
+		case errors.Is(err, reconcile.ErrInvalidCommit), errors.Is(err, repomodel.ErrRevisionNotFound):
+			respondStatus(w, http.StatusBadRequest, err)
+		case errors.Is(err, reconcile.ErrDetectOnly):
+			respondStatus(w, http.StatusConflict, err)
+		default:
+			respondErr(w, err)
+		}
+		return
+	}
+	respondStatus(w, http.StatusOK, nil)
+}
+
+func (s *Server) handleResumeRepo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.reconciler.ResumeRepo(r.Context(), id); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondStatus(w, http.StatusOK, nil)
+}
+
+func (s *Server) handlePlanRepo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	plan, err := s.reconciler.PlanRepo(r.Context(), id)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondJSON(w, newRepoPlanResponse(plan))
+}
+
+func (s *Server) handleAcknowledgeRepo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.reconciler.AcknowledgeRepo(r.Context(), id); err != nil {
+		respondErr(w, err)
+		return
+	}
+	respondStatus(w, http.StatusAccepted, nil)
+}
+
+func (s *Server) handleJobConflicts(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	conflicts, err := s.reconciler.JobConflicts(r.Context(), id)
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	resp := make([]jobConflictResponse, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		resp = append(resp, newJobConflictResponse(conflict))
+	}
+	respondJSON(w, resp)
+}
+
+func (s *Server) handleTakeoverJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	var req takeoverJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.reconciler.TakeoverJob(r.Context(), id, strings.TrimSpace(req.Path)); err != nil {
+		if errors.Is(err, reconcile.ErrConflictNotFound) {
+			respondStatus(w, http.StatusNotFound, err)
+			return
+		}
 		respondErr(w, err)
 		return
 	}
@@ -242,11 +515,35 @@ func (s *Server) handleDeleteCredential(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
-	err := s.nomad.Ping(r.Context())
-	resp := statusResponse{NomadConnected: err == nil}
+	ctx := r.Context()
+	err := s.nomad.Ping(ctx)
+	resp := statusResponse{NomadConnected: err == nil, Role: roleLeader}
 	if err != nil {
 		resp.NomadMessage = err.Error()
 	}
+	if s.election != nil {
+		resp.Instance = s.election.ID()
+		resp.Leader = s.election.Leader()
+		if !s.election.IsLeader() {
+			resp.Role = roleFollower
+		}
+	}
+	if s.clusters != nil {
+		clusters, err := s.clusters.List(ctx)
+		if err != nil {
+			respondErr(w, err)
+			return
+		}
+		for _, cluster := range clusters {
+			status := clusterStatusResponse{ID: cluster.ID, Name: cluster.Name}
+			err := s.clusterTarget(ctx, cluster.ID).Client.Ping(ctx)
+			status.Connected = err == nil
+			if err != nil {
+				status.Message = err.Error()
+			}
+			resp.Clusters = append(resp.Clusters, status)
+		}
+	}
 	respondJSON(w, resp)
 }
 
@@ -263,11 +560,55 @@ func jobURL(base string, namespace string, jobID string) string {
 }
 
 type createRepoRequest struct {
-	Name         string `json:"name"`
-	RepoURL      string `json:"repo_url"`
-	Branch       string `json:"branch"`
-	JobPath      string `json:"job_path"`
-	CredentialID int64  `json:"credential_id"`
+	Name         string            `json:"name"`
+	RepoURL      string            `json:"repo_url"`
+	Branch       string            `json:"branch"`
+	JobPath      string            `json:"job_path"`
+	CredentialID int64             `json:"credential_id"`
+	Variables    map[string]string `json:"variables"`
+	SyncPolicy   string            `json:"sync_policy"`
+	RefType      string            `json:"ref_type"`
+	Ref          string            `json:"ref"`
+	PollInterval int64             `json:"poll_interval_seconds"`
+	AutoRevert   bool              `json:"auto_revert"`
+	Namespaces   []string          `json:"namespaces"`
+	ClusterID    int64             `json:"cluster_id"`
+	JobPolicy    jobpolicy.Rules   `json:"job_policy"`
+	OverlayPath  string            `json:"overlay_path"`
+	// StatusProvider enables commit status reporting: github, gitlab or gitea.
+	StatusProvider string `json:"status_provider"`
+	StatusAPIURL   string `json:"status_api_url"`
+	// WebhookSecret verifies push webhooks sent for the repository.
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+type createClusterRequest struct {
+	Name          string `json:"name"`
+	Address       string `json:"address"`
+	Region        string `json:"region"`
+	Namespace     string `json:"namespace"`
+	Token         string `json:"token"`
+	CACert        string `json:"ca_cert"`
+	ClientCert    string `json:"client_cert"`
+	ClientKey     string `json:"client_key"`
+	TLSServerName string `json:"tls_server_name"`
+	TLSSkipVerify bool   `json:"tls_skip_verify"`
+}
+
+type createNotificationRequest struct {
+	Name   string   `json:"name"`
+	Kind   string   `json:"kind"`
+	RepoID int64    `json:"repo_id"`
+	Events []string `json:"events"`
+	// URL is the target of webhook and Slack channels.
+	URL string `json:"url"`
+	// SMTP settings for email channels.
+	SMTPHost string   `json:"smtp_host"`
+	SMTPPort int      `json:"smtp_port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
 }
 
 type createCredentialRequest struct {
@@ -279,6 +620,14 @@ type createCredentialRequest struct {
 	Passphrase string `json:"passphrase"`
 }
 
+type takeoverJobRequest struct {
+	Path string `json:"path"`
+}
+
+type rollbackRepoRequest struct {
+	Commit string `json:"commit"`
+}
+
 type deleteRepoRequest struct {
 	Unschedule bool `json:"unschedule"`
 }
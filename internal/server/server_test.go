@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"io"
 	"log/slog"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/hashicorp/nomad/api"
 
+	"github.com/brianmichel/nomad-compass/internal/auth"
 	"github.com/brianmichel/nomad-compass/internal/nomadclient"
 	"github.com/brianmichel/nomad-compass/internal/storage"
 )
@@ -24,7 +26,7 @@ func (f *fakeNomadClient) RegisterJob(ctx context.Context, job *api.Job, submiss
 	return nil
 }
 
-func (f *fakeNomadClient) DeregisterJob(ctx context.Context, jobID string, purge bool) error {
+func (f *fakeNomadClient) DeregisterJob(ctx context.Context, namespace, jobID string, purge bool) error {
 	return nil
 }
 
@@ -32,7 +34,7 @@ func (f *fakeNomadClient) Ping(ctx context.Context) error {
 	return nil
 }
 
-func (f *fakeNomadClient) JobStatus(ctx context.Context, jobID string) (*nomadclient.JobStatus, error) {
+func (f *fakeNomadClient) JobStatus(ctx context.Context, namespace, jobID string) (*nomadclient.JobStatus, error) {
 	f.calls = append(f.calls, jobID)
 	if f.errByID != nil {
 		if err, ok := f.errByID[jobID]; ok {
@@ -51,6 +53,22 @@ func (f *fakeNomadClient) PlanJob(ctx context.Context, job *api.Job) (*api.JobPl
 	return &api.JobPlanResponse{}, nil
 }
 
+func (f *fakeNomadClient) ListJobs(ctx context.Context) ([]nomadclient.JobStub, error) {
+	return nil, nil
+}
+
+func (f *fakeNomadClient) JobVersion(ctx context.Context, namespace, jobID string) (uint64, error) {
+	return 0, nil
+}
+
+func (f *fakeNomadClient) LatestDeployment(ctx context.Context, namespace, jobID string) (*nomadclient.Deployment, error) {
+	return nil, nil
+}
+
+func (f *fakeNomadClient) RevertToStable(ctx context.Context, namespace, jobID string, failedVersion uint64) (uint64, bool, error) {
+	return 0, false, nil
+}
+
 func setupServer(t *testing.T) (*Server, context.Context, *storage.RepoStore, *storage.RepoFileStore, *fakeNomadClient) {
 	t.Helper()
 
@@ -65,7 +83,11 @@ func setupServer(t *testing.T) (*Server, context.Context, *storage.RepoStore, *s
 		t.Fatalf("migrate db: %v", err)
 	}
 
-	repoStore := storage.NewRepoStore(db)
+	enc, err := auth.NewEncryptor([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+	repoStore := storage.NewRepoStore(db, enc)
 	fileStore := storage.NewRepoFileStore(db)
 	nomad := &fakeNomadClient{}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
@@ -92,7 +114,7 @@ func TestListRepositoryResponsesWithoutJobStatus(t *testing.T) {
 		t.Fatalf("create repo: %v", err)
 	}
 
-	if err := fileStore.Upsert(ctx, repo.ID, "jobs/api.nomad", "abcd1234", ""); err != nil {
+	if err := fileStore.Upsert(ctx, repo.ID, "jobs/api.nomad", "abcd1234", "", ""); err != nil {
 		t.Fatalf("upsert file: %v", err)
 	}
 
@@ -119,6 +141,36 @@ func TestListRepositoryResponsesWithoutJobStatus(t *testing.T) {
 	}
 }
 
+func TestListRepositoryResponsesIncludesFileErrors(t *testing.T) {
+	srv, ctx, repoStore, fileStore, _ := setupServer(t)
+
+	repo, err := repoStore.Create(ctx, storage.RepositoryInput{
+		Name:    "demo",
+		RepoURL: "https://example.com/demo.git",
+		Branch:  "main",
+	})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+	if err := fileStore.ReplaceErrors(ctx, repo.ID, map[string]storage.FileError{
+		"jobs/api.nomad": {Phase: storage.JobPhaseParse, Message: "unexpected end of file"},
+	}); err != nil {
+		t.Fatalf("replace errors: %v", err)
+	}
+
+	responses, err := srv.listRepositoryResponses(ctx)
+	if err != nil {
+		t.Fatalf("list responses: %v", err)
+	}
+	if len(responses) != 1 || len(responses[0].Jobs) != 1 {
+		t.Fatalf("expected 1 job response, got %+v", responses)
+	}
+	job := responses[0].Jobs[0]
+	if job.LastError == nil || *job.LastError != "unexpected end of file" || job.LastErrorPhase == nil || *job.LastErrorPhase != storage.JobPhaseParse || job.LastErrorAt == nil {
+		t.Fatalf("expected file error in response, got %+v", job)
+	}
+}
+
 func TestListRepositoryResponsesWithJobStatus(t *testing.T) {
 	srv, ctx, repoStore, fileStore, nomad := setupServer(t)
 
@@ -131,7 +183,7 @@ func TestListRepositoryResponsesWithJobStatus(t *testing.T) {
 		t.Fatalf("create repo: %v", err)
 	}
 
-	if err := fileStore.Upsert(ctx, repo.ID, "jobs/api.nomad", "abcd1234", "job-123"); err != nil {
+	if err := fileStore.Upsert(ctx, repo.ID, "jobs/api.nomad", "abcd1234", "job-123", ""); err != nil {
 		t.Fatalf("upsert file: %v", err)
 	}
 
@@ -190,6 +242,43 @@ func TestListRepositoryResponsesWithJobStatus(t *testing.T) {
 	}
 }
 
+func TestListRepositoryResponsesUsesRepositoryCluster(t *testing.T) {
+	srv, ctx, repoStore, fileStore, nomad := setupServer(t)
+
+	west := &fakeNomadClient{statusByID: map[string]*nomadclient.JobStatus{
+		"job-123": {ID: "job-123", Namespace: "apps", DerivedStatus: "healthy", Exists: true},
+	}}
+	srv.targets = nomadclient.NewPool(nomadclient.Target{Client: nomad, Address: srv.nomadAddr}, func(ctx context.Context, id int64) (nomadclient.Target, error) {
+		return nomadclient.Target{Client: west, Address: "https://west.example"}, nil
+	})
+
+	repo, err := repoStore.Create(ctx, storage.RepositoryInput{
+		Name:      "demo",
+		RepoURL:   "https://example.com/demo.git",
+		ClusterID: sql.NullInt64{Int64: 3, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+	if err := fileStore.Upsert(ctx, repo.ID, "jobs/api.nomad", "abcd1234", "job-123", "apps"); err != nil {
+		t.Fatalf("upsert file: %v", err)
+	}
+
+	responses, err := srv.listRepositoryResponses(ctx)
+	if err != nil {
+		t.Fatalf("list responses: %v", err)
+	}
+	if len(nomad.calls) != 0 || len(west.calls) != 1 {
+		t.Fatalf("expected status read from the repository's cluster, got default=%v west=%v", nomad.calls, west.calls)
+	}
+	if responses[0].ClusterID == nil || *responses[0].ClusterID != 3 {
+		t.Fatalf("expected cluster id in response, got %v", responses[0].ClusterID)
+	}
+	if url := responses[0].Jobs[0].JobURL; url != "https://west.example/ui/jobs/job-123@apps" {
+		t.Fatalf("expected job url on the cluster, got %s", url)
+	}
+}
+
 func TestListRepositoryResponsesMissingJob(t *testing.T) {
 	srv, ctx, repoStore, fileStore, nomad := setupServer(t)
 
@@ -202,7 +291,7 @@ func TestListRepositoryResponsesMissingJob(t *testing.T) {
 		t.Fatalf("create repo: %v", err)
 	}
 
-	if err := fileStore.Upsert(ctx, repo.ID, "jobs/api.nomad", "abcd1234", "job-123"); err != nil {
+	if err := fileStore.Upsert(ctx, repo.ID, "jobs/api.nomad", "abcd1234", "job-123", ""); err != nil {
 		t.Fatalf("upsert file: %v", err)
 	}
 
@@ -271,10 +360,23 @@ func (s *staticRepoStore) List(ctx context.Context) ([]storage.Repository, error
 	return s.repos, s.err
 }
 
+func (s *staticRepoStore) Get(ctx context.Context, id int64) (*storage.Repository, error) {
+	for i := range s.repos {
+		if s.repos[i].ID == id {
+			return &s.repos[i], s.err
+		}
+	}
+	return nil, s.err
+}
+
 func (s *staticRepoStore) Create(ctx context.Context, input storage.RepositoryInput) (*storage.Repository, error) {
 	return nil, errors.New("not implemented")
 }
 
+func (s *staticRepoStore) DecryptWebhookSecret(r *storage.Repository) (string, error) {
+	return "", errors.New("not implemented")
+}
+
 type failingRepoFileStore struct {
 	err error
 }
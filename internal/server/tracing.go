@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/brianmichel/nomad-compass/internal/server")
+
+// traceRequests starts a server span for each request, continuing any trace
+// the caller propagated. Spans are named after the matched route so that IDs
+// in the path do not explode span cardinality.
+func traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		attrs := []attribute.KeyValue{
+			attribute.String("http.request.method", r.Method),
+			attribute.Int("http.response.status_code", status),
+		}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := strings.TrimSuffix(rctx.RoutePattern(), "/*"); pattern != "" {
+				span.SetName(r.Method + " " + pattern)
+				attrs = append(attrs, attribute.String("http.route", pattern))
+			}
+		}
+		span.SetAttributes(attrs...)
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
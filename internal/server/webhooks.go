@@ -0,0 +1,90 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+	"github.com/brianmichel/nomad-compass/internal/webhook"
+)
+
+// maxWebhookBody bounds push payloads; large pushes stay well below it.
+const maxWebhookBody = 5 << 20
+
+type webhookResponse struct {
+	Queued []int64 `json:"queued"`
+}
+
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	if !webhook.ValidProvider(provider) {
+		respondStatus(w, http.StatusNotFound, webhook.ErrUnknownProvider)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// The body is only decoded once a repository's secret has signed it, so
+	// unauthenticated requests learn nothing about how it is parsed.
+	repos, err := s.repos.List(r.Context())
+	if err != nil {
+		respondErr(w, err)
+		return
+	}
+	var signed []storage.Repository
+	for _, repo := range repos {
+		secret, err := s.repos.DecryptWebhookSecret(&repo)
+		if err != nil {
+			s.logger.Warn("webhook secret unavailable", "repo", repo.Name, "error", err)
+			continue
+		}
+		if webhook.Verify(provider, r.Header, body, secret) {
+			signed = append(signed, repo)
+		}
+	}
+	if len(signed) == 0 {
+		respondStatus(w, http.StatusUnauthorized, errors.New("webhook signature does not match any repository"))
+		return
+	}
+
+	push, err := webhook.Parse(provider, r.Header, body)
+	if err != nil {
+		respondStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	resp := webhookResponse{Queued: []int64{}}
+	if push == nil {
+		respondJSON(w, resp)
+		return
+	}
+	for _, repo := range signed {
+		if !push.FromRepository(repo.RepoURL) || !tracksPush(repo, push) {
+			continue
+		}
+		if err := s.reconciler.TriggerRepo(r.Context(), repo.ID); err != nil {
+			respondErr(w, err)
+			return
+		}
+		resp.Queued = append(resp.Queued, repo.ID)
+	}
+	respondJSON(w, resp)
+}
+
+// tracksPush reports whether the push moved the ref the repository follows.
+// Repositories pinned to a commit never do.
+func tracksPush(repo storage.Repository, push *webhook.Push) bool {
+	switch repo.RefType {
+	case "", storage.RefTypeBranch:
+		return push.Updates("refs/heads/" + repo.Branch)
+	case storage.RefTypeTag:
+		return push.UpdatesTag(repo.Ref)
+	default:
+		return false
+	}
+}
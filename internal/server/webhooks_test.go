@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brianmichel/nomad-compass/internal/storage"
+)
+
+type fakeReconciler struct {
+	reconcileManager
+	triggered []int64
+}
+
+func (f *fakeReconciler) TriggerRepo(ctx context.Context, repoID int64) error {
+	f.triggered = append(f.triggered, repoID)
+	return nil
+}
+
+func TestWebhookQueuesMatchingRepositories(t *testing.T) {
+	srv, ctx, repoStore, _, _ := setupServer(t)
+	reconciler := &fakeReconciler{}
+	srv.reconciler = reconciler
+
+	inputs := []storage.RepositoryInput{
+		{Name: "main", RepoURL: "git@github.com:acme/api.git", Branch: "main", WebhookSecret: "s3cret"},
+		{Name: "dev", RepoURL: "https://github.com/acme/api.git", Branch: "dev", WebhookSecret: "s3cret"},
+		{Name: "other-secret", RepoURL: "https://github.com/acme/api.git", Branch: "main", WebhookSecret: "different"},
+		{Name: "no-secret", RepoURL: "https://github.com/acme/api.git", Branch: "main"},
+	}
+	var ids []int64
+	for _, input := range inputs {
+		repo, err := repoStore.Create(ctx, input)
+		if err != nil {
+			t.Fatalf("create repo: %v", err)
+		}
+		ids = append(ids, repo.ID)
+	}
+
+	body := []byte(`{"ref":"refs/heads/main","repository":{"clone_url":"https://github.com/acme/api.git","ssh_url":"git@github.com:acme/api.git"}}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	send := func(signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/webhooks/github", bytes.NewReader(body))
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Set("X-Hub-Signature-256", signature)
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("sha256=" + hex.EncodeToString(mac.Sum(nil)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp webhookResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Queued) != 1 || resp.Queued[0] != ids[0] {
+		t.Fatalf("expected only repo %d queued, got %v", ids[0], resp.Queued)
+	}
+	if len(reconciler.triggered) != 1 || reconciler.triggered[0] != ids[0] {
+		t.Fatalf("expected reconcile triggered for repo %d, got %v", ids[0], reconciler.triggered)
+	}
+
+	if rec := send("sha256=00"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for bad signature, got %d", rec.Code)
+	}
+	if len(reconciler.triggered) != 1 {
+		t.Fatalf("expected no reconcile for bad signature, got %v", reconciler.triggered)
+	}
+
+	// An unsigned body is rejected before it is decoded.
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/github", bytes.NewReader([]byte("{not json")))
+	req.Header.Set("X-GitHub-Event", "push")
+	rec = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an unsigned malformed body, got %d", rec.Code)
+	}
+}
+
+func TestWebhookMatchesTagConstraint(t *testing.T) {
+	srv, ctx, repoStore, _, _ := setupServer(t)
+	reconciler := &fakeReconciler{}
+	srv.reconciler = reconciler
+
+	v1, err := repoStore.Create(ctx, storage.RepositoryInput{Name: "v1", RepoURL: "https://github.com/acme/api.git", RefType: storage.RefTypeTag, Ref: "^1.0", WebhookSecret: "s3cret"})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+	if _, err := repoStore.Create(ctx, storage.RepositoryInput{Name: "v2", RepoURL: "https://github.com/acme/api.git", RefType: storage.RefTypeTag, Ref: "^2.0", WebhookSecret: "s3cret"}); err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+
+	body := []byte(`{"ref":"refs/tags/v1.4.0","repository":{"clone_url":"https://github.com/acme/api.git"}}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/github", bytes.NewReader(body))
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(reconciler.triggered) != 1 || reconciler.triggered[0] != v1.ID {
+		t.Fatalf("expected only repo %d triggered, got %v", v1.ID, reconciler.triggered)
+	}
+}
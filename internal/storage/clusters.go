@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/brianmichel/nomad-compass/internal/auth"
+)
+
+// ClusterSecrets holds the clear-text secrets of a cluster before encryption.
+type ClusterSecrets struct {
+	Token     string `json:"token,omitempty"`
+	ClientKey string `json:"client_key,omitempty"`
+}
+
+// ClusterInput describes a cluster to create.
+type ClusterInput struct {
+	Name          string
+	Address       string
+	Region        string
+	Namespace     string
+	Secrets       ClusterSecrets
+	CACert        string
+	ClientCert    string
+	TLSServerName string
+	TLSSkipVerify bool
+}
+
+const clusterColumns = `id, name, address, region, namespace, secrets, ca_cert, client_cert, tls_server_name, tls_skip_verify, created_at, updated_at`
+
+// ClusterStore manages Nomad cluster persistence.
+type ClusterStore struct {
+	db        *sql.DB
+	encryptor *auth.Encryptor
+}
+
+// NewClusterStore constructs a cluster store.
+func NewClusterStore(db *sql.DB, encryptor *auth.Encryptor) *ClusterStore {
+	return &ClusterStore{db: db, encryptor: encryptor}
+}
+
+// Create stores a new cluster, encrypting its secrets.
+func (s *ClusterStore) Create(ctx context.Context, input ClusterInput) (*Cluster, error) {
+	name := strings.TrimSpace(input.Name)
+	address := strings.TrimSpace(input.Address)
+	if name == "" || address == "" {
+		return nil, errors.New("cluster name and address are required")
+	}
+	raw, err := json.Marshal(input.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("marshal secrets: %w", err)
+	}
+	cipher, err := s.encryptor.Encrypt(raw)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt secrets: %w", err)
+	}
+
+	now := Now()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO clusters (name, address, region, namespace, secrets, ca_cert, client_cert, tls_server_name, tls_skip_verify, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		name, address, input.Region, input.Namespace, cipher, input.CACert, input.ClientCert, input.TLSServerName, input.TLSSkipVerify, now, now)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &Cluster{
+		ID:            id,
+		Name:          name,
+		Address:       address,
+		Region:        input.Region,
+		Namespace:     input.Namespace,
+		Secrets:       cipher,
+		CACert:        input.CACert,
+		ClientCert:    input.ClientCert,
+		TLSServerName: input.TLSServerName,
+		TLSSkipVerify: input.TLSSkipVerify,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+// List returns all clusters without decrypting their secrets.
+func (s *ClusterStore) List(ctx context.Context) ([]Cluster, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+clusterColumns+` FROM clusters ORDER BY name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clusters []Cluster
+	for rows.Next() {
+		cluster, err := scanCluster(rows)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, *cluster)
+	}
+	return clusters, rows.Err()
+}
+
+// Get fetches a cluster by ID without decrypting its secrets.
+func (s *ClusterStore) Get(ctx context.Context, id int64) (*Cluster, error) {
+	cluster, err := scanCluster(s.db.QueryRowContext(ctx, `SELECT `+clusterColumns+` FROM clusters WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// DecryptSecrets returns the decrypted secrets for a cluster.
+func (s *ClusterStore) DecryptSecrets(c *Cluster) (*ClusterSecrets, error) {
+	raw, err := s.encryptor.Decrypt(c.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	var secrets ClusterSecrets
+	if err := json.Unmarshal(raw, &secrets); err != nil {
+		return nil, err
+	}
+	return &secrets, nil
+}
+
+// Delete removes a cluster by ID.
+func (s *ClusterStore) Delete(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM clusters WHERE id = ?`, id)
+	return err
+}
+
+func scanCluster(row rowScanner) (*Cluster, error) {
+	var c Cluster
+	if err := row.Scan(&c.ID, &c.Name, &c.Address, &c.Region, &c.Namespace, &c.Secrets, &c.CACert, &c.ClientCert, &c.TLSServerName, &c.TLSSkipVerify, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/brianmichel/nomad-compass/internal/auth"
+)
+
+func TestClusterStoreCreateAndDecrypt(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	key := make([]byte, 32)
+	copy(key, []byte("0123456789abcdef0123456789abcdef"))
+	enc, err := auth.NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+	store := NewClusterStore(db, enc)
+
+	if _, err := store.Create(ctx, ClusterInput{Name: "west"}); err == nil {
+		t.Fatal("expected an address to be required")
+	}
+
+	cluster, err := store.Create(ctx, ClusterInput{
+		Name:      "west",
+		Address:   "https://nomad-west:4646",
+		Namespace: "apps",
+		Secrets:   ClusterSecrets{Token: "secret-token", ClientKey: "key-pem"},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if string(cluster.Secrets) == "secret-token" {
+		t.Fatal("secrets stored in plaintext")
+	}
+
+	fetched, err := store.Get(ctx, cluster.ID)
+	if err != nil || fetched == nil {
+		t.Fatalf("get: %v %v", fetched, err)
+	}
+	if fetched.Namespace != "apps" || fetched.Address != "https://nomad-west:4646" {
+		t.Fatalf("unexpected cluster %+v", fetched)
+	}
+	secrets, err := store.DecryptSecrets(fetched)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if secrets.Token != "secret-token" || secrets.ClientKey != "key-pem" {
+		t.Fatalf("unexpected secrets %+v", secrets)
+	}
+
+	repos := NewRepoStore(db, nil)
+	repo, err := repos.Create(ctx, RepositoryInput{
+		Name:      "demo",
+		RepoURL:   "https://example.com/demo.git",
+		ClusterID: sql.NullInt64{Int64: cluster.ID, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+	using, err := repos.ListByCluster(ctx, cluster.ID)
+	if err != nil {
+		t.Fatalf("list by cluster: %v", err)
+	}
+	if len(using) != 1 || using[0].ID != repo.ID || using[0].ClusterID.Int64 != cluster.ID {
+		t.Fatalf("expected repo on cluster, got %+v", using)
+	}
+
+	if err := repos.Delete(ctx, repo.ID); err != nil {
+		t.Fatalf("delete repo: %v", err)
+	}
+	if err := store.Delete(ctx, cluster.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	clusters, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(clusters) != 0 {
+		t.Fatalf("expected cluster deleted, got %+v", clusters)
+	}
+}
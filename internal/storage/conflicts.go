@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// JobConflict records a job file whose job ID is already registered in Nomad
+// by a different repository or file.
+type JobConflict struct {
+	ID           int64
+	RepoID       int64
+	Path         string
+	JobID        string
+	OwnerRepoURL string
+	OwnerJobFile string
+	// Takeover allows the next reconcile to register the job over its
+	// current owner.
+	Takeover   bool
+	DetectedAt time.Time
+}
+
+// JobConflictStore persists ownership conflicts detected during reconciliation.
+type JobConflictStore struct {
+	db *sql.DB
+}
+
+// NewJobConflictStore constructs a job conflict store.
+func NewJobConflictStore(db *sql.DB) *JobConflictStore {
+	return &JobConflictStore{db: db}
+}
+
+// Replace swaps the conflicts for a repository with conflicts. A takeover
+// granted for a conflict is kept while the same job and owner still conflict.
+func (s *JobConflictStore) Replace(ctx context.Context, repoID int64, conflicts []JobConflict) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT path, job_id, owner_repo_url, owner_job_file, detected_at FROM job_conflicts WHERE repo_id = ? AND takeover = 1`, repoID)
+	if err != nil {
+		return err
+	}
+	granted := make(map[JobConflict]time.Time)
+	for rows.Next() {
+		var key JobConflict
+		var detectedAt time.Time
+		if err := rows.Scan(&key.Path, &key.JobID, &key.OwnerRepoURL, &key.OwnerJobFile, &detectedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		granted[key] = detectedAt
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM job_conflicts WHERE repo_id = ?`, repoID); err != nil {
+		return err
+	}
+	now := Now()
+	for _, conflict := range conflicts {
+		detectedAt, takeover := granted[JobConflict{Path: conflict.Path, JobID: conflict.JobID, OwnerRepoURL: conflict.OwnerRepoURL, OwnerJobFile: conflict.OwnerJobFile}]
+		if !takeover {
+			detectedAt = now
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO job_conflicts (repo_id, path, job_id, owner_repo_url, owner_job_file, takeover, detected_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			repoID, conflict.Path, conflict.JobID, conflict.OwnerRepoURL, conflict.OwnerJobFile, takeover, detectedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListByRepo returns conflicts for a repository ordered by path.
+func (s *JobConflictStore) ListByRepo(ctx context.Context, repoID int64) ([]JobConflict, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, repo_id, path, job_id, owner_repo_url, owner_job_file, takeover, detected_at FROM job_conflicts WHERE repo_id = ? ORDER BY path`, repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conflicts []JobConflict
+	for rows.Next() {
+		var conflict JobConflict
+		if err := rows.Scan(&conflict.ID, &conflict.RepoID, &conflict.Path, &conflict.JobID, &conflict.OwnerRepoURL, &conflict.OwnerJobFile, &conflict.Takeover, &conflict.DetectedAt); err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts, rows.Err()
+}
+
+// AllowTakeover grants a takeover for the conflict on path. It reports false
+// when the file has no recorded conflict.
+func (s *JobConflictStore) AllowTakeover(ctx context.Context, repoID int64, path string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE job_conflicts SET takeover = 1 WHERE repo_id = ? AND path = ?`, repoID, path)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeleteByRepo removes conflicts for a repository.
+func (s *JobConflictStore) DeleteByRepo(ctx context.Context, repoID int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM job_conflicts WHERE repo_id = ?`, repoID)
+	return err
+}
@@ -86,7 +86,7 @@ func TestRepoStoreCreate(t *testing.T) {
 		t.Fatalf("migrate: %v", err)
 	}
 
-	store := NewRepoStore(db)
+	store := NewRepoStore(db, nil)
 	repo, err := store.Create(context.Background(), RepositoryInput{
 		Name:         "repo",
 		RepoURL:      "https://example.com/repo.git",
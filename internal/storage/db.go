@@ -40,6 +40,20 @@ func Migrate(ctx context.Context, db *sql.DB) error {
             data BLOB NOT NULL,
             created_at TIMESTAMP NOT NULL,
             updated_at TIMESTAMP NOT NULL
+        )`,
+		`CREATE TABLE IF NOT EXISTS clusters (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL UNIQUE,
+            address TEXT NOT NULL,
+            region TEXT NOT NULL DEFAULT '',
+            namespace TEXT NOT NULL DEFAULT '',
+            secrets BLOB NOT NULL,
+            ca_cert TEXT NOT NULL DEFAULT '',
+            client_cert TEXT NOT NULL DEFAULT '',
+            tls_server_name TEXT NOT NULL DEFAULT '',
+            tls_skip_verify INTEGER NOT NULL DEFAULT 0,
+            created_at TIMESTAMP NOT NULL,
+            updated_at TIMESTAMP NOT NULL
         )`,
 		`CREATE TABLE IF NOT EXISTS repos (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -54,7 +68,28 @@ func Migrate(ctx context.Context, db *sql.DB) error {
             last_commit_author TEXT,
             last_commit_title TEXT,
             last_polled_at TIMESTAMP,
-            FOREIGN KEY (credential_id) REFERENCES credentials(id)
+            variables TEXT,
+            sync_policy TEXT NOT NULL DEFAULT 'auto',
+            rollback_commit TEXT,
+            ref_type TEXT NOT NULL DEFAULT 'branch',
+            ref TEXT NOT NULL DEFAULT '',
+            resolved_ref TEXT,
+            poll_interval_seconds INTEGER,
+            failure_count INTEGER NOT NULL DEFAULT 0,
+            next_poll_at TIMESTAMP,
+            auto_revert INTEGER NOT NULL DEFAULT 0,
+            unhealthy_commit TEXT,
+            unhealthy_reason TEXT,
+            unhealthy_at TIMESTAMP,
+            namespaces TEXT,
+            cluster_id INTEGER,
+            job_policy TEXT,
+            overlay_path TEXT NOT NULL DEFAULT '',
+            status_provider TEXT NOT NULL DEFAULT '',
+            status_api_url TEXT NOT NULL DEFAULT '',
+            webhook_secret BLOB NOT NULL DEFAULT '',
+            FOREIGN KEY (credential_id) REFERENCES credentials(id),
+            FOREIGN KEY (cluster_id) REFERENCES clusters(id)
         )`,
 		`CREATE TABLE IF NOT EXISTS repo_files (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -63,11 +98,114 @@ func Migrate(ctx context.Context, db *sql.DB) error {
             last_commit TEXT,
             updated_at TIMESTAMP NOT NULL,
             job_id TEXT,
+            namespace TEXT,
+            last_error TEXT,
+            last_error_phase TEXT,
+            last_error_at TIMESTAMP,
+            deploy_version INTEGER,
+            deploy_commit TEXT,
+            deploy_started_at TIMESTAMP,
+            UNIQUE(repo_id, path),
+            FOREIGN KEY(repo_id) REFERENCES repos(id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS reconcile_runs (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            repo_id INTEGER NOT NULL,
+            started_at TIMESTAMP NOT NULL,
+            finished_at TIMESTAMP,
+            commit_sha TEXT,
+            ref TEXT,
+            outcome TEXT NOT NULL,
+            summary TEXT NOT NULL DEFAULT '',
+            error TEXT
+        )`,
+		`CREATE INDEX IF NOT EXISTS reconcile_runs_repo_idx ON reconcile_runs(repo_id, id)`,
+		`CREATE TABLE IF NOT EXISTS job_events (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            run_id INTEGER NOT NULL,
+            repo_id INTEGER NOT NULL,
+            path TEXT NOT NULL,
+            job_id TEXT,
+            commit_sha TEXT,
+            action TEXT NOT NULL,
+            phase TEXT,
+            summary TEXT NOT NULL DEFAULT '',
+            error TEXT,
+            created_at TIMESTAMP NOT NULL
+        )`,
+		`CREATE INDEX IF NOT EXISTS job_events_repo_idx ON job_events(repo_id, id)`,
+		`CREATE INDEX IF NOT EXISTS job_events_run_idx ON job_events(run_id)`,
+		`CREATE TABLE IF NOT EXISTS pending_changes (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            repo_id INTEGER NOT NULL,
+            path TEXT NOT NULL,
+            job_id TEXT,
+            commit_sha TEXT,
+            action TEXT NOT NULL,
+            summary TEXT NOT NULL DEFAULT '',
+            diff TEXT,
+            created_at TIMESTAMP NOT NULL,
             UNIQUE(repo_id, path),
             FOREIGN KEY(repo_id) REFERENCES repos(id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS job_conflicts (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            repo_id INTEGER NOT NULL,
+            path TEXT NOT NULL,
+            job_id TEXT NOT NULL,
+            owner_repo_url TEXT NOT NULL,
+            owner_job_file TEXT NOT NULL DEFAULT '',
+            takeover INTEGER NOT NULL DEFAULT 0,
+            detected_at TIMESTAMP NOT NULL,
+            UNIQUE(repo_id, path),
+            FOREIGN KEY(repo_id) REFERENCES repos(id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS notification_channels (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL UNIQUE,
+            kind TEXT NOT NULL,
+            repo_id INTEGER,
+            events TEXT,
+            settings BLOB NOT NULL,
+            created_at TIMESTAMP NOT NULL,
+            updated_at TIMESTAMP NOT NULL,
+            FOREIGN KEY(repo_id) REFERENCES repos(id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS leases (
+            name TEXT PRIMARY KEY,
+            holder TEXT NOT NULL,
+            expires_at TIMESTAMP NOT NULL
         )`,
 		`ALTER TABLE repos ADD COLUMN job_path TEXT NOT NULL DEFAULT '.nomad'`,
 		`ALTER TABLE repo_files ADD COLUMN job_id TEXT`,
+		`ALTER TABLE repos ADD COLUMN variables TEXT`,
+		`ALTER TABLE repos ADD COLUMN sync_policy TEXT NOT NULL DEFAULT 'auto'`,
+		`ALTER TABLE repos ADD COLUMN rollback_commit TEXT`,
+		`ALTER TABLE repos ADD COLUMN ref_type TEXT NOT NULL DEFAULT 'branch'`,
+		`ALTER TABLE repos ADD COLUMN ref TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE repos ADD COLUMN resolved_ref TEXT`,
+		`ALTER TABLE reconcile_runs ADD COLUMN ref TEXT`,
+		`ALTER TABLE repos ADD COLUMN poll_interval_seconds INTEGER`,
+		`ALTER TABLE repos ADD COLUMN failure_count INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE repos ADD COLUMN next_poll_at TIMESTAMP`,
+		`ALTER TABLE repos ADD COLUMN auto_revert INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE repos ADD COLUMN unhealthy_commit TEXT`,
+		`ALTER TABLE repos ADD COLUMN unhealthy_reason TEXT`,
+		`ALTER TABLE repos ADD COLUMN unhealthy_at TIMESTAMP`,
+		`ALTER TABLE repo_files ADD COLUMN last_error TEXT`,
+		`ALTER TABLE repo_files ADD COLUMN last_error_phase TEXT`,
+		`ALTER TABLE repo_files ADD COLUMN last_error_at TIMESTAMP`,
+		`ALTER TABLE repos ADD COLUMN namespaces TEXT`,
+		`ALTER TABLE repo_files ADD COLUMN namespace TEXT`,
+		`ALTER TABLE repos ADD COLUMN cluster_id INTEGER REFERENCES clusters(id)`,
+		`ALTER TABLE repos ADD COLUMN job_policy TEXT`,
+		`ALTER TABLE repos ADD COLUMN overlay_path TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE repos ADD COLUMN status_provider TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE repos ADD COLUMN status_api_url TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE repos ADD COLUMN webhook_secret BLOB NOT NULL DEFAULT ''`,
+		`ALTER TABLE repo_files ADD COLUMN deploy_version INTEGER`,
+		`ALTER TABLE repo_files ADD COLUMN deploy_commit TEXT`,
+		`ALTER TABLE repo_files ADD COLUMN deploy_started_at TIMESTAMP`,
 	}
 
 	for _, stmt := range stmts {
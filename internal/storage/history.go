@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Reconcile run outcomes.
+const (
+	RunOutcomeRunning   = "running"
+	RunOutcomeSucceeded = "succeeded"
+	RunOutcomePartial   = "partial"
+	RunOutcomeFailed    = "failed"
+)
+
+// Job event actions.
+const (
+	JobActionApplied   = "applied"
+	JobActionUnchanged = "unchanged"
+	JobActionRemoved   = "removed"
+	JobActionFailed    = "failed"
+	JobActionPending   = "pending"
+	JobActionDrifted   = "drifted"
+	JobActionHealthy   = "healthy"
+	JobActionUnhealthy = "unhealthy"
+	JobActionReverted  = "reverted"
+	JobActionSkipped   = "skipped"
+)
+
+// Job event phases describe which step of reconciliation produced an event.
+const (
+	JobPhaseParse      = "parse"
+	JobPhaseStatus     = "status"
+	JobPhasePlan       = "plan"
+	JobPhaseApply      = "apply"
+	JobPhaseDeregister = "deregister"
+	JobPhaseOwnership  = "ownership"
+	JobPhaseDeploy     = "deploy"
+	JobPhaseWave       = "wave"
+	JobPhaseNamespace  = "namespace"
+	JobPhasePolicy     = "policy"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// ReconcileRun records a single reconciliation attempt for a repository.
+type ReconcileRun struct {
+	ID         int64
+	RepoID     int64
+	StartedAt  time.Time
+	FinishedAt sql.NullTime
+	Commit     sql.NullString
+	Ref        sql.NullString
+	Outcome    string
+	Summary    string
+	Error      sql.NullString
+}
+
+// JobEvent records what happened to a single job file during a run.
+type JobEvent struct {
+	ID        int64
+	RunID     int64
+	RepoID    int64
+	Path      string
+	JobID     sql.NullString
+	Commit    sql.NullString
+	Action    string
+	Phase     sql.NullString
+	Summary   string
+	Error     sql.NullString
+	CreatedAt time.Time
+}
+
+// Page bounds list queries.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// Normalize clamps the page to sane bounds.
+func (p Page) Normalize() Page {
+	if p.Limit <= 0 {
+		p.Limit = defaultPageLimit
+	}
+	if p.Limit > maxPageLimit {
+		p.Limit = maxPageLimit
+	}
+	if p.Offset < 0 {
+		p.Offset = 0
+	}
+	return p
+}
+
+// EventFilter narrows job event queries. Zero values match everything.
+type EventFilter struct {
+	RepoID int64
+	RunID  int64
+	Page   Page
+}
+
+// HistoryStore persists reconciliation runs and job events.
+type HistoryStore struct {
+	db *sql.DB
+}
+
+// NewHistoryStore constructs a history store.
+func NewHistoryStore(db *sql.DB) *HistoryStore {
+	return &HistoryStore{db: db}
+}
+
+// StartRun records the beginning of a reconciliation run.
+func (s *HistoryStore) StartRun(ctx context.Context, repoID int64) (*ReconcileRun, error) {
+	now := Now()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO reconcile_runs (repo_id, started_at, outcome, summary) VALUES (?, ?, ?, '')`, repoID, now, RunOutcomeRunning)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &ReconcileRun{ID: id, RepoID: repoID, StartedAt: now, Outcome: RunOutcomeRunning}, nil
+}
+
+// FinishRun stores the result of a reconciliation run and stamps its finish time.
+func (s *HistoryStore) FinishRun(ctx context.Context, run *ReconcileRun) error {
+	run.FinishedAt = sql.NullTime{Time: Now(), Valid: true}
+	_, err := s.db.ExecContext(ctx, `UPDATE reconcile_runs SET finished_at = ?, commit_sha = ?, ref = ?, outcome = ?, summary = ?, error = ? WHERE id = ?`,
+		run.FinishedAt, run.Commit, run.Ref, run.Outcome, run.Summary, run.Error, run.ID)
+	return err
+}
+
+// AbandonRunning marks every run still in progress as failed. Only one
+// instance reconciles at a time, so when it starts any run left running was
+// cut short by a crash or a lost leadership and will never finish.
+func (s *HistoryStore) AbandonRunning(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE reconcile_runs SET finished_at = ?, outcome = ?, error = ? WHERE outcome = ?`,
+		Now(), RunOutcomeFailed, "run did not finish: compass stopped or lost leadership", RunOutcomeRunning)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RecordEvent stores a job event.
+func (s *HistoryStore) RecordEvent(ctx context.Context, event JobEvent) error {
+	createdAt := event.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = Now()
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO job_events (run_id, repo_id, path, job_id, commit_sha, action, phase, summary, error, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.RunID, event.RepoID, event.Path, event.JobID, event.Commit, event.Action, event.Phase, event.Summary, event.Error, createdAt)
+	return err
+}
+
+// ListRuns returns runs for a repository, newest first.
+func (s *HistoryStore) ListRuns(ctx context.Context, repoID int64, page Page) ([]ReconcileRun, error) {
+	page = page.Normalize()
+	rows, err := s.db.QueryContext(ctx, `SELECT id, repo_id, started_at, finished_at, commit_sha, ref, outcome, summary, error FROM reconcile_runs WHERE repo_id = ? ORDER BY id DESC LIMIT ? OFFSET ?`,
+		repoID, page.Limit, page.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []ReconcileRun
+	for rows.Next() {
+		var run ReconcileRun
+		if err := rows.Scan(&run.ID, &run.RepoID, &run.StartedAt, &run.FinishedAt, &run.Commit, &run.Ref, &run.Outcome, &run.Summary, &run.Error); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// ListEvents returns job events matching filter, newest first.
+func (s *HistoryStore) ListEvents(ctx context.Context, filter EventFilter) ([]JobEvent, error) {
+	page := filter.Page.Normalize()
+	query := `SELECT id, run_id, repo_id, path, job_id, commit_sha, action, phase, summary, error, created_at FROM job_events WHERE 1 = 1`
+	var args []interface{}
+	if filter.RepoID > 0 {
+		query += ` AND repo_id = ?`
+		args = append(args, filter.RepoID)
+	}
+	if filter.RunID > 0 {
+		query += ` AND run_id = ?`
+		args = append(args, filter.RunID)
+	}
+	query += ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	args = append(args, page.Limit, page.Offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []JobEvent
+	for rows.Next() {
+		var event JobEvent
+		if err := rows.Scan(&event.ID, &event.RunID, &event.RepoID, &event.Path, &event.JobID, &event.Commit, &event.Action, &event.Phase, &event.Summary, &event.Error, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// Prune deletes runs and events that started before cutoff.
+func (s *HistoryStore) Prune(ctx context.Context, cutoff time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM job_events WHERE created_at < ?`, cutoff); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM reconcile_runs WHERE started_at < ?`, cutoff)
+	return err
+}
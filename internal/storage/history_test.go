@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := Migrate(context.Background(), db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestHistoryStoreRunsAndEvents(t *testing.T) {
+	ctx := context.Background()
+	store := NewHistoryStore(openTestDB(t))
+
+	run, err := store.StartRun(ctx, 7)
+	if err != nil {
+		t.Fatalf("start run: %v", err)
+	}
+	if err := store.RecordEvent(ctx, JobEvent{RunID: run.ID, RepoID: 7, Path: "a.nomad", Action: JobActionApplied}); err != nil {
+		t.Fatalf("record event: %v", err)
+	}
+	if err := store.RecordEvent(ctx, JobEvent{RunID: run.ID, RepoID: 7, Path: "b.nomad", Action: JobActionFailed, Error: sql.NullString{String: "boom", Valid: true}}); err != nil {
+		t.Fatalf("record event: %v", err)
+	}
+	run.Commit = sql.NullString{String: "abc123", Valid: true}
+	run.Ref = sql.NullString{String: "refs/heads/main", Valid: true}
+	run.Outcome = RunOutcomePartial
+	run.Summary = "1 applied, 1 failed"
+	if err := store.FinishRun(ctx, run); err != nil {
+		t.Fatalf("finish run: %v", err)
+	}
+
+	runs, err := store.ListRuns(ctx, 7, Page{})
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(runs))
+	}
+	got := runs[0]
+	if got.Outcome != RunOutcomePartial || got.Commit.String != "abc123" || got.Ref.String != "refs/heads/main" || !got.FinishedAt.Valid || got.Error.Valid {
+		t.Fatalf("unexpected run: %+v", got)
+	}
+
+	events, err := store.ListEvents(ctx, EventFilter{RunID: run.ID})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 2 || events[0].Path != "b.nomad" || events[0].Error.String != "boom" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	paged, err := store.ListEvents(ctx, EventFilter{RepoID: 7, Page: Page{Limit: 1, Offset: 1}})
+	if err != nil {
+		t.Fatalf("list paged events: %v", err)
+	}
+	if len(paged) != 1 || paged[0].Path != "a.nomad" {
+		t.Fatalf("unexpected paged events: %+v", paged)
+	}
+
+	other, err := store.ListEvents(ctx, EventFilter{RepoID: 8})
+	if err != nil {
+		t.Fatalf("list other events: %v", err)
+	}
+	if len(other) != 0 {
+		t.Fatalf("expected no events for other repo, got %d", len(other))
+	}
+}
+
+func TestHistoryStorePrune(t *testing.T) {
+	ctx := context.Background()
+	store := NewHistoryStore(openTestDB(t))
+
+	run, err := store.StartRun(ctx, 1)
+	if err != nil {
+		t.Fatalf("start run: %v", err)
+	}
+	if err := store.RecordEvent(ctx, JobEvent{RunID: run.ID, RepoID: 1, Path: "a.nomad", Action: JobActionApplied}); err != nil {
+		t.Fatalf("record event: %v", err)
+	}
+
+	if err := store.Prune(ctx, Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if runs, _ := store.ListRuns(ctx, 1, Page{}); len(runs) != 1 {
+		t.Fatalf("expected recent run retained, got %d", len(runs))
+	}
+
+	if err := store.Prune(ctx, Now().Add(time.Hour)); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if runs, _ := store.ListRuns(ctx, 1, Page{}); len(runs) != 0 {
+		t.Fatalf("expected runs pruned, got %d", len(runs))
+	}
+	if events, _ := store.ListEvents(ctx, EventFilter{}); len(events) != 0 {
+		t.Fatalf("expected events pruned, got %d", len(events))
+	}
+}
+
+func TestPageNormalize(t *testing.T) {
+	if p := (Page{}).Normalize(); p.Limit != defaultPageLimit || p.Offset != 0 {
+		t.Fatalf("unexpected default page: %+v", p)
+	}
+	if p := (Page{Limit: 10000, Offset: -5}).Normalize(); p.Limit != maxPageLimit || p.Offset != 0 {
+		t.Fatalf("unexpected clamped page: %+v", p)
+	}
+}
+
+func TestHistoryStoreAbandonRunning(t *testing.T) {
+	ctx := context.Background()
+	store := NewHistoryStore(openTestDB(t))
+
+	stale, err := store.StartRun(ctx, 1)
+	if err != nil {
+		t.Fatalf("start run: %v", err)
+	}
+	done, err := store.StartRun(ctx, 1)
+	if err != nil {
+		t.Fatalf("start run: %v", err)
+	}
+	done.Outcome = RunOutcomeSucceeded
+	if err := store.FinishRun(ctx, done); err != nil {
+		t.Fatalf("finish run: %v", err)
+	}
+
+	n, err := store.AbandonRunning(ctx)
+	if err != nil {
+		t.Fatalf("abandon running: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected one run abandoned, got %d", n)
+	}
+	runs, err := store.ListRuns(ctx, 1, Page{})
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	for _, run := range runs {
+		switch run.ID {
+		case stale.ID:
+			if run.Outcome != RunOutcomeFailed || !run.FinishedAt.Valid || !run.Error.Valid {
+				t.Fatalf("expected the stale run closed as failed, got %+v", run)
+			}
+		case done.ID:
+			if run.Outcome != RunOutcomeSucceeded {
+				t.Fatalf("expected the finished run untouched, got %+v", run)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Lease is a named lock held by one instance until it expires.
+type Lease struct {
+	Name      string
+	Holder    string
+	ExpiresAt time.Time
+}
+
+// LeaseStore persists leases shared by every instance using the database.
+type LeaseStore struct {
+	db *sql.DB
+}
+
+// NewLeaseStore constructs a lease store.
+func NewLeaseStore(db *sql.DB) *LeaseStore {
+	return &LeaseStore{db: db}
+}
+
+// Acquire takes or renews the named lease for holder until ttl from now. The
+// lease is only taken over from another holder once it has expired. It
+// returns the lease as it stands afterwards, so the caller holds it when
+// Holder matches.
+func (s *LeaseStore) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (*Lease, error) {
+	now := Now()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+        ON CONFLICT(name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+        WHERE leases.holder = excluded.holder OR leases.expires_at < ?`,
+		name, holder, now.Add(ttl), now)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, name)
+}
+
+// Get returns the named lease, or nil if it has never been taken.
+func (s *LeaseStore) Get(ctx context.Context, name string) (*Lease, error) {
+	lease := &Lease{Name: name}
+	err := s.db.QueryRowContext(ctx, `SELECT holder, expires_at FROM leases WHERE name = ?`, name).Scan(&lease.Holder, &lease.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// Release gives up the named lease if holder still has it, letting another
+// instance take it without waiting for it to expire.
+func (s *LeaseStore) Release(ctx context.Context, name, holder string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM leases WHERE name = ? AND holder = ?`, name, holder)
+	return err
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLeaseStoreAcquire(t *testing.T) {
+	ctx := context.Background()
+	store := NewLeaseStore(openTestDB(t))
+
+	lease, err := store.Acquire(ctx, "leader", "a", time.Minute)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if lease.Holder != "a" {
+		t.Fatalf("expected a to take a free lease, got %q", lease.Holder)
+	}
+
+	lease, err = store.Acquire(ctx, "leader", "b", time.Minute)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if lease.Holder != "a" {
+		t.Fatalf("expected a to keep a live lease, got %q", lease.Holder)
+	}
+
+	first := lease.ExpiresAt
+	lease, err = store.Acquire(ctx, "leader", "a", 2*time.Minute)
+	if err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	if !lease.ExpiresAt.After(first) {
+		t.Fatalf("expected renewal to extend the lease, got %s then %s", first, lease.ExpiresAt)
+	}
+
+	// A negative ttl leaves the lease already expired.
+	if _, err := store.Acquire(ctx, "leader", "a", -time.Second); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	lease, err = store.Acquire(ctx, "leader", "b", time.Minute)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if lease.Holder != "b" {
+		t.Fatalf("expected b to take an expired lease, got %q", lease.Holder)
+	}
+}
+
+func TestLeaseStoreRelease(t *testing.T) {
+	ctx := context.Background()
+	store := NewLeaseStore(openTestDB(t))
+
+	if _, err := store.Acquire(ctx, "leader", "a", time.Minute); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if err := store.Release(ctx, "leader", "b"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if lease, _ := store.Get(ctx, "leader"); lease == nil || lease.Holder != "a" {
+		t.Fatalf("expected another holder's release to be ignored, got %+v", lease)
+	}
+	if err := store.Release(ctx, "leader", "a"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	lease, err := store.Get(ctx, "leader")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if lease != nil {
+		t.Fatalf("expected the lease to be gone, got %+v", lease)
+	}
+}
@@ -3,6 +3,8 @@ package storage
 import (
 	"database/sql"
 	"time"
+
+	"github.com/brianmichel/nomad-compass/internal/jobpolicy"
 )
 
 // CredentialType enumerates supported authentication mechanisms.
@@ -13,6 +15,55 @@ const (
 	CredentialTypeSSHKey    CredentialType = "ssh-key"
 )
 
+// SyncPolicy controls how reconciliation applies changes to Nomad.
+type SyncPolicy string
+
+const (
+	// SyncPolicyAuto registers changes as soon as they are detected.
+	SyncPolicyAuto SyncPolicy = "auto"
+	// SyncPolicyManual holds changes until they are approved.
+	SyncPolicyManual SyncPolicy = "manual"
+	// SyncPolicyDetect reports drift but never writes to Nomad.
+	SyncPolicyDetect SyncPolicy = "detect"
+)
+
+// Valid reports whether p is a known policy.
+func (p SyncPolicy) Valid() bool {
+	switch p {
+	case SyncPolicyAuto, SyncPolicyManual, SyncPolicyDetect:
+		return true
+	default:
+		return false
+	}
+}
+
+// HoldsChanges reports whether the policy prevents automatic registration.
+func (p SyncPolicy) HoldsChanges() bool {
+	return p == SyncPolicyManual || p == SyncPolicyDetect
+}
+
+// RefType controls which Git revision a repository follows.
+type RefType string
+
+const (
+	// RefTypeBranch follows the head of Repository.Branch.
+	RefTypeBranch RefType = "branch"
+	// RefTypeCommit stays on the commit SHA in Repository.Ref.
+	RefTypeCommit RefType = "commit"
+	// RefTypeTag follows the newest tag matching the semver constraint in Repository.Ref.
+	RefTypeTag RefType = "tag"
+)
+
+// Valid reports whether t is a known ref type.
+func (t RefType) Valid() bool {
+	switch t {
+	case RefTypeBranch, RefTypeCommit, RefTypeTag:
+		return true
+	default:
+		return false
+	}
+}
+
 // Credential stores encrypted authentication materials.
 type Credential struct {
 	ID        int64
@@ -23,6 +74,60 @@ type Credential struct {
 	UpdatedAt time.Time
 }
 
+// Cluster is a Nomad cluster that repositories can deploy to. Its token and
+// client key are encrypted in Secrets.
+type Cluster struct {
+	ID            int64
+	Name          string
+	Address       string
+	Region        string
+	Namespace     string
+	Secrets       []byte
+	CACert        string
+	ClientCert    string
+	TLSServerName string
+	TLSSkipVerify bool
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// NotificationKind enumerates the supported notification channels.
+type NotificationKind string
+
+const (
+	// NotificationKindWebhook posts events as JSON to a URL.
+	NotificationKindWebhook NotificationKind = "webhook"
+	// NotificationKindSlack posts events to a Slack-compatible incoming webhook.
+	NotificationKindSlack NotificationKind = "slack"
+	// NotificationKindEmail sends events by SMTP.
+	NotificationKindEmail NotificationKind = "email"
+)
+
+// Valid reports whether k is a known kind.
+func (k NotificationKind) Valid() bool {
+	switch k {
+	case NotificationKindWebhook, NotificationKindSlack, NotificationKindEmail:
+		return true
+	default:
+		return false
+	}
+}
+
+// NotificationChannel is a destination for reconcile events.
+type NotificationChannel struct {
+	ID   int64
+	Name string
+	Kind NotificationKind
+	// RepoID limits the channel to one repository. Unset channels receive
+	// events from every repository.
+	RepoID sql.NullInt64
+	// Events lists the event types the channel receives. Empty means all.
+	Events    []string
+	Settings  []byte
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
 // Repository describes a tracked git repository.
 type Repository struct {
 	ID               int64
@@ -37,6 +142,66 @@ type Repository struct {
 	LastCommitAuthor sql.NullString
 	LastCommitTitle  sql.NullString
 	LastPolledAt     sql.NullTime
+	// Variables holds HCL2 input variable values passed to every jobspec in
+	// the repository.
+	Variables  map[string]string
+	SyncPolicy SyncPolicy
+	RefType    RefType
+	// Ref holds the pinned commit SHA or tag constraint, depending on RefType.
+	Ref string
+	// ResolvedRef is the fully qualified ref the last sync checked out.
+	ResolvedRef sql.NullString
+	// RollbackCommit pins reconciliation to a previous commit until it is
+	// cleared by resuming the repository.
+	RollbackCommit sql.NullString
+	// PollInterval overrides the global poll interval when set.
+	PollInterval sql.NullInt64
+	// FailureCount is the number of consecutive failed reconciles, used to
+	// back off polling.
+	FailureCount int
+	// NextPollAt is when the repository is next due for reconciliation.
+	NextPollAt sql.NullTime
+	// AutoRevert reverts a job to its last stable version when the
+	// deployment for a new commit fails.
+	AutoRevert bool
+	// UnhealthyCommit is the commit whose deployment failed. While it is set,
+	// changes are held until an operator acknowledges the failure.
+	UnhealthyCommit sql.NullString
+	UnhealthyReason sql.NullString
+	UnhealthyAt     sql.NullTime
+	// Namespaces restricts which Nomad namespaces the repository may deploy
+	// into. Empty allows any namespace.
+	Namespaces []string
+	// ClusterID is the cluster the repository deploys to. When unset it uses
+	// the cluster configured through the environment.
+	ClusterID sql.NullInt64
+	// JobPolicy holds rules every job in the repository must satisfy, in
+	// addition to the global rules.
+	JobPolicy jobpolicy.Rules
+	// OverlayPath is a directory of partial jobs merged into the job files
+	// at the same relative path under JobPath. Empty disables overlays.
+	OverlayPath string
+	// StatusProvider is the Git host commit statuses are reported to:
+	// github, gitlab or gitea. Empty disables reporting.
+	StatusProvider string
+	// StatusAPIURL overrides the provider's API root.
+	StatusAPIURL string
+	// WebhookSecret is the encrypted secret that verifies push webhooks for
+	// the repository. Webhooks are rejected when it is empty.
+	WebhookSecret []byte
+}
+
+// AllowsNamespace reports whether the repository may deploy into namespace.
+func (r *Repository) AllowsNamespace(namespace string) bool {
+	if len(r.Namespaces) == 0 {
+		return true
+	}
+	for _, allowed := range r.Namespaces {
+		if allowed == namespace {
+			return true
+		}
+	}
+	return false
 }
 
 // RepoFile tracks metadata for job files inside a repository.
@@ -47,4 +212,22 @@ type RepoFile struct {
 	LastCommit sql.NullString
 	UpdatedAt  time.Time
 	JobID      sql.NullString
+	// Namespace is the Nomad namespace the job was registered in.
+	Namespace sql.NullString
+	// LastError, LastErrorPhase and LastErrorAt describe the most recent
+	// reconcile failure for the file; they are cleared once it succeeds.
+	LastError      sql.NullString
+	LastErrorPhase sql.NullString
+	LastErrorAt    sql.NullTime
+	// DeployVersion, DeployCommit and DeployStartedAt describe a deployment
+	// compass is waiting on after registering the job.
+	DeployVersion   sql.NullInt64
+	DeployCommit    sql.NullString
+	DeployStartedAt sql.NullTime
+}
+
+// FileError is a reconcile failure for a single job file.
+type FileError struct {
+	Phase   string
+	Message string
 }
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/brianmichel/nomad-compass/internal/auth"
+)
+
+// NotificationSettings holds a channel's clear-text delivery settings before
+// encryption. Webhook and Slack channels use URL; email channels use the SMTP
+// fields.
+type NotificationSettings struct {
+	URL      string   `json:"url,omitempty"`
+	SMTPHost string   `json:"smtp_host,omitempty"`
+	SMTPPort int      `json:"smtp_port,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+}
+
+// NotificationChannelInput describes a channel to create.
+type NotificationChannelInput struct {
+	Name     string
+	Kind     NotificationKind
+	RepoID   sql.NullInt64
+	Events   []string
+	Settings NotificationSettings
+}
+
+const notificationColumns = `id, name, kind, repo_id, events, settings, created_at, updated_at`
+
+// NotificationStore manages notification channel persistence.
+type NotificationStore struct {
+	db        *sql.DB
+	encryptor *auth.Encryptor
+}
+
+// NewNotificationStore constructs a notification store.
+func NewNotificationStore(db *sql.DB, encryptor *auth.Encryptor) *NotificationStore {
+	return &NotificationStore{db: db, encryptor: encryptor}
+}
+
+// Create stores a new channel, encrypting its settings.
+func (s *NotificationStore) Create(ctx context.Context, input NotificationChannelInput) (*NotificationChannel, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, errors.New("channel name is required")
+	}
+	if !input.Kind.Valid() {
+		return nil, fmt.Errorf("unknown notification kind %q", input.Kind)
+	}
+	raw, err := json.Marshal(input.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("marshal settings: %w", err)
+	}
+	cipher, err := s.encryptor.Encrypt(raw)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt settings: %w", err)
+	}
+	var events sql.NullString
+	if len(input.Events) > 0 {
+		encoded, err := json.Marshal(input.Events)
+		if err != nil {
+			return nil, fmt.Errorf("marshal events: %w", err)
+		}
+		events = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	now := Now()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO notification_channels (name, kind, repo_id, events, settings, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		name, string(input.Kind), nullable(input.RepoID), events, cipher, now, now)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &NotificationChannel{
+		ID:        id,
+		Name:      name,
+		Kind:      input.Kind,
+		RepoID:    input.RepoID,
+		Events:    input.Events,
+		Settings:  cipher,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// List returns all channels without decrypting their settings.
+func (s *NotificationStore) List(ctx context.Context) ([]NotificationChannel, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+notificationColumns+` FROM notification_channels ORDER BY name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []NotificationChannel
+	for rows.Next() {
+		channel, err := scanNotificationChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, *channel)
+	}
+	return channels, rows.Err()
+}
+
+// DecryptSettings returns the decrypted settings for a channel.
+func (s *NotificationStore) DecryptSettings(c *NotificationChannel) (*NotificationSettings, error) {
+	raw, err := s.encryptor.Decrypt(c.Settings)
+	if err != nil {
+		return nil, err
+	}
+	var settings NotificationSettings
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// Delete removes a channel by ID.
+func (s *NotificationStore) Delete(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM notification_channels WHERE id = ?`, id)
+	return err
+}
+
+func scanNotificationChannel(row rowScanner) (*NotificationChannel, error) {
+	var (
+		c      NotificationChannel
+		kind   string
+		events sql.NullString
+	)
+	if err := row.Scan(&c.ID, &c.Name, &kind, &c.RepoID, &events, &c.Settings, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	c.Kind = NotificationKind(kind)
+	if events.Valid && events.String != "" {
+		if err := json.Unmarshal([]byte(events.String), &c.Events); err != nil {
+			return nil, fmt.Errorf("decode events for channel %d: %w", c.ID, err)
+		}
+	}
+	return &c, nil
+}
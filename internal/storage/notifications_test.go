@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/brianmichel/nomad-compass/internal/auth"
+)
+
+func TestNotificationStoreCreateAndDecrypt(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	key := make([]byte, 32)
+	copy(key, []byte("0123456789abcdef0123456789abcdef"))
+	enc, err := auth.NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+	store := NewNotificationStore(db, enc)
+
+	if _, err := store.Create(ctx, NotificationChannelInput{Name: "ops", Kind: "pager"}); err == nil {
+		t.Fatal("expected an unknown kind to be rejected")
+	}
+
+	channel, err := store.Create(ctx, NotificationChannelInput{
+		Name:     "ops",
+		Kind:     NotificationKindSlack,
+		RepoID:   sql.NullInt64{Int64: 4, Valid: true},
+		Events:   []string{"apply_failed", "sync_failed"},
+		Settings: NotificationSettings{URL: "https://hooks.slack.test/T000/secret"},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if string(channel.Settings) == "https://hooks.slack.test/T000/secret" {
+		t.Fatal("settings stored in plaintext")
+	}
+
+	channels, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(channels) != 1 {
+		t.Fatalf("expected 1 channel, got %d", len(channels))
+	}
+	got := channels[0]
+	if got.Kind != NotificationKindSlack || got.RepoID.Int64 != 4 || len(got.Events) != 2 || got.Events[1] != "sync_failed" {
+		t.Fatalf("unexpected channel %+v", got)
+	}
+	settings, err := store.DecryptSettings(&got)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if settings.URL != "https://hooks.slack.test/T000/secret" {
+		t.Fatalf("unexpected settings %+v", settings)
+	}
+
+	if err := store.Delete(ctx, channel.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	channels, err = store.List(ctx)
+	if err != nil || len(channels) != 0 {
+		t.Fatalf("expected no channels after delete, got %v %v", channels, err)
+	}
+}
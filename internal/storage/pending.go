@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Pending change actions.
+const (
+	PendingActionApply  = "apply"
+	PendingActionRemove = "remove"
+)
+
+// PendingChange is a job change that was planned but held back by the
+// repository's sync policy.
+type PendingChange struct {
+	ID        int64
+	RepoID    int64
+	Path      string
+	JobID     sql.NullString
+	Commit    sql.NullString
+	Action    string
+	Summary   string
+	Diff      sql.NullString
+	CreatedAt time.Time
+}
+
+// PendingChangeStore persists held job changes.
+type PendingChangeStore struct {
+	db *sql.DB
+}
+
+// NewPendingChangeStore constructs a pending change store.
+func NewPendingChangeStore(db *sql.DB) *PendingChangeStore {
+	return &PendingChangeStore{db: db}
+}
+
+// Replace swaps the pending changes for a repository with changes.
+func (s *PendingChangeStore) Replace(ctx context.Context, repoID int64, changes []PendingChange) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM pending_changes WHERE repo_id = ?`, repoID); err != nil {
+		return err
+	}
+	now := Now()
+	for _, change := range changes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO pending_changes (repo_id, path, job_id, commit_sha, action, summary, diff, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			repoID, change.Path, change.JobID, change.Commit, change.Action, change.Summary, change.Diff, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListByRepo returns pending changes for a repository ordered by path.
+func (s *PendingChangeStore) ListByRepo(ctx context.Context, repoID int64) ([]PendingChange, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, repo_id, path, job_id, commit_sha, action, summary, diff, created_at FROM pending_changes WHERE repo_id = ? ORDER BY path`, repoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []PendingChange
+	for rows.Next() {
+		var change PendingChange
+		if err := rows.Scan(&change.ID, &change.RepoID, &change.Path, &change.JobID, &change.Commit, &change.Action, &change.Summary, &change.Diff, &change.CreatedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// DeleteByRepo removes pending changes for a repository.
+func (s *PendingChangeStore) DeleteByRepo(ctx context.Context, repoID int64) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM pending_changes WHERE repo_id = ?`, repoID)
+	return err
+}
@@ -3,8 +3,15 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/brianmichel/nomad-compass/internal/auth"
+	"github.com/brianmichel/nomad-compass/internal/jobpolicy"
 )
 
 // RepositoryInput is used when creating a repository record.
@@ -14,16 +21,119 @@ type RepositoryInput struct {
 	Branch       string
 	JobPath      string
 	CredentialID sql.NullInt64
+	Variables    map[string]string
+	SyncPolicy   SyncPolicy
+	RefType      RefType
+	Ref          string
+	// PollInterval is in seconds; zero uses the global interval.
+	PollInterval   int64
+	AutoRevert     bool
+	Namespaces     []string
+	ClusterID      sql.NullInt64
+	JobPolicy      jobpolicy.Rules
+	OverlayPath    string
+	StatusProvider string
+	StatusAPIURL   string
+	WebhookSecret  string
+}
+
+const repoColumns = `id, name, repo_url, branch, job_path, credential_id, created_at, updated_at, last_commit, last_commit_author, last_commit_title, last_polled_at, variables, sync_policy, rollback_commit, ref_type, ref, resolved_ref, poll_interval_seconds, failure_count, next_poll_at, auto_revert, unhealthy_commit, unhealthy_reason, unhealthy_at, namespaces, cluster_id, job_policy, overlay_path, status_provider, status_api_url, webhook_secret`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRepository(row rowScanner) (*Repository, error) {
+	var repo Repository
+	var variables, namespaces, rules sql.NullString
+	if err := row.Scan(
+		&repo.ID,
+		&repo.Name,
+		&repo.RepoURL,
+		&repo.Branch,
+		&repo.JobPath,
+		&repo.CredentialID,
+		&repo.CreatedAt,
+		&repo.UpdatedAt,
+		&repo.LastCommit,
+		&repo.LastCommitAuthor,
+		&repo.LastCommitTitle,
+		&repo.LastPolledAt,
+		&variables,
+		&repo.SyncPolicy,
+		&repo.RollbackCommit,
+		&repo.RefType,
+		&repo.Ref,
+		&repo.ResolvedRef,
+		&repo.PollInterval,
+		&repo.FailureCount,
+		&repo.NextPollAt,
+		&repo.AutoRevert,
+		&repo.UnhealthyCommit,
+		&repo.UnhealthyReason,
+		&repo.UnhealthyAt,
+		&namespaces,
+		&repo.ClusterID,
+		&rules,
+		&repo.OverlayPath,
+		&repo.StatusProvider,
+		&repo.StatusAPIURL,
+		&repo.WebhookSecret,
+	); err != nil {
+		return nil, err
+	}
+	if variables.Valid && variables.String != "" {
+		if err := json.Unmarshal([]byte(variables.String), &repo.Variables); err != nil {
+			return nil, fmt.Errorf("decode variables for repo %d: %w", repo.ID, err)
+		}
+	}
+	if namespaces.Valid && namespaces.String != "" {
+		if err := json.Unmarshal([]byte(namespaces.String), &repo.Namespaces); err != nil {
+			return nil, fmt.Errorf("decode namespaces for repo %d: %w", repo.ID, err)
+		}
+	}
+	if rules.Valid && rules.String != "" {
+		if err := json.Unmarshal([]byte(rules.String), &repo.JobPolicy); err != nil {
+			return nil, fmt.Errorf("decode job policy for repo %d: %w", repo.ID, err)
+		}
+	}
+	return &repo, nil
 }
 
 // RepoStore manages repository persistence.
 type RepoStore struct {
-	db *sql.DB
+	db        *sql.DB
+	encryptor *auth.Encryptor
 }
 
-// NewRepoStore constructs a repository store.
-func NewRepoStore(db *sql.DB) *RepoStore {
-	return &RepoStore{db: db}
+// NewRepoStore constructs a repository store. The encryptor protects webhook
+// secrets; without one, repositories cannot have them.
+func NewRepoStore(db *sql.DB, encryptor *auth.Encryptor) *RepoStore {
+	return &RepoStore{db: db, encryptor: encryptor}
+}
+
+// CheckOverlayPath rejects an overlay directory that leaves the repository
+// or overlaps the job path. Overlays inside the job path would be discovered
+// as jobs themselves, along with any sibling overlays for other
+// environments.
+func CheckOverlayPath(jobPath, overlayPath string) error {
+	if overlayPath == "" {
+		return nil
+	}
+	if !filepath.IsLocal(overlayPath) {
+		return fmt.Errorf("overlay path %q must be relative and stay inside the repository", overlayPath)
+	}
+	overlay, jobs := filepath.Clean(overlayPath), filepath.Clean(jobPath)
+	if within(overlay, jobs) || within(jobs, overlay) {
+		return fmt.Errorf("overlay path %q must not overlap job path %q", overlayPath, jobPath)
+	}
+	return nil
+}
+
+// within reports whether path is dir or inside it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
 }
 
 // Create inserts a new repository entry.
@@ -33,8 +143,52 @@ func (s *RepoStore) Create(ctx context.Context, input RepositoryInput) (*Reposit
 	if jobPath == "" {
 		jobPath = ".nomad"
 	}
-	res, err := s.db.ExecContext(ctx, `INSERT INTO repos (name, repo_url, branch, job_path, credential_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		input.Name, input.RepoURL, input.Branch, jobPath, nullable(input.CredentialID), now, now)
+	overlayPath := strings.TrimSpace(input.OverlayPath)
+	if err := CheckOverlayPath(jobPath, overlayPath); err != nil {
+		return nil, err
+	}
+	policy := input.SyncPolicy
+	if policy == "" {
+		policy = SyncPolicyAuto
+	}
+	if !policy.Valid() {
+		return nil, fmt.Errorf("unknown sync policy %q", policy)
+	}
+	refType := input.RefType
+	if refType == "" {
+		refType = RefTypeBranch
+	}
+	if !refType.Valid() {
+		return nil, fmt.Errorf("unknown ref type %q", refType)
+	}
+	ref := strings.TrimSpace(input.Ref)
+	if input.PollInterval < 0 {
+		return nil, fmt.Errorf("poll interval must not be negative")
+	}
+	pollInterval := sql.NullInt64{Int64: input.PollInterval, Valid: input.PollInterval > 0}
+	variables, err := encodeVariables(input.Variables)
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := encodeNamespaces(input.Namespaces)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := encodeJobPolicy(input.JobPolicy)
+	if err != nil {
+		return nil, err
+	}
+	webhookSecret := []byte{}
+	if input.WebhookSecret != "" {
+		if s.encryptor == nil {
+			return nil, errors.New("webhook secrets need an encryption key")
+		}
+		if webhookSecret, err = s.encryptor.Encrypt([]byte(input.WebhookSecret)); err != nil {
+			return nil, fmt.Errorf("encrypt webhook secret: %w", err)
+		}
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO repos (name, repo_url, branch, job_path, credential_id, created_at, updated_at, variables, sync_policy, ref_type, ref, poll_interval_seconds, auto_revert, namespaces, cluster_id, job_policy, overlay_path, status_provider, status_api_url, webhook_secret) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		input.Name, input.RepoURL, input.Branch, jobPath, nullable(input.CredentialID), now, now, variables, string(policy), string(refType), ref, nullable(pollInterval), input.AutoRevert, namespaces, nullable(input.ClusterID), rules, overlayPath, input.StatusProvider, strings.TrimSpace(input.StatusAPIURL), webhookSecret)
 	if err != nil {
 		return nil, err
 	}
@@ -44,18 +198,47 @@ func (s *RepoStore) Create(ctx context.Context, input RepositoryInput) (*Reposit
 	}
 
 	repo := &Repository{
-		ID:           id,
-		Name:         input.Name,
-		RepoURL:      input.RepoURL,
-		Branch:       input.Branch,
-		JobPath:      jobPath,
-		CredentialID: input.CredentialID,
-		CreatedAt:    now,
-		UpdatedAt:    now,
+		ID:             id,
+		Name:           input.Name,
+		RepoURL:        input.RepoURL,
+		Branch:         input.Branch,
+		JobPath:        jobPath,
+		CredentialID:   input.CredentialID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Variables:      input.Variables,
+		SyncPolicy:     policy,
+		RefType:        refType,
+		Ref:            ref,
+		PollInterval:   pollInterval,
+		AutoRevert:     input.AutoRevert,
+		Namespaces:     input.Namespaces,
+		ClusterID:      input.ClusterID,
+		JobPolicy:      input.JobPolicy,
+		OverlayPath:    overlayPath,
+		StatusProvider: input.StatusProvider,
+		StatusAPIURL:   strings.TrimSpace(input.StatusAPIURL),
+		WebhookSecret:  webhookSecret,
 	}
 	return repo, nil
 }
 
+// DecryptWebhookSecret returns the repository's webhook secret, or an empty
+// string when it has none.
+func (s *RepoStore) DecryptWebhookSecret(r *Repository) (string, error) {
+	if len(r.WebhookSecret) == 0 {
+		return "", nil
+	}
+	if s.encryptor == nil {
+		return "", errors.New("webhook secrets need an encryption key")
+	}
+	raw, err := s.encryptor.Decrypt(r.WebhookSecret)
+	if err != nil {
+		return "", fmt.Errorf("decrypt webhook secret: %w", err)
+	}
+	return string(raw), nil
+}
+
 // Delete removes a repository and associated metadata.
 func (s *RepoStore) Delete(ctx context.Context, id int64) error {
 	_, err := s.db.ExecContext(ctx, `DELETE FROM repos WHERE id = ?`, id)
@@ -64,7 +247,26 @@ func (s *RepoStore) Delete(ctx context.Context, id int64) error {
 
 // List returns all repositories.
 func (s *RepoStore) List(ctx context.Context) ([]Repository, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT id, name, repo_url, branch, job_path, credential_id, created_at, updated_at, last_commit, last_commit_author, last_commit_title, last_polled_at FROM repos ORDER BY created_at DESC`)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+repoColumns+` FROM repos ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var repos []Repository
+	for rows.Next() {
+		repo, err := scanRepository(rows)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, *repo)
+	}
+	return repos, rows.Err()
+}
+
+// ListByCluster returns repositories deploying to a cluster.
+func (s *RepoStore) ListByCluster(ctx context.Context, clusterID int64) ([]Repository, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+repoColumns+` FROM repos WHERE cluster_id = ? ORDER BY created_at DESC`, clusterID)
 	if err != nil {
 		return nil, err
 	}
@@ -72,31 +274,18 @@ func (s *RepoStore) List(ctx context.Context) ([]Repository, error) {
 
 	var repos []Repository
 	for rows.Next() {
-		var repo Repository
-		if err := rows.Scan(
-			&repo.ID,
-			&repo.Name,
-			&repo.RepoURL,
-			&repo.Branch,
-			&repo.JobPath,
-			&repo.CredentialID,
-			&repo.CreatedAt,
-			&repo.UpdatedAt,
-			&repo.LastCommit,
-			&repo.LastCommitAuthor,
-			&repo.LastCommitTitle,
-			&repo.LastPolledAt,
-		); err != nil {
+		repo, err := scanRepository(rows)
+		if err != nil {
 			return nil, err
 		}
-		repos = append(repos, repo)
+		repos = append(repos, *repo)
 	}
 	return repos, rows.Err()
 }
 
 // ListByCredential returns repositories linked to a credential.
 func (s *RepoStore) ListByCredential(ctx context.Context, credentialID int64) ([]Repository, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT id, name, repo_url, branch, job_path, credential_id, created_at, updated_at, last_commit, last_commit_author, last_commit_title, last_polled_at FROM repos WHERE credential_id = ? ORDER BY created_at DESC`, credentialID)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+repoColumns+` FROM repos WHERE credential_id = ? ORDER BY created_at DESC`, credentialID)
 	if err != nil {
 		return nil, err
 	}
@@ -104,24 +293,11 @@ func (s *RepoStore) ListByCredential(ctx context.Context, credentialID int64) ([
 
 	var repos []Repository
 	for rows.Next() {
-		var repo Repository
-		if err := rows.Scan(
-			&repo.ID,
-			&repo.Name,
-			&repo.RepoURL,
-			&repo.Branch,
-			&repo.JobPath,
-			&repo.CredentialID,
-			&repo.CreatedAt,
-			&repo.UpdatedAt,
-			&repo.LastCommit,
-			&repo.LastCommitAuthor,
-			&repo.LastCommitTitle,
-			&repo.LastPolledAt,
-		); err != nil {
+		repo, err := scanRepository(rows)
+		if err != nil {
 			return nil, err
 		}
-		repos = append(repos, repo)
+		repos = append(repos, *repo)
 	}
 	return repos, rows.Err()
 }
@@ -134,34 +310,21 @@ func (s *RepoStore) ClearCredential(ctx context.Context, credentialID int64) err
 
 // Get fetches a repository by ID.
 func (s *RepoStore) Get(ctx context.Context, id int64) (*Repository, error) {
-	row := s.db.QueryRowContext(ctx, `SELECT id, name, repo_url, branch, job_path, credential_id, created_at, updated_at, last_commit, last_commit_author, last_commit_title, last_polled_at FROM repos WHERE id = ?`, id)
-	var repo Repository
-	if err := row.Scan(
-		&repo.ID,
-		&repo.Name,
-		&repo.RepoURL,
-		&repo.Branch,
-		&repo.JobPath,
-		&repo.CredentialID,
-		&repo.CreatedAt,
-		&repo.UpdatedAt,
-		&repo.LastCommit,
-		&repo.LastCommitAuthor,
-		&repo.LastCommitTitle,
-		&repo.LastPolledAt,
-	); err != nil {
+	row := s.db.QueryRowContext(ctx, `SELECT `+repoColumns+` FROM repos WHERE id = ?`, id)
+	repo, err := scanRepository(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &repo, nil
+	return repo, nil
 }
 
 // UpdateCommitMetadata stores the latest reconciliation data.
-func (s *RepoStore) UpdateCommitMetadata(ctx context.Context, id int64, commit, author, title string) error {
-	_, err := s.db.ExecContext(ctx, `UPDATE repos SET last_commit = ?, last_commit_author = ?, last_commit_title = ?, last_polled_at = ?, updated_at = ? WHERE id = ?`,
-		commitOrNull(commit), commitOrNull(author), commitOrNull(title), Now(), Now(), id)
+func (s *RepoStore) UpdateCommitMetadata(ctx context.Context, id int64, commit, author, title, ref string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE repos SET last_commit = ?, last_commit_author = ?, last_commit_title = ?, resolved_ref = ?, last_polled_at = ?, updated_at = ? WHERE id = ?`,
+		commitOrNull(commit), commitOrNull(author), commitOrNull(title), commitOrNull(ref), Now(), Now(), id)
 	return err
 }
 
@@ -172,6 +335,39 @@ func nullable(val sql.NullInt64) interface{} {
 	return nil
 }
 
+func encodeVariables(vars map[string]string) (interface{}, error) {
+	if len(vars) == 0 {
+		return nil, nil
+	}
+	raw, err := json.Marshal(vars)
+	if err != nil {
+		return nil, fmt.Errorf("encode variables: %w", err)
+	}
+	return string(raw), nil
+}
+
+func encodeNamespaces(namespaces []string) (interface{}, error) {
+	if len(namespaces) == 0 {
+		return nil, nil
+	}
+	raw, err := json.Marshal(namespaces)
+	if err != nil {
+		return nil, fmt.Errorf("encode namespaces: %w", err)
+	}
+	return string(raw), nil
+}
+
+func encodeJobPolicy(rules jobpolicy.Rules) (interface{}, error) {
+	if rules.Empty() {
+		return nil, nil
+	}
+	raw, err := json.Marshal(rules)
+	if err != nil {
+		return nil, fmt.Errorf("encode job policy: %w", err)
+	}
+	return string(raw), nil
+}
+
 func commitOrNull(v string) interface{} {
 	if v == "" {
 		return nil
@@ -179,12 +375,61 @@ func commitOrNull(v string) interface{} {
 	return v
 }
 
+// SetRollbackCommit pins the repository to commit. An empty commit resumes
+// tracking the branch head.
+func (s *RepoStore) SetRollbackCommit(ctx context.Context, id int64, commit string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE repos SET rollback_commit = ?, updated_at = ? WHERE id = ?`, commitOrNull(commit), Now(), id)
+	return err
+}
+
+// UpdateSchedule records the consecutive failure count and when the
+// repository should next be polled.
+func (s *RepoStore) UpdateSchedule(ctx context.Context, id int64, failureCount int, nextPollAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE repos SET failure_count = ?, next_poll_at = ? WHERE id = ?`, failureCount, nextPollAt, id)
+	return err
+}
+
+// MarkDue makes the repository due for polling now, for whichever instance
+// is reconciling to pick up.
+func (s *RepoStore) MarkDue(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE repos SET next_poll_at = ? WHERE id = ?`, Now(), id)
+	return err
+}
+
+// MarkUnhealthy records that the deployment for commit failed.
+func (s *RepoStore) MarkUnhealthy(ctx context.Context, id int64, commit, reason string) error {
+	now := Now()
+	_, err := s.db.ExecContext(ctx, `UPDATE repos SET unhealthy_commit = ?, unhealthy_reason = ?, unhealthy_at = ?, updated_at = ? WHERE id = ?`, commitOrNull(commit), reason, now, now, id)
+	return err
+}
+
+// ClearUnhealthy acknowledges a failed deployment so changes flow again.
+func (s *RepoStore) ClearUnhealthy(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE repos SET unhealthy_commit = NULL, unhealthy_reason = NULL, unhealthy_at = NULL, updated_at = ? WHERE id = ?`, Now(), id)
+	return err
+}
+
 // UpdatePollTimestamp updates only the poll timestamp for scenarios where no change occurred.
 func (s *RepoStore) UpdatePollTimestamp(ctx context.Context, id int64) error {
 	_, err := s.db.ExecContext(ctx, `UPDATE repos SET last_polled_at = ?, updated_at = ? WHERE id = ?`, Now(), Now(), id)
 	return err
 }
 
+const repoFileColumns = `id, repo_id, path, last_commit, updated_at, job_id, namespace, last_error, last_error_phase, last_error_at, deploy_version, deploy_commit, deploy_started_at`
+
+func scanRepoFiles(rows *sql.Rows) ([]RepoFile, error) {
+	var files []RepoFile
+	for rows.Next() {
+		var file RepoFile
+		if err := rows.Scan(&file.ID, &file.RepoID, &file.Path, &file.LastCommit, &file.UpdatedAt, &file.JobID, &file.Namespace, &file.LastError, &file.LastErrorPhase, &file.LastErrorAt,
+			&file.DeployVersion, &file.DeployCommit, &file.DeployStartedAt); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
 // RepoFileStore manages job file metadata.
 type RepoFileStore struct {
 	db *sql.DB
@@ -196,30 +441,71 @@ func NewRepoFileStore(db *sql.DB) *RepoFileStore {
 }
 
 // Upsert stores or updates repo file metadata.
-func (s *RepoFileStore) Upsert(ctx context.Context, repoID int64, path string, commit string, jobID string) error {
+func (s *RepoFileStore) Upsert(ctx context.Context, repoID int64, path string, commit string, jobID string, namespace string) error {
 	now := Now()
-	_, err := s.db.ExecContext(ctx, `INSERT INTO repo_files (repo_id, path, last_commit, updated_at, job_id) VALUES (?, ?, ?, ?, ?)
-        ON CONFLICT(repo_id, path) DO UPDATE SET last_commit = excluded.last_commit, updated_at = excluded.updated_at, job_id = excluded.job_id`, repoID, path, commitOrNull(commit), now, jobIDOrNull(jobID))
+	_, err := s.db.ExecContext(ctx, `INSERT INTO repo_files (repo_id, path, last_commit, updated_at, job_id, namespace) VALUES (?, ?, ?, ?, ?, ?)
+        ON CONFLICT(repo_id, path) DO UPDATE SET last_commit = excluded.last_commit, updated_at = excluded.updated_at, job_id = excluded.job_id, namespace = excluded.namespace`, repoID, path, commitOrNull(commit), now, jobIDOrNull(jobID), jobIDOrNull(namespace))
 	return err
 }
 
 // ListByRepo returns tracked files for a repo.
 func (s *RepoFileStore) ListByRepo(ctx context.Context, repoID int64) ([]RepoFile, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT id, repo_id, path, last_commit, updated_at, job_id FROM repo_files WHERE repo_id = ?`, repoID)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+repoFileColumns+` FROM repo_files WHERE repo_id = ?`, repoID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var files []RepoFile
-	for rows.Next() {
-		var file RepoFile
-		if err := rows.Scan(&file.ID, &file.RepoID, &file.Path, &file.LastCommit, &file.UpdatedAt, &file.JobID); err != nil {
-			return nil, err
+	return scanRepoFiles(rows)
+}
+
+// ListAll returns tracked files for every repository.
+func (s *RepoFileStore) ListAll(ctx context.Context) ([]RepoFile, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+repoFileColumns+` FROM repo_files`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRepoFiles(rows)
+}
+
+// WatchDeployment records that compass is waiting on the deployment of version
+// of the file's job, registered for commit.
+func (s *RepoFileStore) WatchDeployment(ctx context.Context, repoID int64, path string, version uint64, commit string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE repo_files SET deploy_version = ?, deploy_commit = ?, deploy_started_at = ? WHERE repo_id = ? AND path = ?`,
+		int64(version), commitOrNull(commit), Now(), repoID, path)
+	return err
+}
+
+// ClearDeployment stops waiting on the file's deployment.
+func (s *RepoFileStore) ClearDeployment(ctx context.Context, repoID int64, path string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE repo_files SET deploy_version = NULL, deploy_commit = NULL, deploy_started_at = NULL WHERE repo_id = ? AND path = ?`, repoID, path)
+	return err
+}
+
+// ReplaceErrors records the failures from the latest reconcile of a
+// repository and clears them for every other file. A failing file that is not
+// tracked yet gets a row so errors in new files are visible too.
+func (s *RepoFileStore) ReplaceErrors(ctx context.Context, repoID int64, errs map[string]FileError) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE repo_files SET last_error = NULL, last_error_phase = NULL, last_error_at = NULL WHERE repo_id = ?`, repoID); err != nil {
+		return err
+	}
+	now := Now()
+	for path, fileErr := range errs {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO repo_files (repo_id, path, updated_at, last_error, last_error_phase, last_error_at) VALUES (?, ?, ?, ?, ?, ?)
+            ON CONFLICT(repo_id, path) DO UPDATE SET last_error = excluded.last_error, last_error_phase = excluded.last_error_phase, last_error_at = excluded.last_error_at`,
+			repoID, path, now, fileErr.Message, fileErr.Phase, now); err != nil {
+			return err
 		}
-		files = append(files, file)
 	}
-	return files, rows.Err()
+	return tx.Commit()
 }
 
 // DeleteByRepo removes entries for a repository.
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/brianmichel/nomad-compass/internal/auth"
+)
+
+func TestRepoStoreSchedule(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepoStore(openTestDB(t), nil)
+
+	repo, err := repos.Create(ctx, RepositoryInput{Name: "demo", RepoURL: "https://example.com/demo.git", Branch: "main", PollInterval: 10})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+
+	next := Now().Add(time.Minute)
+	if err := repos.UpdateSchedule(ctx, repo.ID, 3, next); err != nil {
+		t.Fatalf("update schedule: %v", err)
+	}
+
+	got, err := repos.Get(ctx, repo.ID)
+	if err != nil {
+		t.Fatalf("get repo: %v", err)
+	}
+	if !got.PollInterval.Valid || got.PollInterval.Int64 != 10 {
+		t.Fatalf("expected poll interval 10, got %+v", got.PollInterval)
+	}
+	if got.FailureCount != 3 {
+		t.Fatalf("expected failure count 3, got %d", got.FailureCount)
+	}
+	if !got.NextPollAt.Valid || !got.NextPollAt.Time.Equal(next) {
+		t.Fatalf("expected next poll %s, got %+v", next, got.NextPollAt)
+	}
+
+	if err := repos.MarkDue(ctx, repo.ID); err != nil {
+		t.Fatalf("mark due: %v", err)
+	}
+	got, err = repos.Get(ctx, repo.ID)
+	if err != nil {
+		t.Fatalf("get repo: %v", err)
+	}
+	if !got.NextPollAt.Valid || got.NextPollAt.Time.After(Now()) {
+		t.Fatalf("expected repo due now, got %+v", got.NextPollAt)
+	}
+	if got.FailureCount != 3 {
+		t.Fatalf("expected failure count kept, got %d", got.FailureCount)
+	}
+
+	if _, err := repos.Create(ctx, RepositoryInput{Name: "bad", RepoURL: "https://example.com/bad.git", Branch: "main", PollInterval: -1}); err == nil {
+		t.Fatalf("expected negative poll interval to be rejected")
+	}
+}
+
+func TestRepoFileStoreReplaceErrors(t *testing.T) {
+	ctx := context.Background()
+	files := NewRepoFileStore(openTestDB(t))
+
+	if err := files.Upsert(ctx, 1, "api.nomad.hcl", "abc", "api", ""); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	errs := map[string]FileError{
+		"api.nomad.hcl": {Phase: JobPhaseApply, Message: "register failed"},
+		"new.nomad.hcl": {Phase: JobPhaseParse, Message: "bad hcl"},
+	}
+	if err := files.ReplaceErrors(ctx, 1, errs); err != nil {
+		t.Fatalf("replace errors: %v", err)
+	}
+
+	list, err := files.ListByRepo(ctx, 1)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected failing new file to be tracked, got %+v", list)
+	}
+	for _, file := range list {
+		want := errs[file.Path]
+		if file.LastError.String != want.Message || file.LastErrorPhase.String != want.Phase || !file.LastErrorAt.Valid {
+			t.Fatalf("unexpected error for %s: %+v", file.Path, file)
+		}
+		if file.Path == "api.nomad.hcl" && (file.JobID.String != "api" || file.LastCommit.String != "abc") {
+			t.Fatalf("expected tracking preserved, got %+v", file)
+		}
+	}
+
+	if err := files.ReplaceErrors(ctx, 1, nil); err != nil {
+		t.Fatalf("clear errors: %v", err)
+	}
+	list, err = files.ListByRepo(ctx, 1)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	for _, file := range list {
+		if file.LastError.Valid || file.LastErrorPhase.Valid || file.LastErrorAt.Valid {
+			t.Fatalf("expected errors cleared, got %+v", file)
+		}
+	}
+}
+
+func TestRepoStoreNamespaces(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepoStore(openTestDB(t), nil)
+
+	created, err := repos.Create(ctx, RepositoryInput{Name: "demo", RepoURL: "https://example.com/demo.git", Branch: "main", Namespaces: []string{"web", "payments"}})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+	repo, err := repos.Get(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("get repo: %v", err)
+	}
+	if len(repo.Namespaces) != 2 || !repo.AllowsNamespace("payments") || repo.AllowsNamespace("default") {
+		t.Fatalf("unexpected namespaces: %v", repo.Namespaces)
+	}
+	if open := (&Repository{}); !open.AllowsNamespace("default") {
+		t.Fatalf("expected a repository without namespaces to allow any")
+	}
+}
+
+func TestRepoStoreEncryptsWebhookSecret(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	enc, err := auth.NewEncryptor([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+	repos := NewRepoStore(db, enc)
+
+	repo, err := repos.Create(ctx, RepositoryInput{Name: "demo", RepoURL: "https://example.com/demo.git", Branch: "main", WebhookSecret: "s3cret"})
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+	var stored []byte
+	if err := db.QueryRowContext(ctx, `SELECT webhook_secret FROM repos WHERE id = ?`, repo.ID).Scan(&stored); err != nil {
+		t.Fatalf("read secret: %v", err)
+	}
+	if len(stored) == 0 || bytes.Contains(stored, []byte("s3cret")) {
+		t.Fatalf("expected webhook secret encrypted at rest, got %q", stored)
+	}
+
+	got, err := repos.Get(ctx, repo.ID)
+	if err != nil {
+		t.Fatalf("get repo: %v", err)
+	}
+	secret, err := repos.DecryptWebhookSecret(got)
+	if err != nil || secret != "s3cret" {
+		t.Fatalf("expected secret to decrypt, got %q, %v", secret, err)
+	}
+
+	if _, err := NewRepoStore(db, nil).Create(ctx, RepositoryInput{Name: "plain", RepoURL: "https://example.com/plain.git", Branch: "main", WebhookSecret: "s3cret"}); err == nil {
+		t.Fatal("expected a webhook secret without an encryptor to be rejected")
+	}
+}
+
+func TestRepoStoreChecksOverlayPath(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepoStore(openTestDB(t), nil)
+
+	for _, tc := range []struct {
+		jobPath, overlayPath string
+		ok                   bool
+	}{
+		{".nomad", "overlays/prod", true},
+		{"", "overlays/prod", true},
+		{".nomad", ".nomad", false},
+		{".nomad", ".nomad/overlays/prod", false},
+		{".nomad/apps", ".nomad", false},
+		{".", "overlays/prod", false},
+		{".nomad", "../other-repo", false},
+		{".nomad", "overlays/../../other-repo", false},
+		{".nomad", "/etc", false},
+	} {
+		_, err := repos.Create(ctx, RepositoryInput{Name: "demo", RepoURL: "https://example.com/demo.git", Branch: "main", JobPath: tc.jobPath, OverlayPath: tc.overlayPath})
+		if (err == nil) != tc.ok {
+			t.Fatalf("job path %q, overlay path %q: expected ok=%v, got %v", tc.jobPath, tc.overlayPath, tc.ok, err)
+		}
+	}
+}
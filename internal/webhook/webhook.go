@@ -0,0 +1,226 @@
+// Package webhook verifies and decodes push webhooks sent by Git hosts.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+
+	"github.com/brianmichel/nomad-compass/internal/commitstatus"
+)
+
+// Supported webhook providers.
+const (
+	ProviderGitHub    = "github"
+	ProviderGitLab    = "gitlab"
+	ProviderGitea     = "gitea"
+	ProviderBitbucket = "bitbucket"
+)
+
+// ErrUnknownProvider is returned for providers compass cannot decode.
+var ErrUnknownProvider = errors.New("unknown webhook provider")
+
+// ValidProvider reports whether provider is supported.
+func ValidProvider(provider string) bool {
+	switch provider {
+	case ProviderGitHub, ProviderGitLab, ProviderGitea, ProviderBitbucket:
+		return true
+	default:
+		return false
+	}
+}
+
+// Push describes a push event.
+type Push struct {
+	// URLs holds the addresses the payload gives for the repository.
+	URLs []string
+	// Refs holds the fully qualified refs the push updated, e.g.
+	// "refs/heads/main".
+	Refs []string
+}
+
+// FromRepository reports whether the push came from the repository cloned
+// from repoURL. Scheme, credentials and a trailing ".git" are ignored.
+func (p *Push) FromRepository(repoURL string) bool {
+	host, path, err := commitstatus.ParseRepoURL(repoURL)
+	if err != nil {
+		return false
+	}
+	for _, candidate := range p.URLs {
+		h, pth, err := commitstatus.ParseRepoURL(candidate)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(h, host) && strings.EqualFold(pth, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Updates reports whether the push updated ref.
+func (p *Push) Updates(ref string) bool {
+	for _, r := range p.Refs {
+		if r == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdatesTag reports whether the push updated a tag that is a semantic
+// version satisfying constraint, the tags a repository tracking constraint
+// would deploy.
+func (p *Push) UpdatesTag(constraint string) bool {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false
+	}
+	for _, r := range p.Refs {
+		tag, ok := strings.CutPrefix(r, "refs/tags/")
+		if !ok {
+			continue
+		}
+		if version, err := semver.NewVersion(tag); err == nil && c.Check(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse decodes a push event. Other events, such as pings, return nil
+// without error.
+func Parse(provider string, header http.Header, body []byte) (*Push, error) {
+	switch provider {
+	case ProviderGitHub, ProviderGitea:
+		event := header.Get("X-GitHub-Event")
+		if provider == ProviderGitea {
+			event = header.Get("X-Gitea-Event")
+		}
+		if event != "push" {
+			return nil, nil
+		}
+		var payload struct {
+			Ref        string `json:"ref"`
+			Repository struct {
+				CloneURL string `json:"clone_url"`
+				SSHURL   string `json:"ssh_url"`
+				HTMLURL  string `json:"html_url"`
+			} `json:"repository"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("decode push: %w", err)
+		}
+		repo := payload.Repository
+		return &Push{URLs: nonEmpty(repo.CloneURL, repo.SSHURL, repo.HTMLURL), Refs: nonEmpty(payload.Ref)}, nil
+	case ProviderGitLab:
+		switch header.Get("X-Gitlab-Event") {
+		case "Push Hook", "Tag Push Hook":
+		default:
+			return nil, nil
+		}
+		var payload struct {
+			Ref     string `json:"ref"`
+			Project struct {
+				HTTPURL string `json:"git_http_url"`
+				SSHURL  string `json:"git_ssh_url"`
+				WebURL  string `json:"web_url"`
+			} `json:"project"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("decode push: %w", err)
+		}
+		project := payload.Project
+		return &Push{URLs: nonEmpty(project.HTTPURL, project.SSHURL, project.WebURL), Refs: nonEmpty(payload.Ref)}, nil
+	case ProviderBitbucket:
+		if header.Get("X-Event-Key") != "repo:push" {
+			return nil, nil
+		}
+		var payload struct {
+			Push struct {
+				Changes []struct {
+					New *struct {
+						Type string `json:"type"`
+						Name string `json:"name"`
+					} `json:"new"`
+				} `json:"changes"`
+			} `json:"push"`
+			Repository struct {
+				Links struct {
+					HTML struct {
+						Href string `json:"href"`
+					} `json:"html"`
+				} `json:"links"`
+			} `json:"repository"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("decode push: %w", err)
+		}
+		push := &Push{URLs: nonEmpty(payload.Repository.Links.HTML.Href)}
+		for _, change := range payload.Push.Changes {
+			// A nil new state means the ref was deleted.
+			if change.New == nil {
+				continue
+			}
+			switch change.New.Type {
+			case "branch":
+				push.Refs = append(push.Refs, "refs/heads/"+change.New.Name)
+			case "tag":
+				push.Refs = append(push.Refs, "refs/tags/"+change.New.Name)
+			}
+		}
+		return push, nil
+	default:
+		return nil, ErrUnknownProvider
+	}
+}
+
+// Verify reports whether the request carries a valid signature for secret.
+// GitLab sends the secret itself; the other providers sign the body with
+// HMAC-SHA256. An empty secret never verifies.
+func Verify(provider string, header http.Header, body []byte, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	switch provider {
+	case ProviderGitHub:
+		return validHMAC(strings.TrimPrefix(header.Get("X-Hub-Signature-256"), "sha256="), body, secret)
+	case ProviderGitea:
+		return validHMAC(header.Get("X-Gitea-Signature"), body, secret)
+	case ProviderBitbucket:
+		return validHMAC(strings.TrimPrefix(header.Get("X-Hub-Signature"), "sha256="), body, secret)
+	case ProviderGitLab:
+		token := header.Get("X-Gitlab-Token")
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	default:
+		return false
+	}
+}
+
+func validHMAC(signature string, body []byte, secret string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
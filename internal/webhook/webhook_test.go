@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+)
+
+func sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	cases := []struct {
+		provider string
+		header   string
+		value    string
+	}{
+		{ProviderGitHub, "X-Hub-Signature-256", "sha256=" + sign(body, "s3cret")},
+		{ProviderGitea, "X-Gitea-Signature", sign(body, "s3cret")},
+		{ProviderBitbucket, "X-Hub-Signature", "sha256=" + sign(body, "s3cret")},
+		{ProviderGitLab, "X-Gitlab-Token", "s3cret"},
+	}
+	for _, tc := range cases {
+		header := http.Header{}
+		header.Set(tc.header, tc.value)
+		if !Verify(tc.provider, header, body, "s3cret") {
+			t.Fatalf("%s: expected signature to verify", tc.provider)
+		}
+		if Verify(tc.provider, header, body, "other") {
+			t.Fatalf("%s: expected wrong secret to fail", tc.provider)
+		}
+		if Verify(tc.provider, header, body, "") {
+			t.Fatalf("%s: expected empty secret to fail", tc.provider)
+		}
+	}
+}
+
+func TestParseGitLabPush(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Gitlab-Event", "Push Hook")
+	push, err := Parse(ProviderGitLab, header, []byte(`{"ref":"refs/heads/main","project":{"git_http_url":"https://gitlab.com/group/api.git","git_ssh_url":"git@gitlab.com:group/api.git"}}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !push.FromRepository("git@gitlab.com:Group/api") || push.FromRepository("https://gitlab.com/group/web.git") {
+		t.Fatalf("unexpected repository match for %#v", push.URLs)
+	}
+	if !push.Updates("refs/heads/main") || push.Updates("refs/heads/dev") {
+		t.Fatalf("unexpected refs %#v", push.Refs)
+	}
+}
+
+func TestParseBitbucketPush(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Event-Key", "repo:push")
+	body := []byte(`{"push":{"changes":[{"new":{"type":"branch","name":"main"}},{"new":{"type":"tag","name":"v1.2.0"}},{"new":null}]},"repository":{"links":{"html":{"href":"https://bitbucket.org/team/api"}}}}`)
+	push, err := Parse(ProviderBitbucket, header, body)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !push.FromRepository("https://user@bitbucket.org/team/api.git") {
+		t.Fatalf("expected repository match for %#v", push.URLs)
+	}
+	if !push.Updates("refs/heads/main") || !push.UpdatesTag("^1.0") {
+		t.Fatalf("unexpected refs %#v", push.Refs)
+	}
+	if push.UpdatesTag("^2.0") {
+		t.Fatalf("expected v1.2.0 not to satisfy ^2.0")
+	}
+}
+
+func TestParseIgnoresOtherEvents(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-GitHub-Event", "ping")
+	push, err := Parse(ProviderGitHub, header, []byte(`{"zen":"hi"}`))
+	if err != nil || push != nil {
+		t.Fatalf("expected ping to be ignored, got %#v, %v", push, err)
+	}
+}